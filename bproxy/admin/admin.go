@@ -2,22 +2,35 @@ package admin
 
 import (
         "crypto/tls"
+        "errors"
         "fmt"
         "io"
         "log"
         "net"
         "sync"
+        "sync/atomic"
         "time"
 
         "github.com/hashicorp/yamux"
         pb "github.com/bproxy/bproxy/proto"
+        "github.com/bproxy/bproxy/pkg/auth"
         "github.com/bproxy/bproxy/pkg/protocol"
+        "github.com/bproxy/bproxy/pkg/schedule"
+        "github.com/bproxy/bproxy/pkg/scope"
         "github.com/bproxy/bproxy/pkg/socks5"
         "github.com/bproxy/bproxy/pkg/topology"
         tlsutil "github.com/bproxy/bproxy/pkg/tls"
         "google.golang.org/protobuf/proto"
 )
 
+var (
+        errNoRoute       = errors.New("no route to agent")
+        errConnectFailed = errors.New("agent connection failed")
+        errIdentity      = errors.New("certificate does not match agent ID")
+        errForeignNode   = errors.New("agent ID belongs to another branch")
+        errUnsupported   = errors.New("feature not supported by agent")
+)
+
 type AgentConnection struct {
         ID      string
         Session *yamux.Session
@@ -25,18 +38,47 @@ type AgentConnection struct {
         mu      sync.Mutex
 }
 
+type socks5Server struct {
+        listener net.Listener
+        agentID  string
+        username string
+        password string
+}
+
 type Admin struct {
-        listener      net.Listener
-        agents        map[string]*AgentConnection
-        topology      *topology.Topology
-        mu            sync.RWMutex
-        tlsConfig     *tls.Config
-        socks5Servers map[int]net.Listener
-        socks5Mu      sync.Mutex
+        listener        net.Listener
+        agents          map[string]*AgentConnection
+        topology        *topology.Topology
+        mu              sync.RWMutex
+        tlsConfig       *tls.Config
+        socks5Servers   map[int]*socks5Server
+        socks5Mu        sync.Mutex
+        forwards        map[string]*PortForward
+        forwardMu       sync.Mutex
+        reverseForwards map[string]*ReverseForward
+        reverseMu       sync.Mutex
+        httpServers     map[int]*httpProxyServer
+        httpMu          sync.Mutex
+        shellListeners  map[string]*ShellListener
+        shellMu         sync.Mutex
+        transfers       map[string]*FileTransfer
+        transferMu      sync.Mutex
+        secret          string
+        nonces          *auth.NonceCache
+        killDate        time.Time
+        workingHours    schedule.Window
+        scope           *scope.Scope
+        audit           *scope.AuditLog
+        routes          []RouteRule
+        defaultRoute    string
+        routeMu         sync.Mutex
 }
 
-func NewAdmin(addr, certFile, keyFile string) (*Admin, error) {
-        tlsConfig, err := tlsutil.GetServerTLSConfig(certFile, keyFile)
+// NewAdmin creates the admin server. If clientCAFile is set, agents must
+// authenticate with a client certificate issued by that CA whose common name
+// is their agent ID.
+func NewAdmin(addr, certFile, keyFile, clientCAFile string) (*Admin, error) {
+        tlsConfig, err := tlsutil.GetServerTLSConfig(certFile, keyFile, clientCAFile)
         if err != nil {
                 return nil, fmt.Errorf("failed to setup TLS: %v", err)
         }
@@ -47,16 +89,38 @@ func NewAdmin(addr, certFile, keyFile string) (*Admin, error) {
         }
 
         return &Admin{
-                listener:      listener,
-                agents:        make(map[string]*AgentConnection),
-                topology:      topology.NewTopology(),
-                tlsConfig:     tlsConfig,
-                socks5Servers: make(map[int]net.Listener),
+                listener:        listener,
+                agents:          make(map[string]*AgentConnection),
+                topology:        topology.NewTopology(),
+                tlsConfig:       tlsConfig,
+                socks5Servers:   make(map[int]*socks5Server),
+                forwards:        make(map[string]*PortForward),
+                reverseForwards: make(map[string]*ReverseForward),
+                httpServers:     make(map[int]*httpProxyServer),
+                shellListeners:  make(map[string]*ShellListener),
+                transfers:       make(map[string]*FileTransfer),
+                nonces:          auth.NewNonceCache(),
         }, nil
 }
 
+// SetRegistrationSecret requires every agent to sign its registration with
+// secret. An empty secret accepts any agent.
+func (a *Admin) SetRegistrationSecret(secret string) {
+        a.secret = secret
+}
+
+// Fingerprint returns the SPKI SHA-256 fingerprint agents should pin.
+func (a *Admin) Fingerprint() string {
+        fingerprint, err := tlsutil.Fingerprint(a.tlsConfig.Certificates[0])
+        if err != nil {
+                return ""
+        }
+        return fingerprint
+}
+
 func (a *Admin) Start() error {
         log.Printf("Admin server listening on %s", a.listener.Addr())
+        log.Printf("Admin certificate fingerprint (SPKI SHA-256): %s", a.Fingerprint())
 
         go a.heartbeatChecker()
 
@@ -74,6 +138,12 @@ func (a *Admin) Start() error {
 func (a *Admin) handleConnection(conn net.Conn) {
         defer conn.Close()
 
+        identity, err := tlsutil.PeerIdentity(conn)
+        if err != nil {
+                log.Printf("TLS handshake with %s failed: %v", conn.RemoteAddr(), err)
+                return
+        }
+
         session, err := yamux.Server(conn, nil)
         if err != nil {
                 log.Printf("Failed to create yamux session: %v", err)
@@ -107,9 +177,26 @@ func (a *Admin) handleConnection(conn net.Conn) {
 
         agentID := regPayload.AgentId
         parentID := regPayload.ParentId
+
+        if err := a.authenticateRegistration(regPayload); err != nil {
+                log.Printf("Rejected registration of agent %s from %s: %v", agentID, conn.RemoteAddr(), err)
+                a.rejectRegistration(stream, msg, agentID)
+                return
+        }
+
+        if err := a.verifyIdentity(identity, agentID); err != nil {
+                log.Printf("Rejected registration of agent %s from %s: %v", agentID, conn.RemoteAddr(), err)
+                a.rejectRegistration(stream, msg, agentID)
+                return
+        }
+
         log.Printf("Agent registered: %s (hostname: %s, IPs: %v, parent: %s)", agentID, regPayload.Hostname, regPayload.LocalIps, parentID)
+        if regPayload.CascadeFingerprint != "" {
+                log.Printf("Agent %s cascade listener fingerprint: %s", agentID, regPayload.CascadeFingerprint)
+        }
 
         a.mu.Lock()
+        previous, reconnected := a.agents[agentID]
         a.agents[agentID] = &AgentConnection{
                 ID:      agentID,
                 Session: session,
@@ -117,7 +204,15 @@ func (a *Admin) handleConnection(conn net.Conn) {
         }
         a.mu.Unlock()
 
+        // The agent restarted before its old connection timed out
+        if reconnected {
+                log.Printf("Agent %s reconnected, closing its previous session", agentID)
+                previous.Session.Close()
+        }
+
         a.topology.AddNode(agentID, regPayload.Hostname, regPayload.LocalIps, regPayload.Os, regPayload.Arch)
+        a.recordProtocol(agentID, regPayload)
+        a.topology.SetNetworks(agentID, regPayload.LocalNetworks)
         
         // If this is a cascaded agent, establish parent-child relationship in topology
         if parentID != "" && parentID != "admin" {
@@ -125,6 +220,7 @@ func (a *Admin) handleConnection(conn net.Conn) {
                         log.Printf("Warning: Failed to add topology edge %s -> %s: %v", parentID, agentID, err)
                 }
         }
+        a.recordLifetime(agentID, regPayload)
 
         ackMsg := &pb.Message{
                 Type:      pb.MessageType_COMMAND,
@@ -145,8 +241,16 @@ func (a *Admin) handleConnection(conn net.Conn) {
 func (a *Admin) handleAgent(agentID string, session *yamux.Session) {
         defer func() {
                 a.mu.Lock()
-                delete(a.agents, agentID)
+                current, exists := a.agents[agentID]
+                replaced := exists && current.Session != session
+                if !replaced {
+                        delete(a.agents, agentID)
+                }
                 a.mu.Unlock()
+
+                if replaced {
+                        return
+                }
                 a.topology.RemoveNode(agentID)
                 log.Printf("Agent disconnected: %s", agentID)
         }()
@@ -171,6 +275,13 @@ func (a *Admin) handleStream(agentID string, stream net.Conn) {
                 return
         }
 
+        // An agent may only speak for itself and its descendants. Cascade
+        // registrations introduce new IDs and are checked separately.
+        if msg.Type != pb.MessageType_REGISTER && msg.SourceId != "" && !a.inSubtree(agentID, msg.SourceId) {
+                log.Printf("Agent %s: dropped %v message claiming to be from %s", agentID, msg.Type, msg.SourceId)
+                return
+        }
+
         switch msg.Type {
         case pb.MessageType_HEARTBEAT:
                 // Get the original sender of the heartbeat (may be a cascaded agent)
@@ -193,21 +304,24 @@ func (a *Admin) handleStream(agentID string, stream net.Conn) {
 
         case pb.MessageType_REGISTER:
                 // Handle cascaded agent registration
-                a.handleCascadeRegister(msg, stream)
+                a.handleCascadeRegister(agentID, msg, stream)
 
         case pb.MessageType_DATA:
                 log.Printf("Data from %s: %d bytes", agentID, len(msg.Payload))
 
         case pb.MessageType_RELAY:
                 log.Printf("Relay message from %s to %s", msg.SourceId, msg.TargetId)
-                a.relayMessage(msg)
+                a.relayStream(msg, stream)
+
+        case pb.MessageType_REVERSE_CONNECT:
+                a.handleReverseConnect(msg, stream)
 
         default:
                 log.Printf("Unknown message type from %s: %v", agentID, msg.Type)
         }
 }
 
-func (a *Admin) handleCascadeRegister(msg *pb.Message, stream net.Conn) {
+func (a *Admin) handleCascadeRegister(agentID string, msg *pb.Message, stream net.Conn) {
         regPayload := &pb.RegisterPayload{}
         if err := proto.Unmarshal(msg.Payload, regPayload); err != nil {
                 log.Printf("Failed to unmarshal cascade register payload: %v", err)
@@ -217,12 +331,29 @@ func (a *Admin) handleCascadeRegister(msg *pb.Message, stream net.Conn) {
         childID := regPayload.AgentId
         parentID := regPayload.ParentId
 
+        if err := a.authenticateRegistration(regPayload); err != nil {
+                log.Printf("Rejected cascade registration of agent %s via parent %s: %v", childID, parentID, err)
+                a.rejectRegistration(stream, msg, childID)
+                return
+        }
+
+        if err := a.verifyCascadeRegistration(agentID, childID, parentID); err != nil {
+                log.Printf("Rejected cascade registration of agent %s via parent %s on %s: %v", childID, parentID, agentID, err)
+                a.rejectRegistration(stream, msg, childID)
+                return
+        }
+
         log.Printf("Cascade agent registered: %s (hostname: %s, parent: %s)", 
                 childID, regPayload.Hostname, parentID)
+        if regPayload.CascadeFingerprint != "" {
+                log.Printf("Agent %s cascade listener fingerprint: %s", childID, regPayload.CascadeFingerprint)
+        }
 
         // Add node to topology
         a.topology.AddNode(childID, regPayload.Hostname, regPayload.LocalIps, 
                 regPayload.Os, regPayload.Arch)
+        a.recordProtocol(childID, regPayload)
+        a.topology.SetNetworks(childID, regPayload.LocalNetworks)
 
         // Establish parent-child relationship
         if parentID != "" && parentID != "admin" {
@@ -231,6 +362,7 @@ func (a *Admin) handleCascadeRegister(msg *pb.Message, stream net.Conn) {
                                 parentID, childID, err)
                 }
         }
+        a.recordLifetime(childID, regPayload)
 
         // Send ACK response
         ackMsg := &pb.Message{
@@ -250,67 +382,274 @@ func (a *Admin) handleCascadeRegister(msg *pb.Message, stream net.Conn) {
         log.Printf("Cascade agent %s registered successfully", childID)
 }
 
-func (a *Admin) relayMessage(msg *pb.Message) error {
+func (a *Admin) authenticateRegistration(regPayload *pb.RegisterPayload) error {
+        if a.secret == "" {
+                return nil
+        }
+        return auth.VerifyRegistration(a.secret, regPayload, a.nonces)
+}
+
+// verifyIdentity binds a direct connection to the common name of its client
+// certificate when mutual TLS is enabled.
+func (a *Admin) verifyIdentity(identity, agentID string) error {
+        if a.tlsConfig.ClientCAs == nil {
+                return nil
+        }
+        if identity == "" || identity != agentID {
+                return fmt.Errorf("%w (certificate %q)", errIdentity, identity)
+        }
+        return nil
+}
+
+// verifyCascadeRegistration checks that a registration relayed over the
+// session of agentID attaches to that agent's subtree and does not take over
+// an ID active elsewhere. Direct agents vouch for the identity of
+// their own descendants.
+func (a *Admin) verifyCascadeRegistration(agentID, childID, parentID string) error {
+        if childID == "" || childID == agentID || !a.inSubtree(agentID, parentID) {
+                return fmt.Errorf("%w: parent %s is not behind %s", errForeignNode, parentID, agentID)
+        }
+
         a.mu.RLock()
-        targetConn, exists := a.agents[msg.TargetId]
+        _, direct := a.agents[childID]
         a.mu.RUnlock()
 
-        if !exists {
-                return fmt.Errorf("target agent %s not found", msg.TargetId)
+        // An inactive node may come back through another branch after a restart
+        node, exists := a.topology.GetNode(childID)
+        if direct || (exists && node.IsActive && !a.inSubtree(agentID, childID)) {
+                return errForeignNode
+        }
+        return nil
+}
+
+// recordProtocol stores the version and capabilities an agent advertised.
+// Agents predating negotiation are assumed to support plain CONNECT only.
+func (a *Admin) recordProtocol(agentID string, regPayload *pb.RegisterPayload) {
+        capabilities := regPayload.Capabilities
+        if regPayload.ProtocolVersion == 0 {
+                capabilities = protocol.LegacyCapabilities
+        }
+        a.topology.SetProtocol(agentID, regPayload.ProtocolVersion, capabilities)
+
+        if regPayload.ProtocolVersion < protocol.Version {
+                log.Printf("Agent %s is outdated (protocol version %d, current %d), capabilities: %v",
+                        agentID, regPayload.ProtocolVersion, protocol.Version, capabilities)
+        }
+}
+
+// requireCapability checks that every agent on the path to targetID
+// advertised capability, since intermediate hops have to forward it too.
+func (a *Admin) requireCapability(targetID, capability string) error {
+        for _, hop := range a.topology.GetPath(targetID) {
+                if !a.topology.HasCapability(hop, capability) {
+                        return fmt.Errorf("%w: agent %s does not advertise %q", errUnsupported, hop, capability)
+                }
+        }
+        return nil
+}
+
+// inSubtree reports whether id is agentID or one of its descendants.
+func (a *Admin) inSubtree(agentID, id string) bool {
+        path := a.topology.GetPath(id)
+        return len(path) > 0 && path[0] == agentID
+}
+
+func (a *Admin) rejectRegistration(stream net.Conn, msg *pb.Message, agentID string) {
+        rejectMsg := &pb.Message{
+                Type:      pb.MessageType_COMMAND,
+                SessionId: msg.SessionId,
+                SourceId:  "admin",
+                TargetId:  agentID,
+                Timestamp: time.Now().Unix(),
+                Payload:   []byte("REJECTED: authentication failed"),
         }
+        if err := protocol.WriteMessage(stream, rejectMsg); err != nil {
+                log.Printf("Failed to send registration rejection: %v", err)
+        }
+}
 
-        stream, err := targetConn.Session.OpenStream()
+// relayStream passes a message from one agent to another and keeps both
+// streams joined so the target can answer.
+func (a *Admin) relayStream(msg *pb.Message, stream net.Conn) {
+        targetStream, err := a.openStream(msg.TargetId)
         if err != nil {
-                return fmt.Errorf("failed to open stream to target: %v", err)
+                log.Printf("Failed to open relay stream to %s: %v", msg.TargetId, err)
+                return
+        }
+        defer targetStream.Close()
+
+        if err := protocol.WriteMessage(targetStream, msg); err != nil {
+                log.Printf("Failed to relay message to %s: %v", msg.TargetId, err)
+                return
         }
-        defer stream.Close()
 
-        return protocol.WriteMessage(stream, msg)
+        splice(targetStream, stream)
 }
 
-func (a *Admin) SendCommand(targetID string, cmd *pb.CommandPayload) error {
+func (a *Admin) openStream(targetID string) (net.Conn, error) {
         path := a.topology.GetPath(targetID)
         if len(path) == 0 {
-                return fmt.Errorf("no path to target %s", targetID)
+                return nil, fmt.Errorf("%w: no path to target %s", errNoRoute, targetID)
         }
 
-        payload, err := proto.Marshal(cmd)
+        a.mu.RLock()
+        agentConn, exists := a.agents[path[0]]
+        a.mu.RUnlock()
+
+        if !exists {
+                return nil, fmt.Errorf("%w: first hop agent %s not connected", errNoRoute, path[0])
+        }
+
+        return agentConn.Session.OpenStream()
+}
+
+// dialThroughAgent asks targetID to open a TCP connection to host:port and
+// returns the stream carrying it, together with the agent's result, once the
+// agent reports success. A failure reported by any hop is a *connectError, as
+// is a destination outside the scope; source identifies the client for the
+// audit log.
+func (a *Admin) dialThroughAgent(source, targetID, host string, port int) (net.Conn, *pb.ConnectResult, error) {
+        if err := a.checkScope(source, targetID, host, port); err != nil {
+                return nil, nil, err
+        }
+
+        // Relays inspect the reply, so every hop in front of a target that
+        // answers with a ConnectResult has to understand it as well
+        capability := protocol.CapConnect
+        if a.topology.HasCapability(targetID, protocol.CapConnectResult) {
+                capability = protocol.CapConnectResult
+        }
+        if err := a.requireCapability(targetID, capability); err != nil {
+                return nil, nil, err
+        }
+
+        stream, err := a.openStream(targetID)
         if err != nil {
-                return err
+                return nil, nil, err
+        }
+
+        connectPayload := &pb.ConnectPayload{
+                TargetAgentId: targetID,
+                TargetAddress: host,
+                TargetPort:    int32(port),
+        }
+
+        payload, err := proto.Marshal(connectPayload)
+        if err != nil {
+                stream.Close()
+                return nil, nil, fmt.Errorf("failed to marshal connect payload: %v", err)
         }
 
         msg := &pb.Message{
-                Type:      pb.MessageType_COMMAND,
-                SessionId: fmt.Sprintf("cmd-%d", time.Now().UnixNano()),
+                Type:      pb.MessageType_CONNECT,
+                SessionId: fmt.Sprintf("connect-%d", time.Now().UnixNano()),
                 SourceId:  "admin",
                 TargetId:  targetID,
                 Timestamp: time.Now().Unix(),
                 Payload:   payload,
         }
 
-        if len(path) == 1 {
-                return a.sendDirectMessage(targetID, msg)
+        if err := protocol.WriteMessage(stream, msg); err != nil {
+                stream.Close()
+                return nil, nil, fmt.Errorf("failed to send connect message: %v", err)
+        }
+
+        response, err := protocol.ReadMessage(stream)
+        if err != nil {
+                stream.Close()
+                return nil, nil, fmt.Errorf("failed to read connect response: %v", err)
         }
 
-        return a.relayMessage(msg)
+        result, err := protocol.ParseConnectResponse(response)
+        if err != nil {
+                stream.Close()
+                return nil, nil, fmt.Errorf("failed to parse connect response: %v", err)
+        }
+        if result.Error != pb.ConnectError_CONNECT_OK {
+                stream.Close()
+                a.auditRefusal(source, targetID, host, port, result)
+                return nil, nil, &connectError{result: result}
+        }
+
+        return stream, result, nil
 }
 
-func (a *Admin) sendDirectMessage(agentID string, msg *pb.Message) error {
-        a.mu.RLock()
-        agentConn, exists := a.agents[agentID]
-        a.mu.RUnlock()
+// connectError carries the result of a CONNECT that an agent on the path
+// reported as failed.
+type connectError struct {
+        result *pb.ConnectResult
+}
 
-        if !exists {
-                return fmt.Errorf("agent %s not connected", agentID)
+func (e *connectError) Error() string {
+        return fmt.Sprintf("%v at agent %s: %s", e.result.Error, e.result.FailedHop, e.result.Message)
+}
+
+func (e *connectError) Unwrap() error {
+        return errConnectFailed
+}
+
+// failedResponse is the *connectError for a reply that an agent sent in
+// place of the expected one, such as a failed BIND or REVERSE_LISTEN.
+func failedResponse(response *pb.Message) *connectError {
+        result, err := protocol.ParseConnectResponse(response)
+        if err != nil {
+                result = &pb.ConnectResult{FailedHop: response.SourceId, Message: err.Error()}
+        }
+        if result.Error == pb.ConnectError_CONNECT_OK {
+                result.Error = pb.ConnectError_CONNECT_GENERAL_FAILURE
+        }
+        return &connectError{result: result}
+}
+
+// socks5Reply maps a dialThroughAgent error to a SOCKS5 reply code.
+func socks5Reply(err error) byte {
+        var connErr *connectError
+        switch {
+        case errors.Is(err, errNoRoute):
+                return socks5.ReplyHostUnreachable
+        case errors.Is(err, errUnsupported):
+                return socks5.ReplyCommandNotSupported
+        case errors.As(err, &connErr):
+                switch connErr.result.Error {
+                case pb.ConnectError_CONNECT_NOT_ALLOWED:
+                        return socks5.ReplyConnectionNotAllowed
+                case pb.ConnectError_CONNECT_NETWORK_UNREACHABLE, pb.ConnectError_CONNECT_NO_ROUTE:
+                        return socks5.ReplyNetworkUnreachable
+                case pb.ConnectError_CONNECT_HOST_UNREACHABLE, pb.ConnectError_CONNECT_DNS_FAILURE, pb.ConnectError_CONNECT_TIMEOUT:
+                        return socks5.ReplyHostUnreachable
+                case pb.ConnectError_CONNECT_REFUSED:
+                        return socks5.ReplyConnectionRefused
+                }
+        }
+        return socks5.ReplyGeneralFailure
+}
+
+// OpenTunnel opens an L3 packet tunnel to targetID. Each IP packet travels
+// as a DATA message carrying a DataPayload, in both directions.
+func (a *Admin) OpenTunnel(targetID string) (net.Conn, error) {
+        if err := a.requireCapability(targetID, protocol.CapTunnel); err != nil {
+                return nil, err
         }
 
-        stream, err := agentConn.Session.OpenStream()
+        stream, err := a.openStream(targetID)
         if err != nil {
-                return err
+                return nil, err
+        }
+
+        msg := &pb.Message{
+                Type:      pb.MessageType_TUNNEL,
+                SessionId: fmt.Sprintf("tun-%d", time.Now().UnixNano()),
+                SourceId:  "admin",
+                TargetId:  targetID,
+                Timestamp: time.Now().Unix(),
+        }
+
+        if err := protocol.WriteMessage(stream, msg); err != nil {
+                stream.Close()
+                return nil, fmt.Errorf("failed to send tunnel request: %v", err)
         }
-        defer stream.Close()
 
-        return protocol.WriteMessage(stream, msg)
+        return stream, nil
 }
 
 func (a *Admin) heartbeatChecker() {
@@ -348,14 +687,45 @@ func (a *Admin) GetAgents() map[string]*AgentConnection {
 
 func (a *Admin) Close() error {
         a.socks5Mu.Lock()
-        for _, listener := range a.socks5Servers {
-                listener.Close()
+        for _, server := range a.socks5Servers {
+                server.listener.Close()
         }
         a.socks5Mu.Unlock()
+
+        a.forwardMu.Lock()
+        for _, fwd := range a.forwards {
+                fwd.listener.Close()
+        }
+        a.forwardMu.Unlock()
+
+        a.reverseMu.Lock()
+        for _, fwd := range a.reverseForwards {
+                fwd.stream.Close()
+        }
+        a.reverseMu.Unlock()
+
+        a.httpMu.Lock()
+        for _, server := range a.httpServers {
+                server.listener.Close()
+        }
+        a.httpMu.Unlock()
+
+        a.shellMu.Lock()
+        for _, sl := range a.shellListeners {
+                sl.listener.Close()
+        }
+        a.shellMu.Unlock()
         return a.listener.Close()
 }
 
 func (a *Admin) StartSocks5(port int, targetID string) error {
+        return a.StartSocks5WithAuth(port, targetID, "", "")
+}
+
+// StartSocks5WithAuth starts a SOCKS5 proxy that requires username/password
+// authentication (RFC 1929) when username is not empty. An empty targetID
+// picks the agent for every request with Route.
+func (a *Admin) StartSocks5WithAuth(port int, targetID, username, password string) error {
         a.socks5Mu.Lock()
         if _, exists := a.socks5Servers[port]; exists {
                 a.socks5Mu.Unlock()
@@ -368,16 +738,29 @@ func (a *Admin) StartSocks5(port int, targetID string) error {
                 return fmt.Errorf("failed to start SOCKS5 listener: %v", err)
         }
 
+        server := &socks5Server{
+                listener: listener,
+                agentID:  targetID,
+                username: username,
+                password: password,
+        }
+
         a.socks5Mu.Lock()
-        a.socks5Servers[port] = listener
+        a.socks5Servers[port] = server
         a.socks5Mu.Unlock()
 
-        log.Printf("SOCKS5 proxy started on 127.0.0.1:%d -> agent %s", port, targetID)
+        if targetID == "" {
+                log.Printf("SOCKS5 proxy started on 127.0.0.1:%d with rule-based routing", port)
+        } else {
+                log.Printf("SOCKS5 proxy started on 127.0.0.1:%d -> agent %s", port, targetID)
+        }
 
         go func() {
                 defer func() {
                         a.socks5Mu.Lock()
-                        delete(a.socks5Servers, port)
+                        if a.socks5Servers[port] == server {
+                                delete(a.socks5Servers, port)
+                        }
                         a.socks5Mu.Unlock()
                         listener.Close()
                 }()
@@ -389,7 +772,7 @@ func (a *Admin) StartSocks5(port int, targetID string) error {
                                 return
                         }
 
-                        go a.handleSocks5Connection(conn, targetID)
+                        go a.handleSocks5Connection(conn, server)
                 }
         }()
 
@@ -398,7 +781,7 @@ func (a *Admin) StartSocks5(port int, targetID string) error {
 
 func (a *Admin) StopSocks5(port int) error {
         a.socks5Mu.Lock()
-        listener, exists := a.socks5Servers[port]
+        server, exists := a.socks5Servers[port]
         if !exists {
                 a.socks5Mu.Unlock()
                 return fmt.Errorf("no SOCKS5 server running on port %d", port)
@@ -406,14 +789,25 @@ func (a *Admin) StopSocks5(port int) error {
         delete(a.socks5Servers, port)
         a.socks5Mu.Unlock()
 
-        return listener.Close()
+        return server.listener.Close()
 }
 
-func (a *Admin) handleSocks5Connection(clientConn net.Conn, targetID string) {
+func (a *Admin) handleSocks5Connection(clientConn net.Conn, server *socks5Server) {
         defer clientConn.Close()
 
-        if err := socks5.HandleSocks5Handshake(clientConn); err != nil {
-                log.Printf("SOCKS5 handshake failed: %v", err)
+        // SOCKS4 and SOCKS4a clients are served on the same listener
+        clientConn, version, err := socks5.PeekVersion(clientConn)
+        if err != nil {
+                log.Printf("SOCKS handshake failed: %v", err)
+                return
+        }
+        if version == socks5.Socks4Version {
+                a.handleSocks4Connection(clientConn, server)
+                return
+        }
+
+        if err := socks5.HandleSocks5HandshakeWithAuth(clientConn, server.username, server.password); err != nil {
+                log.Printf("SOCKS5 handshake with %s failed: %v", clientConn.RemoteAddr(), err)
                 return
         }
 
@@ -424,99 +818,324 @@ func (a *Admin) handleSocks5Connection(clientConn net.Conn, targetID string) {
                 return
         }
 
+        // Datagrams of one association may go anywhere, so they cannot be routed
+        if req.Command == socks5.UDPAssociateCmd && server.agentID == "" {
+                log.Printf("SOCKS5 UDP ASSOCIATE refused on routed listener")
+                socks5.SendReply(clientConn, socks5.ReplyCommandNotSupported)
+                return
+        }
+
+        targetID, err := a.socks5Target(server, req.DstAddr)
+        if err != nil {
+                log.Printf("SOCKS5 request for %s:%d not routed: %v", req.DstAddr, req.DstPort, err)
+                socks5.SendReply(clientConn, socks5Reply(err))
+                return
+        }
+
         log.Printf("SOCKS5 request: %s:%d via agent %s", req.DstAddr, req.DstPort, targetID)
 
-        // Get the path to the target agent using topology
-        path := a.topology.GetPath(targetID)
-        if len(path) == 0 {
-                log.Printf("No path to target agent %s", targetID)
-                socks5.SendReply(clientConn, socks5.ReplyHostUnreachable)
+        switch req.Command {
+        case socks5.UDPAssociateCmd:
+                a.handleSocks5UDP(clientConn, targetID)
+                return
+        case socks5.BindCmd:
+                a.handleSocks5Bind(clientConn, req, targetID)
                 return
         }
 
-        // The first hop is always the direct connection
-        firstHop := path[0]
-        
-        a.mu.RLock()
-        agentConn, exists := a.agents[firstHop]
-        a.mu.RUnlock()
+        stream, result, err := a.dialThroughAgent(clientConn.RemoteAddr().String(), targetID, req.DstAddr, int(req.DstPort))
+        if err != nil {
+                log.Printf("SOCKS5 connect to %s:%d via agent %s failed: %v", req.DstAddr, req.DstPort, targetID, err)
+                socks5.SendReply(clientConn, socks5Reply(err))
+                return
+        }
+        defer stream.Close()
 
-        if !exists {
-                log.Printf("First hop agent %s not found", firstHop)
-                socks5.SendReply(clientConn, socks5.ReplyHostUnreachable)
+        // The address the target agent bound for the outbound connection
+        if err := socks5.SendReplyHost(clientConn, socks5.ReplySuccess, result.BoundAddress, uint16(result.BoundPort)); err != nil {
+                log.Printf("Failed to send SOCKS5 success reply: %v", err)
                 return
         }
 
-        stream, err := agentConn.Session.OpenStream()
+        log.Printf("SOCKS5 tunnel established: %s:%d via path %v (bound %s)", req.DstAddr, req.DstPort, a.topology.GetPath(targetID),
+                net.JoinHostPort(result.BoundAddress, fmt.Sprint(result.BoundPort)))
+
+        splice(stream, clientConn)
+        log.Printf("SOCKS5 tunnel closed: %s:%d", req.DstAddr, req.DstPort)
+}
+
+// socks5Target returns the agent serving host on server, looking it up in
+// the route table for listeners started with StartRoutedSocks5.
+func (a *Admin) socks5Target(server *socks5Server, host string) (string, error) {
+        if server.agentID != "" {
+                return server.agentID, nil
+        }
+        return a.Route(host)
+}
+
+// handleSocks4Connection serves a SOCKS4 or SOCKS4a CONNECT through the same
+// agent CONNECT path as SOCKS5. SOCKS4 has no password, so listeners that
+// require authentication refuse it.
+func (a *Admin) handleSocks4Connection(clientConn net.Conn, server *socks5Server) {
+        req, err := socks5.ParseSocks4Request(clientConn)
         if err != nil {
-                log.Printf("Failed to open stream to agent: %v", err)
-                socks5.SendReply(clientConn, socks5.ReplyGeneralFailure)
+                log.Printf("SOCKS4 parse request failed: %v", err)
+                socks5.SendSocks4Reply(clientConn, socks5.Socks4Rejected)
+                return
+        }
+
+        if server.username != "" {
+                log.Printf("SOCKS4 request from %s refused: listener requires authentication", clientConn.RemoteAddr())
+                socks5.SendSocks4Reply(clientConn, socks5.Socks4Rejected)
+                return
+        }
+
+        if req.Command != socks5.ConnectCmd {
+                log.Printf("SOCKS4 command %d from %s not supported", req.Command, clientConn.RemoteAddr())
+                socks5.SendSocks4Reply(clientConn, socks5.Socks4Rejected)
+                return
+        }
+
+        targetID, err := a.socks5Target(server, req.DstAddr)
+        if err != nil {
+                log.Printf("SOCKS4 request for %s:%d not routed: %v", req.DstAddr, req.DstPort, err)
+                socks5.SendSocks4Reply(clientConn, socks5.Socks4Rejected)
+                return
+        }
+
+        log.Printf("SOCKS4 request: %s:%d via agent %s", req.DstAddr, req.DstPort, targetID)
+
+        stream, _, err := a.dialThroughAgent(clientConn.RemoteAddr().String(), targetID, req.DstAddr, int(req.DstPort))
+        if err != nil {
+                log.Printf("SOCKS4 connect to %s:%d via agent %s failed: %v", req.DstAddr, req.DstPort, targetID, err)
+                socks5.SendSocks4Reply(clientConn, socks5.Socks4Rejected)
                 return
         }
         defer stream.Close()
 
-        connectPayload := &pb.ConnectPayload{
-                TargetAgentId: targetID,
-                TargetAddress: req.DstAddr,
-                TargetPort:    int32(req.DstPort),
+        if err := socks5.SendSocks4Reply(clientConn, socks5.Socks4Granted); err != nil {
+                log.Printf("Failed to send SOCKS4 reply: %v", err)
+                return
         }
 
-        payload, err := proto.Marshal(connectPayload)
+        log.Printf("SOCKS4 tunnel established: %s:%d via path %v", req.DstAddr, req.DstPort, a.topology.GetPath(targetID))
+
+        splice(stream, clientConn)
+        log.Printf("SOCKS4 tunnel closed: %s:%d", req.DstAddr, req.DstPort)
+}
+
+// handleSocks5UDP serves a UDP ASSOCIATE request. Datagrams from the client
+// are relayed to targetID as UDP messages over a single stream, and replies
+// are wrapped in a SOCKS5 UDP header before being sent back.
+func (a *Admin) handleSocks5UDP(clientConn net.Conn, targetID string) {
+        if err := a.requireCapability(targetID, protocol.CapUDP); err != nil {
+                log.Printf("SOCKS5 UDP ASSOCIATE via agent %s refused: %v", targetID, err)
+                socks5.SendReply(clientConn, socks5.ReplyCommandNotSupported)
+                return
+        }
+
+        localAddr := clientConn.LocalAddr().(*net.TCPAddr)
+        relayConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: localAddr.IP})
         if err != nil {
-                log.Printf("Failed to marshal connect payload: %v", err)
+                log.Printf("Failed to start UDP relay: %v", err)
                 socks5.SendReply(clientConn, socks5.ReplyGeneralFailure)
                 return
         }
+        defer relayConn.Close()
+
+        stream, err := a.openStream(targetID)
+        if err != nil {
+                log.Printf("Failed to open UDP stream to agent %s: %v", targetID, err)
+                socks5.SendReply(clientConn, socks5.ReplyHostUnreachable)
+                return
+        }
+        defer stream.Close()
 
+        sessionID := fmt.Sprintf("udp-%d", time.Now().UnixNano())
         msg := &pb.Message{
-                Type:      pb.MessageType_CONNECT,
-                SessionId: fmt.Sprintf("socks5-%d", time.Now().UnixNano()),
+                Type:      pb.MessageType_UDP,
+                SessionId: sessionID,
                 SourceId:  "admin",
                 TargetId:  targetID,
                 Timestamp: time.Now().Unix(),
-                Payload:   payload,
         }
 
         if err := protocol.WriteMessage(stream, msg); err != nil {
-                log.Printf("Failed to send connect message: %v", err)
+                log.Printf("Failed to send UDP associate message: %v", err)
                 socks5.SendReply(clientConn, socks5.ReplyGeneralFailure)
                 return
         }
 
-        response, err := protocol.ReadMessage(stream)
+        if err := socks5.SendReplyAddr(clientConn, socks5.ReplySuccess, relayConn.LocalAddr()); err != nil {
+                log.Printf("Failed to send SOCKS5 success reply: %v", err)
+                return
+        }
+
+        log.Printf("SOCKS5 UDP relay %s -> agent %s", relayConn.LocalAddr(), targetID)
+
+        clientIP := clientConn.RemoteAddr().(*net.TCPAddr).IP
+        var clientAddr atomic.Pointer[net.UDPAddr]
+
+        go func() {
+                buf := make([]byte, 65535)
+                for {
+                        n, addr, err := relayConn.ReadFromUDP(buf)
+                        if err != nil {
+                                return
+                        }
+
+                        // Only the client that opened the association may use the relay
+                        if !addr.IP.Equal(clientIP) {
+                                continue
+                        }
+                        clientAddr.Store(addr)
+
+                        datagram, err := socks5.ParseUDPDatagram(buf[:n])
+                        if err != nil || datagram.Frag != 0 {
+                                continue
+                        }
+
+                        if !a.InScope(addr.String(), targetID, "udp", datagram.DstAddr, int(datagram.DstPort)) {
+                                continue
+                        }
+
+                        payload, err := proto.Marshal(&pb.UdpPayload{
+                                Address: datagram.DstAddr,
+                                Port:    int32(datagram.DstPort),
+                                Data:    datagram.Data,
+                        })
+                        if err != nil {
+                                continue
+                        }
+
+                        if err := protocol.WriteMessage(stream, &pb.Message{
+                                Type:      pb.MessageType_UDP,
+                                SessionId: sessionID,
+                                SourceId:  "admin",
+                                TargetId:  targetID,
+                                Timestamp: time.Now().Unix(),
+                                Payload:   payload,
+                        }); err != nil {
+                                log.Printf("Failed to relay UDP datagram: %v", err)
+                                return
+                        }
+                }
+        }()
+
+        go func() {
+                defer clientConn.Close()
+                for {
+                        response, err := protocol.ReadMessage(stream)
+                        if err != nil {
+                                return
+                        }
+
+                        udpPayload := &pb.UdpPayload{}
+                        if response.Type != pb.MessageType_UDP || proto.Unmarshal(response.Payload, udpPayload) != nil {
+                                continue
+                        }
+
+                        addr := clientAddr.Load()
+                        if addr == nil {
+                                continue
+                        }
+
+                        datagram := socks5.BuildUDPDatagram(udpPayload.Address, uint16(udpPayload.Port), udpPayload.Data)
+                        relayConn.WriteToUDP(datagram, addr)
+                }
+        }()
+
+        // The association lives as long as the TCP control connection
+        io.Copy(io.Discard, clientConn)
+        log.Printf("SOCKS5 UDP association closed: %s", relayConn.LocalAddr())
+}
+
+// handleSocks5Bind serves a BIND request by asking targetID to listen. The
+// first reply carries the agent's listening address, the second one the
+// address of the peer that connected to it.
+func (a *Admin) handleSocks5Bind(clientConn net.Conn, req *socks5.Request, targetID string) {
+        if err := a.requireCapability(targetID, protocol.CapBind); err != nil {
+                log.Printf("SOCKS5 BIND via agent %s refused: %v", targetID, err)
+                socks5.SendReply(clientConn, socks5.ReplyCommandNotSupported)
+                return
+        }
+
+        // Clients that do not know the peer yet send an unspecified address
+        if ip := net.ParseIP(req.DstAddr); ip == nil || !ip.IsUnspecified() {
+                if !a.InScope(clientConn.RemoteAddr().String(), targetID, "tcp", req.DstAddr, int(req.DstPort)) {
+                        socks5.SendReply(clientConn, socks5.ReplyConnectionNotAllowed)
+                        return
+                }
+        }
+
+        stream, err := a.openStream(targetID)
         if err != nil {
-                log.Printf("Failed to read connect response: %v", err)
-                socks5.SendReply(clientConn, socks5.ReplyGeneralFailure)
+                log.Printf("Failed to open BIND stream to agent %s: %v", targetID, err)
+                socks5.SendReply(clientConn, socks5.ReplyHostUnreachable)
                 return
         }
+        defer stream.Close()
 
-        if response.Type != pb.MessageType_DATA || string(response.Payload) != "Connected" {
-                log.Printf("Agent connection failed")
-                socks5.SendReply(clientConn, socks5.ReplyConnectionRefused)
+        payload, err := proto.Marshal(&pb.ConnectPayload{
+                TargetAgentId: targetID,
+                TargetAddress: req.DstAddr,
+                TargetPort:    int32(req.DstPort),
+        })
+        if err != nil {
+                log.Printf("Failed to marshal bind payload: %v", err)
+                socks5.SendReply(clientConn, socks5.ReplyGeneralFailure)
                 return
         }
 
-        if err := socks5.SendReply(clientConn, socks5.ReplySuccess); err != nil {
-                log.Printf("Failed to send SOCKS5 success reply: %v", err)
+        msg := &pb.Message{
+                Type:      pb.MessageType_BIND,
+                SessionId: fmt.Sprintf("bind-%d", time.Now().UnixNano()),
+                SourceId:  "admin",
+                TargetId:  targetID,
+                Timestamp: time.Now().Unix(),
+                Payload:   payload,
+        }
+
+        if err := protocol.WriteMessage(stream, msg); err != nil {
+                log.Printf("Failed to send bind message: %v", err)
+                socks5.SendReply(clientConn, socks5.ReplyGeneralFailure)
                 return
         }
 
-        log.Printf("SOCKS5 tunnel established: %s:%d via path %v", req.DstAddr, req.DstPort, path)
+        for _, stage := range []string{"listening on", "accepted connection from"} {
+                response, err := protocol.ReadMessage(stream)
+                if err != nil {
+                        log.Printf("Failed to read bind response: %v", err)
+                        socks5.SendReply(clientConn, socks5.ReplyGeneralFailure)
+                        return
+                }
 
-        errChan := make(chan error, 2)
+                if response.Type != pb.MessageType_BIND {
+                        connErr := failedResponse(response)
+                        log.Printf("SOCKS5 BIND via agent %s failed: %v", targetID, connErr)
+                        a.auditRefusal(clientConn.RemoteAddr().String(), targetID, req.DstAddr, int(req.DstPort), connErr.result)
+                        socks5.SendReply(clientConn, socks5Reply(connErr))
+                        return
+                }
 
-        go func() {
-                _, err := io.Copy(stream, clientConn)
-                errChan <- err
-        }()
+                bindPayload := &pb.BindPayload{}
+                if err := proto.Unmarshal(response.Payload, bindPayload); err != nil {
+                        log.Printf("Failed to unmarshal bind response: %v", err)
+                        socks5.SendReply(clientConn, socks5.ReplyGeneralFailure)
+                        return
+                }
 
-        go func() {
-                _, err := io.Copy(clientConn, stream)
-                errChan <- err
-        }()
+                boundAddr := net.JoinHostPort(bindPayload.Address, fmt.Sprint(bindPayload.Port))
+                log.Printf("SOCKS5 BIND via agent %s: %s %s", targetID, stage, boundAddr)
 
-        <-errChan
-        log.Printf("SOCKS5 tunnel closed: %s:%d", req.DstAddr, req.DstPort)
+                if err := socks5.SendReplyHost(clientConn, socks5.ReplySuccess, bindPayload.Address, uint16(bindPayload.Port)); err != nil {
+                        log.Printf("Failed to send SOCKS5 bind reply: %v", err)
+                        return
+                }
+        }
+
+        splice(stream, clientConn)
+        log.Printf("SOCKS5 BIND tunnel closed via agent %s", targetID)
 }
 
 func (a *Admin) GetSocks5Servers() map[int]string {
@@ -524,8 +1143,28 @@ func (a *Admin) GetSocks5Servers() map[int]string {
         defer a.socks5Mu.Unlock()
 
         servers := make(map[int]string)
-        for port := range a.socks5Servers {
+        for port, server := range a.socks5Servers {
                 servers[port] = fmt.Sprintf("127.0.0.1:%d", port)
+                if server.agentID == "" {
+                        servers[port] += " (routed)"
+                }
         }
         return servers
+}
+
+// splice copies data between two connections until either side closes.
+func splice(left, right net.Conn) {
+        errChan := make(chan error, 2)
+
+        go func() {
+                _, err := io.Copy(left, right)
+                errChan <- err
+        }()
+
+        go func() {
+                _, err := io.Copy(right, left)
+                errChan <- err
+        }()
+
+        <-errChan
 }
\ No newline at end of file
@@ -0,0 +1,94 @@
+package admin
+
+import (
+        "errors"
+        "fmt"
+        "net"
+        "time"
+
+        "github.com/google/uuid"
+        pb "github.com/bproxy/bproxy/proto"
+        "github.com/bproxy/bproxy/pkg/protocol"
+        "google.golang.org/protobuf/proto"
+)
+
+const (
+        defaultCommandTimeout = 30 * time.Second
+        // commandGrace leaves the agent time to report its own timeout before
+        // the admin gives up on the stream.
+        commandGrace = 5 * time.Second
+)
+
+var errCommandTimeout = errors.New("no command response")
+
+// SendCommand runs cmd on targetID, relayed through its parents if needed,
+// and waits up to timeout for the response. A zero timeout uses the default.
+func (a *Admin) SendCommand(targetID string, cmd *pb.CommandPayload, timeout time.Duration) (*pb.CommandResponse, error) {
+        if err := a.requireCapability(targetID, protocol.CapCommand); err != nil {
+                return nil, err
+        }
+
+        if timeout <= 0 {
+                timeout = defaultCommandTimeout
+        }
+
+        request := proto.Clone(cmd).(*pb.CommandPayload)
+        if request.RequestId == "" {
+                request.RequestId = uuid.New().String()
+        }
+        request.TimeoutMs = timeout.Milliseconds()
+
+        payload, err := proto.Marshal(request)
+        if err != nil {
+                return nil, err
+        }
+
+        stream, err := a.openStream(targetID)
+        if err != nil {
+                return nil, err
+        }
+        defer stream.Close()
+
+        stream.SetDeadline(time.Now().Add(timeout + commandGrace))
+
+        msg := &pb.Message{
+                Type:      pb.MessageType_COMMAND,
+                SessionId: request.RequestId,
+                SourceId:  "admin",
+                TargetId:  targetID,
+                Timestamp: time.Now().Unix(),
+                Payload:   payload,
+        }
+
+        if err := protocol.WriteMessage(stream, msg); err != nil {
+                return nil, fmt.Errorf("failed to send command: %v", err)
+        }
+
+        response, err := protocol.ReadMessage(stream)
+        if err != nil {
+                var netErr net.Error
+                if errors.As(err, &netErr) && netErr.Timeout() {
+                        return nil, fmt.Errorf("%w from %s within %v", errCommandTimeout, targetID, timeout+commandGrace)
+                }
+                return nil, fmt.Errorf("failed to read command response: %v", err)
+        }
+
+        if response.Type != pb.MessageType_COMMAND_RESPONSE {
+                return nil, fmt.Errorf("unexpected %v response to command", response.Type)
+        }
+
+        result := &pb.CommandResponse{}
+        if err := proto.Unmarshal(response.Payload, result); err != nil {
+                return nil, fmt.Errorf("failed to unmarshal command response: %v", err)
+        }
+        if result.RequestId != request.RequestId {
+                return nil, fmt.Errorf("command response for request %s, expected %s", result.RequestId, request.RequestId)
+        }
+
+        return result, nil
+}
+
+// RunCommand is a shorthand for SendCommand with the default timeout.
+func (a *Admin) RunCommand(targetID, command string, args ...string) (*pb.CommandResponse, error) {
+        return a.SendCommand(targetID, &pb.CommandPayload{Command: command, Args: args}, 0)
+}
@@ -0,0 +1,143 @@
+package admin
+
+import (
+        "errors"
+        "fmt"
+        "net"
+        "sync"
+        "time"
+
+        "github.com/google/uuid"
+        pb "github.com/bproxy/bproxy/proto"
+        "github.com/bproxy/bproxy/pkg/protocol"
+        "google.golang.org/protobuf/proto"
+)
+
+// ExecSession is a process started on an agent with Exec. Output carries
+// its stdout and stderr as they arrive and is closed when the process has
+// exited; it must be drained for the session to make progress.
+type ExecSession struct {
+        ID      string
+        AgentID string
+        Argv    []string
+        Output  <-chan *pb.ExecOutput
+
+        stream   net.Conn
+        writeMu  sync.Mutex
+        done     chan struct{}
+        exitCode int32
+        err      error
+}
+
+// Exec runs argv on agentID with env added to the agent's environment.
+func (a *Admin) Exec(agentID string, argv []string, env map[string]string) (*ExecSession, error) {
+        if len(argv) == 0 {
+                return nil, fmt.Errorf("empty command")
+        }
+        if err := a.requireCapability(agentID, protocol.CapExec); err != nil {
+                return nil, err
+        }
+
+        id := uuid.New().String()
+        payload, err := proto.Marshal(&pb.CommandPayload{
+                Command:   argv[0],
+                Args:      argv[1:],
+                Env:       env,
+                RequestId: id,
+        })
+        if err != nil {
+                return nil, err
+        }
+
+        stream, err := a.openStream(agentID)
+        if err != nil {
+                return nil, err
+        }
+
+        msg := &pb.Message{
+                Type:      pb.MessageType_EXEC,
+                SessionId: id,
+                SourceId:  "admin",
+                TargetId:  agentID,
+                Timestamp: time.Now().Unix(),
+                Payload:   payload,
+        }
+
+        if err := protocol.WriteMessage(stream, msg); err != nil {
+                stream.Close()
+                return nil, fmt.Errorf("failed to send exec request: %v", err)
+        }
+
+        output := make(chan *pb.ExecOutput, 64)
+        session := &ExecSession{
+                ID:      id,
+                AgentID: agentID,
+                Argv:    argv,
+                Output:  output,
+                stream:  stream,
+                done:    make(chan struct{}),
+        }
+
+        go session.readLoop(output)
+
+        return session, nil
+}
+
+func (s *ExecSession) readLoop(output chan<- *pb.ExecOutput) {
+        defer close(output)
+        defer close(s.done)
+        defer s.stream.Close()
+
+        for {
+                msg, err := protocol.ReadMessage(s.stream)
+                if err != nil {
+                        s.exitCode = -1
+                        s.err = fmt.Errorf("exec stream closed: %v", err)
+                        return
+                }
+
+                frame := &pb.ExecOutput{}
+                if err := proto.Unmarshal(msg.Payload, frame); err != nil {
+                        s.exitCode = -1
+                        s.err = fmt.Errorf("failed to unmarshal exec output: %v", err)
+                        return
+                }
+
+                if frame.Stream == pb.ExecStream_EXEC_EXIT {
+                        s.exitCode = frame.ExitCode
+                        if frame.Error != "" {
+                                s.err = errors.New(frame.Error)
+                        }
+                        return
+                }
+
+                output <- frame
+        }
+}
+
+// Cancel asks the agent to kill the process. Wait still reports the exit.
+func (s *ExecSession) Cancel() error {
+        payload, err := proto.Marshal(&pb.ExecControl{Cancel: true})
+        if err != nil {
+                return err
+        }
+
+        s.writeMu.Lock()
+        defer s.writeMu.Unlock()
+        return protocol.WriteMessage(s.stream, &pb.Message{
+                Type:      pb.MessageType_EXEC,
+                SessionId: s.ID,
+                SourceId:  "admin",
+                TargetId:  s.AgentID,
+                Timestamp: time.Now().Unix(),
+                Payload:   payload,
+        })
+}
+
+// Wait blocks until the process has exited and returns its exit code. The
+// error is set if the process could not be started, was cancelled or the
+// connection to the agent was lost.
+func (s *ExecSession) Wait() (int32, error) {
+        <-s.done
+        return s.exitCode, s.err
+}
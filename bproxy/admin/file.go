@@ -0,0 +1,400 @@
+package admin
+
+import (
+        "errors"
+        "fmt"
+        "io"
+        "log"
+        "net"
+        "os"
+        "sort"
+        "sync"
+        "time"
+
+        "github.com/google/uuid"
+        pb "github.com/bproxy/bproxy/proto"
+        "github.com/bproxy/bproxy/pkg/protocol"
+        "google.golang.org/protobuf/proto"
+)
+
+var errChecksum = errors.New("checksum mismatch")
+
+// FileTransfer is an upload to or a download from an agent. Running an
+// interrupted transfer again with the same paths resumes from the partial
+// file the previous attempt left behind.
+type FileTransfer struct {
+        ID         string
+        AgentID    string
+        Upload     bool
+        LocalPath  string
+        RemotePath string
+        StartedAt  time.Time
+
+        mu          sync.Mutex
+        size        int64
+        transferred int64
+        done        chan struct{}
+        err         error
+}
+
+// Progress returns the number of bytes transferred so far, including any
+// resumed from an earlier attempt, and the size of the file.
+func (t *FileTransfer) Progress() (int64, int64) {
+        t.mu.Lock()
+        defer t.mu.Unlock()
+        return t.transferred, t.size
+}
+
+// Done reports whether the transfer has finished.
+func (t *FileTransfer) Done() bool {
+        select {
+        case <-t.done:
+                return true
+        default:
+                return false
+        }
+}
+
+// Wait blocks until the transfer has finished and returns its error.
+func (t *FileTransfer) Wait() error {
+        <-t.done
+        return t.err
+}
+
+func (t *FileTransfer) setProgress(transferred, size int64) {
+        t.mu.Lock()
+        t.transferred, t.size = transferred, size
+        t.mu.Unlock()
+}
+
+func (t *FileTransfer) add(n int64) {
+        t.mu.Lock()
+        t.transferred += n
+        t.mu.Unlock()
+}
+
+// Upload copies localPath to remotePath on agentID in the background.
+func (a *Admin) Upload(agentID, localPath, remotePath string) (*FileTransfer, error) {
+        if err := a.requireCapability(agentID, protocol.CapFile); err != nil {
+                return nil, err
+        }
+
+        info, err := os.Stat(localPath)
+        if err != nil {
+                return nil, err
+        }
+        if info.IsDir() {
+                return nil, fmt.Errorf("%s is a directory", localPath)
+        }
+
+        transfer := a.newTransfer(agentID, true, localPath, remotePath)
+        transfer.size = info.Size()
+
+        go a.runTransfer(transfer, func() error {
+                return a.upload(transfer, info.Mode())
+        })
+
+        return transfer, nil
+}
+
+// Download copies remotePath on agentID to localPath in the background.
+func (a *Admin) Download(agentID, remotePath, localPath string) (*FileTransfer, error) {
+        if err := a.requireCapability(agentID, protocol.CapFile); err != nil {
+                return nil, err
+        }
+
+        transfer := a.newTransfer(agentID, false, localPath, remotePath)
+
+        go a.runTransfer(transfer, func() error {
+                return a.download(transfer)
+        })
+
+        return transfer, nil
+}
+
+// GetTransfers returns all transfers started since the admin was created,
+// oldest first.
+func (a *Admin) GetTransfers() []*FileTransfer {
+        a.transferMu.Lock()
+        defer a.transferMu.Unlock()
+
+        transfers := make([]*FileTransfer, 0, len(a.transfers))
+        for _, transfer := range a.transfers {
+                transfers = append(transfers, transfer)
+        }
+        sort.Slice(transfers, func(i, j int) bool {
+                return transfers[i].StartedAt.Before(transfers[j].StartedAt)
+        })
+        return transfers
+}
+
+func (a *Admin) newTransfer(agentID string, upload bool, localPath, remotePath string) *FileTransfer {
+        transfer := &FileTransfer{
+                ID:         uuid.New().String()[:8],
+                AgentID:    agentID,
+                Upload:     upload,
+                LocalPath:  localPath,
+                RemotePath: remotePath,
+                StartedAt:  time.Now(),
+                done:       make(chan struct{}),
+        }
+
+        a.transferMu.Lock()
+        a.transfers[transfer.ID] = transfer
+        a.transferMu.Unlock()
+
+        return transfer
+}
+
+func (a *Admin) runTransfer(transfer *FileTransfer, run func() error) {
+        direction := "Download"
+        if transfer.Upload {
+                direction = "Upload"
+        }
+
+        transfer.err = run()
+        if transfer.err != nil {
+                log.Printf("%s %s of %s failed: %v", direction, transfer.ID, transfer.RemotePath, transfer.err)
+        } else {
+                log.Printf("%s %s of %s on agent %s completed", direction, transfer.ID, transfer.RemotePath, transfer.AgentID)
+        }
+        close(transfer.done)
+}
+
+func (a *Admin) upload(transfer *FileTransfer, mode os.FileMode) error {
+        sum, err := protocol.HashFile(transfer.LocalPath)
+        if err != nil {
+                return err
+        }
+
+        file, err := os.Open(transfer.LocalPath)
+        if err != nil {
+                return err
+        }
+        defer file.Close()
+
+        info, err := file.Stat()
+        if err != nil {
+                return err
+        }
+
+        stream, err := a.openStream(transfer.AgentID)
+        if err != nil {
+                return err
+        }
+        defer stream.Close()
+
+        if err := sendFileRequest(stream, transfer, &pb.FileRequest{
+                Direction: pb.FileDirection_FILE_UPLOAD,
+                Path:      transfer.RemotePath,
+                Size:      info.Size(),
+                Sha256:    sum,
+                ChunkSize: protocol.FileChunkSize,
+                Mode:      uint32(mode.Perm()),
+        }); err != nil {
+                return err
+        }
+
+        status, err := readFileStatus(stream)
+        if err != nil {
+                return err
+        }
+        if _, err := file.Seek(status.Offset, io.SeekStart); err != nil {
+                return err
+        }
+        transfer.setProgress(status.Offset, info.Size())
+
+        // Read the final status concurrently so that an agent giving up early
+        // stops the upload instead of leaving it blocked on flow control
+        final := make(chan error, 1)
+        go func() {
+                result, err := readFileStatus(stream)
+                if err == nil && result.Sha256 != sum {
+                        err = fmt.Errorf("%w: agent stored %s", errChecksum, result.Sha256)
+                }
+                if err != nil {
+                        stream.Close()
+                }
+                final <- err
+        }()
+
+        buf := make([]byte, protocol.FileChunkSize)
+        sequence := int32(status.Offset / protocol.FileChunkSize)
+        for {
+                n, err := io.ReadFull(file, buf)
+                if n > 0 {
+                        payload, marshalErr := proto.Marshal(&pb.DataPayload{Data: buf[:n], Sequence: sequence})
+                        if marshalErr != nil {
+                                return marshalErr
+                        }
+
+                        if writeErr := protocol.WriteMessage(stream, &pb.Message{
+                                Type:      pb.MessageType_DATA,
+                                SessionId: transfer.ID,
+                                SourceId:  "admin",
+                                TargetId:  transfer.AgentID,
+                                Timestamp: time.Now().Unix(),
+                                Payload:   payload,
+                        }); writeErr != nil {
+                                select {
+                                case err := <-final:
+                                        if err != nil {
+                                                return err
+                                        }
+                                case <-time.After(time.Second):
+                                }
+                                return fmt.Errorf("failed to send chunk %d: %v", sequence, writeErr)
+                        }
+                        transfer.add(int64(n))
+                        sequence++
+                }
+
+                if err == io.EOF || err == io.ErrUnexpectedEOF {
+                        break
+                }
+                if err != nil {
+                        return err
+                }
+        }
+
+        return <-final
+}
+
+func (a *Admin) download(transfer *FileTransfer) error {
+        stream, err := a.openStream(transfer.AgentID)
+        if err != nil {
+                return err
+        }
+        defer stream.Close()
+
+        if err := sendFileRequest(stream, transfer, &pb.FileRequest{
+                Direction: pb.FileDirection_FILE_DOWNLOAD,
+                Path:      transfer.RemotePath,
+                ChunkSize: protocol.FileChunkSize,
+        }); err != nil {
+                return err
+        }
+
+        status, err := readFileStatus(stream)
+        if err != nil {
+                return err
+        }
+
+        partPath := protocol.PartialPath(transfer.LocalPath, status.Sha256)
+        file, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0600)
+        if err != nil {
+                return err
+        }
+        defer file.Close()
+
+        info, err := file.Stat()
+        if err != nil {
+                return err
+        }
+
+        offset := protocol.ResumeOffset(info.Size(), status.Size, protocol.FileChunkSize)
+        if err := file.Truncate(offset); err != nil {
+                return err
+        }
+        if _, err := file.Seek(offset, io.SeekStart); err != nil {
+                return err
+        }
+        transfer.setProgress(offset, status.Size)
+
+        if err := sendFileRequest(stream, transfer, &pb.FileRequest{
+                Direction: pb.FileDirection_FILE_DOWNLOAD,
+                Path:      transfer.RemotePath,
+                Offset:    offset,
+        }); err != nil {
+                return err
+        }
+
+        sequence := int32(offset / protocol.FileChunkSize)
+        for written := offset; written < status.Size; sequence++ {
+                msg, err := protocol.ReadMessage(stream)
+                if err != nil {
+                        return fmt.Errorf("interrupted at %d/%d bytes: %v", written, status.Size, err)
+                }
+                if msg.Type == pb.MessageType_FILE {
+                        return fileStatusError(msg)
+                }
+
+                chunk := &pb.DataPayload{}
+                if err := proto.Unmarshal(msg.Payload, chunk); err != nil {
+                        return fmt.Errorf("invalid chunk: %v", err)
+                }
+                if chunk.Sequence != sequence {
+                        return fmt.Errorf("expected chunk %d, got %d", sequence, chunk.Sequence)
+                }
+                if written+int64(len(chunk.Data)) > status.Size {
+                        return errors.New("received more data than announced")
+                }
+
+                if _, err := file.Write(chunk.Data); err != nil {
+                        return err
+                }
+                written += int64(len(chunk.Data))
+                transfer.add(int64(len(chunk.Data)))
+        }
+
+        if err := file.Close(); err != nil {
+                return err
+        }
+
+        sum, err := protocol.HashFile(partPath)
+        if err != nil {
+                return err
+        }
+        if sum != status.Sha256 {
+                os.Remove(partPath)
+                return fmt.Errorf("%w: got %s, agent has %s", errChecksum, sum, status.Sha256)
+        }
+
+        return os.Rename(partPath, transfer.LocalPath)
+}
+
+func sendFileRequest(stream net.Conn, transfer *FileTransfer, req *pb.FileRequest) error {
+        payload, err := proto.Marshal(req)
+        if err != nil {
+                return err
+        }
+
+        if err := protocol.WriteMessage(stream, &pb.Message{
+                Type:      pb.MessageType_FILE,
+                SessionId: transfer.ID,
+                SourceId:  "admin",
+                TargetId:  transfer.AgentID,
+                Timestamp: time.Now().Unix(),
+                Payload:   payload,
+        }); err != nil {
+                return fmt.Errorf("failed to send file request: %v", err)
+        }
+        return nil
+}
+
+func readFileStatus(stream net.Conn) (*pb.FileStatus, error) {
+        msg, err := protocol.ReadMessage(stream)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read file status: %v", err)
+        }
+        if msg.Type != pb.MessageType_FILE {
+                return nil, fmt.Errorf("unexpected %v response", msg.Type)
+        }
+
+        status := &pb.FileStatus{}
+        if err := proto.Unmarshal(msg.Payload, status); err != nil {
+                return nil, fmt.Errorf("failed to unmarshal file status: %v", err)
+        }
+        if status.Error != "" {
+                return nil, fmt.Errorf("agent %s: %s", msg.SourceId, status.Error)
+        }
+        return status, nil
+}
+
+func fileStatusError(msg *pb.Message) error {
+        status := &pb.FileStatus{}
+        if err := proto.Unmarshal(msg.Payload, status); err != nil || status.Error == "" {
+                return fmt.Errorf("unexpected file status from agent %s", msg.SourceId)
+        }
+        return fmt.Errorf("agent %s: %s", msg.SourceId, status.Error)
+}
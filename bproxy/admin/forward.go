@@ -0,0 +1,124 @@
+package admin
+
+import (
+        "fmt"
+        "log"
+        "net"
+        "sort"
+)
+
+// PortForward relays every connection accepted on LocalAddr to
+// RemoteHost:RemotePort through the CONNECT path of AgentID.
+type PortForward struct {
+        LocalAddr  string
+        AgentID    string
+        RemoteHost string
+        RemotePort int
+        listener   net.Listener
+}
+
+func (a *Admin) StartPortForward(localAddr, agentID, remoteHost string, remotePort int) error {
+        node, exists := a.topology.GetNode(agentID)
+        if !exists {
+                return fmt.Errorf("unknown agent %s", agentID)
+        }
+        if !node.IsActive {
+                return fmt.Errorf("agent %s is offline", agentID)
+        }
+        if !a.InScope(localAddr, agentID, "tcp", remoteHost, remotePort) {
+                return fmt.Errorf("%s:%d is out of scope", remoteHost, remotePort)
+        }
+
+        // Hold the lock across Listen so two concurrent starts on the same
+        // address cannot both pass the duplicate check.
+        a.forwardMu.Lock()
+        defer a.forwardMu.Unlock()
+
+        if _, exists := a.forwards[localAddr]; exists {
+                return fmt.Errorf("port forward already running on %s", localAddr)
+        }
+
+        listener, err := net.Listen("tcp", localAddr)
+        if err != nil {
+                return fmt.Errorf("failed to start port forward listener: %v", err)
+        }
+
+        fwd := &PortForward{
+                LocalAddr:  localAddr,
+                AgentID:    agentID,
+                RemoteHost: remoteHost,
+                RemotePort: remotePort,
+                listener:   listener,
+        }
+        a.forwards[localAddr] = fwd
+
+        log.Printf("Port forward started on %s -> %s:%d via agent %s", localAddr, remoteHost, remotePort, agentID)
+
+        go func() {
+                defer func() {
+                        a.forwardMu.Lock()
+                        if a.forwards[localAddr] == fwd {
+                                delete(a.forwards, localAddr)
+                        }
+                        a.forwardMu.Unlock()
+                        listener.Close()
+                }()
+
+                for {
+                        conn, err := listener.Accept()
+                        if err != nil {
+                                log.Printf("Port forward %s accept error: %v", localAddr, err)
+                                return
+                        }
+
+                        go a.handleForwardConnection(conn, fwd)
+                }
+        }()
+
+        return nil
+}
+
+func (a *Admin) StopPortForward(localAddr string) error {
+        a.forwardMu.Lock()
+        fwd, exists := a.forwards[localAddr]
+        if !exists {
+                a.forwardMu.Unlock()
+                return fmt.Errorf("no port forward running on %s", localAddr)
+        }
+        delete(a.forwards, localAddr)
+        a.forwardMu.Unlock()
+
+        log.Printf("Port forward stopped on %s", localAddr)
+        return fwd.listener.Close()
+}
+
+func (a *Admin) GetPortForwards() []PortForward {
+        a.forwardMu.Lock()
+        defer a.forwardMu.Unlock()
+
+        forwards := make([]PortForward, 0, len(a.forwards))
+        for _, fwd := range a.forwards {
+                forwards = append(forwards, *fwd)
+        }
+        sort.Slice(forwards, func(i, j int) bool {
+                return forwards[i].LocalAddr < forwards[j].LocalAddr
+        })
+        return forwards
+}
+
+func (a *Admin) handleForwardConnection(clientConn net.Conn, fwd *PortForward) {
+        defer clientConn.Close()
+
+        stream, _, err := a.dialThroughAgent(clientConn.RemoteAddr().String(), fwd.AgentID, fwd.RemoteHost, fwd.RemotePort)
+        if err != nil {
+                log.Printf("Port forward %s: connect to %s:%d via agent %s failed: %v",
+                        fwd.LocalAddr, fwd.RemoteHost, fwd.RemotePort, fwd.AgentID, err)
+                return
+        }
+        defer stream.Close()
+
+        log.Printf("Port forward %s: %s connected to %s:%d", fwd.LocalAddr, clientConn.RemoteAddr(), fwd.RemoteHost, fwd.RemotePort)
+
+        splice(stream, clientConn)
+        log.Printf("Port forward %s: connection from %s closed", fwd.LocalAddr, clientConn.RemoteAddr())
+}
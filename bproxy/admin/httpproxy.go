@@ -0,0 +1,302 @@
+package admin
+
+import (
+        "bufio"
+        "errors"
+        "fmt"
+        "log"
+        "net"
+        "net/http"
+        "strconv"
+        "time"
+
+        pb "github.com/bproxy/bproxy/proto"
+        "github.com/bproxy/bproxy/pkg/httpproxy"
+)
+
+type httpProxyServer struct {
+        listener net.Listener
+        agentID  string
+        username string
+        password string
+}
+
+// upstreamConn is a keep-alive connection to one origin server, opened
+// through the agent's CONNECT path.
+type upstreamConn struct {
+        conn   net.Conn
+        reader *bufio.Reader
+}
+
+func (a *Admin) StartHTTPProxy(port int, agentID string) error {
+        return a.StartHTTPProxyWithAuth(port, agentID, "", "")
+}
+
+// StartHTTPProxyWithAuth starts an HTTP proxy that requires Basic proxy
+// authentication when username is not empty.
+func (a *Admin) StartHTTPProxyWithAuth(port int, agentID, username, password string) error {
+        a.httpMu.Lock()
+        if _, exists := a.httpServers[port]; exists {
+                a.httpMu.Unlock()
+                return fmt.Errorf("HTTP proxy already running on port %d", port)
+        }
+        a.httpMu.Unlock()
+
+        listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+        if err != nil {
+                return fmt.Errorf("failed to start HTTP proxy listener: %v", err)
+        }
+
+        server := &httpProxyServer{
+                listener: listener,
+                agentID:  agentID,
+                username: username,
+                password: password,
+        }
+
+        a.httpMu.Lock()
+        a.httpServers[port] = server
+        a.httpMu.Unlock()
+
+        log.Printf("HTTP proxy started on 127.0.0.1:%d -> agent %s", port, agentID)
+
+        go func() {
+                defer func() {
+                        a.httpMu.Lock()
+                        if a.httpServers[port] == server {
+                                delete(a.httpServers, port)
+                        }
+                        a.httpMu.Unlock()
+                        listener.Close()
+                }()
+
+                for {
+                        conn, err := listener.Accept()
+                        if err != nil {
+                                log.Printf("HTTP proxy accept error: %v", err)
+                                return
+                        }
+
+                        go a.handleHTTPProxyConnection(conn, server)
+                }
+        }()
+
+        return nil
+}
+
+func (a *Admin) StopHTTPProxy(port int) error {
+        a.httpMu.Lock()
+        server, exists := a.httpServers[port]
+        if !exists {
+                a.httpMu.Unlock()
+                return fmt.Errorf("no HTTP proxy running on port %d", port)
+        }
+        delete(a.httpServers, port)
+        a.httpMu.Unlock()
+
+        return server.listener.Close()
+}
+
+func (a *Admin) GetHTTPProxies() map[int]string {
+        a.httpMu.Lock()
+        defer a.httpMu.Unlock()
+
+        servers := make(map[int]string)
+        for port, server := range a.httpServers {
+                servers[port] = server.agentID
+        }
+        return servers
+}
+
+func (a *Admin) handleHTTPProxyConnection(clientConn net.Conn, server *httpProxyServer) {
+        defer clientConn.Close()
+
+        clientReader := bufio.NewReader(clientConn)
+        upstreams := make(map[string]*upstreamConn)
+        defer func() {
+                for _, upstream := range upstreams {
+                        upstream.conn.Close()
+                }
+        }()
+
+        for {
+                req, err := http.ReadRequest(clientReader)
+                if err != nil {
+                        return
+                }
+
+                if !httpproxy.Authorized(req, server.username, server.password) {
+                        log.Printf("HTTP proxy: rejected unauthenticated request from %s", clientConn.RemoteAddr())
+                        req.Body.Close()
+                        httpproxy.WriteStatus(clientConn, http.StatusProxyAuthRequired)
+                        if req.Close {
+                                return
+                        }
+                        continue
+                }
+
+                host, port, err := httpproxy.TargetAddress(req)
+                if err != nil {
+                        log.Printf("HTTP proxy: bad request from %s: %v", clientConn.RemoteAddr(), err)
+                        httpproxy.WriteStatus(clientConn, http.StatusBadRequest)
+                        return
+                }
+
+                log.Printf("HTTP proxy request: %s %s:%d via agent %s", req.Method, host, port, server.agentID)
+
+                if req.Method == http.MethodConnect {
+                        a.handleHTTPConnect(clientConn, clientReader, server.agentID, host, port)
+                        return
+                }
+
+                target := net.JoinHostPort(host, strconv.Itoa(port))
+                upstream, reused := upstreams[target]
+                if reused && upstream.idleClosed() {
+                        upstream.conn.Close()
+                        delete(upstreams, target)
+                        reused = false
+                }
+                if !reused {
+                        upstream, err = a.dialUpstream(clientConn, server.agentID, host, port)
+                        if err != nil {
+                                log.Printf("HTTP proxy: connect to %s via agent %s failed: %v", target, server.agentID, err)
+                                httpproxy.WriteStatus(clientConn, gatewayStatus(err))
+                                return
+                        }
+                        upstreams[target] = upstream
+                }
+
+                httpproxy.PrepareOutbound(req)
+                resp, written, err := upstream.send(req)
+                // The origin may have closed a pooled connection just as the request
+                // went out. Try once more on a fresh one unless a body has already
+                // been consumed.
+                if err != nil && reused && req.Body == http.NoBody {
+                        log.Printf("HTTP proxy: pooled connection to %s failed (%v), redialing", target, err)
+                        upstream.conn.Close()
+                        delete(upstreams, target)
+                        <-written
+
+                        upstream, err = a.dialUpstream(clientConn, server.agentID, host, port)
+                        if err != nil {
+                                log.Printf("HTTP proxy: connect to %s via agent %s failed: %v", target, server.agentID, err)
+                                httpproxy.WriteStatus(clientConn, gatewayStatus(err))
+                                return
+                        }
+                        upstreams[target] = upstream
+                        resp, written, err = upstream.send(req)
+                }
+                if err != nil {
+                        log.Printf("HTTP proxy: request to %s failed: %v", target, err)
+                        httpproxy.WriteStatus(clientConn, http.StatusBadGateway)
+                        return
+                }
+
+                // Relay interim responses such as 100 Continue until the final one.
+                for resp.StatusCode < 200 && resp.StatusCode != http.StatusSwitchingProtocols {
+                        httpproxy.PrepareResponse(resp)
+                        if err := httpproxy.WriteInterim(clientConn, resp); err != nil {
+                                return
+                        }
+                        resp, err = http.ReadResponse(upstream.reader, req)
+                        if err != nil {
+                                log.Printf("HTTP proxy: failed to read response from %s: %v", target, err)
+                                httpproxy.WriteStatus(clientConn, http.StatusBadGateway)
+                                return
+                        }
+                }
+
+                httpproxy.PrepareResponse(resp)
+                err = resp.Write(clientConn)
+                resp.Body.Close()
+                if err != nil {
+                        return
+                }
+
+                if resp.Close {
+                        upstream.conn.Close()
+                        delete(upstreams, target)
+                }
+                // The whole request body must have gone out before the next request
+                // is read from the client.
+                if err := <-written; err != nil || req.Close || resp.Close {
+                        return
+                }
+        }
+}
+
+func (a *Admin) dialUpstream(clientConn net.Conn, agentID, host string, port int) (*upstreamConn, error) {
+        stream, _, err := a.dialThroughAgent(clientConn.RemoteAddr().String(), agentID, host, port)
+        if err != nil {
+                return nil, err
+        }
+        return &upstreamConn{conn: stream, reader: bufio.NewReader(stream)}, nil
+}
+
+// send writes req to the origin in the background and reads the first
+// response to it. Writing and reading overlap so that a client waiting for
+// 100 Continue before sending its body gets the interim response. written
+// yields the result of the write once it is done.
+func (u *upstreamConn) send(req *http.Request) (resp *http.Response, written <-chan error, err error) {
+        done := make(chan error, 1)
+        go func() {
+                done <- req.Write(u.conn)
+        }()
+
+        resp, err = http.ReadResponse(u.reader, req)
+        return resp, done, err
+}
+
+// idleClosed reports whether the origin has closed the connection while it
+// sat in the pool, without waiting for data.
+func (u *upstreamConn) idleClosed() bool {
+        if u.reader.Buffered() > 0 {
+                return false
+        }
+        u.conn.SetReadDeadline(time.Now())
+        _, err := u.reader.Peek(1)
+        u.conn.SetReadDeadline(time.Time{})
+        var netErr net.Error
+        return err != nil && !(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func (a *Admin) handleHTTPConnect(clientConn net.Conn, clientReader *bufio.Reader, agentID, host string, port int) {
+        stream, _, err := a.dialThroughAgent(clientConn.RemoteAddr().String(), agentID, host, port)
+        if err != nil {
+                log.Printf("HTTP proxy: CONNECT %s:%d via agent %s failed: %v", host, port, agentID, err)
+                httpproxy.WriteStatus(clientConn, gatewayStatus(err))
+                return
+        }
+        defer stream.Close()
+
+        if err := httpproxy.WriteConnectEstablished(clientConn); err != nil {
+                return
+        }
+
+        // Pass on anything the client sent before seeing our response
+        if buffered := clientReader.Buffered(); buffered > 0 {
+                data, _ := clientReader.Peek(buffered)
+                if _, err := stream.Write(data); err != nil {
+                        return
+                }
+        }
+
+        log.Printf("HTTP CONNECT tunnel established: %s:%d via agent %s", host, port, agentID)
+
+        splice(stream, clientConn)
+        log.Printf("HTTP CONNECT tunnel closed: %s:%d", host, port)
+}
+
+// gatewayStatus maps a dialThroughAgent error to an HTTP status code.
+func gatewayStatus(err error) int {
+        var connErr *connectError
+        if errors.As(err, &connErr) {
+                switch connErr.result.Error {
+                case pb.ConnectError_CONNECT_TIMEOUT:
+                        return http.StatusGatewayTimeout
+                case pb.ConnectError_CONNECT_NOT_ALLOWED:
+                        return http.StatusForbidden
+                }
+        }
+        return http.StatusBadGateway
+}
@@ -0,0 +1,73 @@
+package admin
+
+import (
+        "errors"
+        "log"
+        "strconv"
+        "time"
+
+        pb "github.com/bproxy/bproxy/proto"
+        "github.com/bproxy/bproxy/pkg/protocol"
+        "github.com/bproxy/bproxy/pkg/schedule"
+)
+
+// SetKillDate pushes a kill date to every agent that registers. Agents keep
+// their own kill date if it is earlier.
+func (a *Admin) SetKillDate(t time.Time) {
+        a.mu.Lock()
+        defer a.mu.Unlock()
+        a.killDate = t
+}
+
+// SetWorkingHours pushes a daily window, in the agents' local time, to every
+// agent that registers without one.
+func (a *Admin) SetWorkingHours(w schedule.Window) {
+        a.mu.Lock()
+        defer a.mu.Unlock()
+        a.workingHours = w
+}
+
+// recordLifetime stores the limits an agent registered with and, if the
+// admin's are stricter, pushes them in the background.
+func (a *Admin) recordLifetime(agentID string, regPayload *pb.RegisterPayload) {
+        var killDate time.Time
+        if regPayload.KillDate != 0 {
+                killDate = time.Unix(regPayload.KillDate, 0)
+        }
+        hours := regPayload.WorkingHours
+
+        a.mu.RLock()
+        adminKillDate, adminHours := a.killDate, a.workingHours
+        a.mu.RUnlock()
+
+        effective := schedule.Earliest(killDate, adminKillDate)
+        push := !effective.Equal(killDate) || (hours == "" && !adminHours.IsZero())
+
+        if push && !a.topology.HasCapability(agentID, protocol.CapLifetime) {
+                log.Printf("Agent %s does not support lifetime limits, kill date and working hours not applied", agentID)
+                push = false
+        }
+
+        if push {
+                killDate = effective
+                if hours == "" {
+                        hours = adminHours.String()
+                }
+
+                go func() {
+                        var seconds int64
+                        if !adminKillDate.IsZero() {
+                                seconds = adminKillDate.Unix()
+                        }
+                        response, err := a.RunCommand(agentID, "lifetime", strconv.FormatInt(seconds, 10), adminHours.String())
+                        if err == nil && response.Error != "" {
+                                err = errors.New(response.Error)
+                        }
+                        if err != nil {
+                                log.Printf("Failed to push lifetime limits to agent %s: %v", agentID, err)
+                        }
+                }()
+        }
+
+        a.topology.SetLifetime(agentID, killDate, hours)
+}
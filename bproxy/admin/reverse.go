@@ -0,0 +1,177 @@
+package admin
+
+import (
+        "fmt"
+        "io"
+        "log"
+        "net"
+        "sort"
+        "strconv"
+        "time"
+
+        "github.com/google/uuid"
+        pb "github.com/bproxy/bproxy/proto"
+        "github.com/bproxy/bproxy/pkg/protocol"
+        "google.golang.org/protobuf/proto"
+)
+
+// ReverseForward makes AgentID listen on RemoteAddr and dials LocalAddr on
+// the admin side for every connection it accepts.
+type ReverseForward struct {
+        ID         string
+        AgentID    string
+        RemoteAddr string
+        LocalAddr  string
+        stream     net.Conn
+}
+
+func (a *Admin) StartReverseForward(agentID, remoteAddr, localAddr string) (string, error) {
+        host, portStr, err := net.SplitHostPort(remoteAddr)
+        if err != nil {
+                return "", fmt.Errorf("invalid remote address %s: %v", remoteAddr, err)
+        }
+        port, err := strconv.Atoi(portStr)
+        if err != nil {
+                return "", fmt.Errorf("invalid remote port %s", portStr)
+        }
+
+        if err := a.requireCapability(agentID, protocol.CapReverseForward); err != nil {
+                return "", err
+        }
+
+        stream, err := a.openStream(agentID)
+        if err != nil {
+                return "", err
+        }
+
+        forwardID := uuid.New().String()[:8]
+        payload, err := proto.Marshal(&pb.ReverseForwardPayload{
+                ForwardId: forwardID,
+                Address:   host,
+                Port:      int32(port),
+        })
+        if err != nil {
+                stream.Close()
+                return "", err
+        }
+
+        msg := &pb.Message{
+                Type:      pb.MessageType_REVERSE_LISTEN,
+                SessionId: fmt.Sprintf("rfwd-%s", forwardID),
+                SourceId:  "admin",
+                TargetId:  agentID,
+                Timestamp: time.Now().Unix(),
+                Payload:   payload,
+        }
+
+        if err := protocol.WriteMessage(stream, msg); err != nil {
+                stream.Close()
+                return "", fmt.Errorf("failed to send reverse forward request: %v", err)
+        }
+
+        response, err := protocol.ReadMessage(stream)
+        if err != nil {
+                stream.Close()
+                return "", fmt.Errorf("failed to read reverse forward response: %v", err)
+        }
+
+        if response.Type != pb.MessageType_REVERSE_LISTEN {
+                stream.Close()
+                return "", fmt.Errorf("agent %s failed to listen on %s: %w", agentID, remoteAddr, failedResponse(response))
+        }
+
+        boundPayload := &pb.ReverseForwardPayload{}
+        if err := proto.Unmarshal(response.Payload, boundPayload); err != nil {
+                stream.Close()
+                return "", fmt.Errorf("failed to unmarshal reverse forward response: %v", err)
+        }
+
+        fwd := &ReverseForward{
+                ID:         forwardID,
+                AgentID:    agentID,
+                RemoteAddr: net.JoinHostPort(boundPayload.Address, strconv.Itoa(int(boundPayload.Port))),
+                LocalAddr:  localAddr,
+                stream:     stream,
+        }
+
+        a.reverseMu.Lock()
+        a.reverseForwards[forwardID] = fwd
+        a.reverseMu.Unlock()
+
+        log.Printf("Reverse forward %s started: agent %s %s -> %s", forwardID, agentID, fwd.RemoteAddr, localAddr)
+
+        // The agent keeps listening while the control stream stays open
+        go func() {
+                io.Copy(io.Discard, stream)
+                stream.Close()
+
+                a.reverseMu.Lock()
+                if a.reverseForwards[forwardID] == fwd {
+                        delete(a.reverseForwards, forwardID)
+                        log.Printf("Reverse forward %s closed by agent %s", forwardID, agentID)
+                }
+                a.reverseMu.Unlock()
+        }()
+
+        return forwardID, nil
+}
+
+func (a *Admin) StopReverseForward(forwardID string) error {
+        a.reverseMu.Lock()
+        fwd, exists := a.reverseForwards[forwardID]
+        if !exists {
+                a.reverseMu.Unlock()
+                return fmt.Errorf("no reverse forward %s", forwardID)
+        }
+        delete(a.reverseForwards, forwardID)
+        a.reverseMu.Unlock()
+
+        log.Printf("Reverse forward %s stopped", forwardID)
+        return fwd.stream.Close()
+}
+
+func (a *Admin) GetReverseForwards() []ReverseForward {
+        a.reverseMu.Lock()
+        defer a.reverseMu.Unlock()
+
+        forwards := make([]ReverseForward, 0, len(a.reverseForwards))
+        for _, fwd := range a.reverseForwards {
+                forwards = append(forwards, *fwd)
+        }
+        sort.Slice(forwards, func(i, j int) bool {
+                return forwards[i].ID < forwards[j].ID
+        })
+        return forwards
+}
+
+// handleReverseConnect dials the local address of a reverse forward and
+// splices it with the stream opened by the agent.
+func (a *Admin) handleReverseConnect(msg *pb.Message, stream net.Conn) {
+        fwdPayload := &pb.ReverseForwardPayload{}
+        if err := proto.Unmarshal(msg.Payload, fwdPayload); err != nil {
+                log.Printf("Failed to unmarshal reverse connect payload: %v", err)
+                return
+        }
+
+        a.reverseMu.Lock()
+        fwd, exists := a.reverseForwards[fwdPayload.ForwardId]
+        a.reverseMu.Unlock()
+
+        if !exists || fwd.AgentID != msg.SourceId {
+                log.Printf("Rejected reverse connection for unknown forward %s from %s", fwdPayload.ForwardId, msg.SourceId)
+                return
+        }
+
+        localConn, err := net.DialTimeout("tcp", fwd.LocalAddr, 10*time.Second)
+        if err != nil {
+                log.Printf("Reverse forward %s: failed to connect to %s: %v", fwd.ID, fwd.LocalAddr, err)
+                return
+        }
+        defer localConn.Close()
+
+        peerAddr := net.JoinHostPort(fwdPayload.Address, strconv.Itoa(int(fwdPayload.Port)))
+        log.Printf("Reverse forward %s: %s connected via agent %s -> %s", fwd.ID, peerAddr, fwd.AgentID, fwd.LocalAddr)
+
+        splice(stream, localConn)
+        log.Printf("Reverse forward %s: connection from %s closed", fwd.ID, peerAddr)
+}
@@ -0,0 +1,179 @@
+package admin
+
+import (
+        "fmt"
+        "net"
+        "sort"
+
+        "github.com/bproxy/bproxy/pkg/scope"
+        "github.com/bproxy/bproxy/pkg/topology"
+)
+
+// RouteRule sends destinations matching Target to AgentID. Auto rules are
+// derived from the subnets agents report when they register; manual rules
+// are added with AddRoute and win over auto rules of the same specificity.
+type RouteRule struct {
+        Target  string
+        AgentID string
+        Auto    bool
+        target  scope.Target
+}
+
+// StartRoutedSocks5 starts a SOCKS5 proxy that picks the agent for every
+// request from the route table. See StartSocks5WithAuth for authentication.
+func (a *Admin) StartRoutedSocks5(port int, username, password string) error {
+        return a.StartSocks5WithAuth(port, "", username, password)
+}
+
+// RoutingActive reports whether a routed SOCKS5 proxy is running.
+func (a *Admin) RoutingActive() bool {
+        a.socks5Mu.Lock()
+        defer a.socks5Mu.Unlock()
+
+        for _, server := range a.socks5Servers {
+                if server.agentID == "" {
+                        return true
+                }
+        }
+        return false
+}
+
+// AddRoute sends destinations matching target, a CIDR, IP address, domain
+// or "*."-prefixed wildcard domain, to agentID. An existing manual rule for
+// the same target is replaced.
+func (a *Admin) AddRoute(target, agentID string) error {
+        t, err := scope.ParseTarget(target)
+        if err != nil {
+                return err
+        }
+        if _, exists := a.topology.GetNode(agentID); !exists {
+                return fmt.Errorf("unknown agent %s", agentID)
+        }
+
+        a.routeMu.Lock()
+        defer a.routeMu.Unlock()
+
+        for i, rule := range a.routes {
+                if rule.Target == target {
+                        a.routes[i].AgentID = agentID
+                        return nil
+                }
+        }
+        a.routes = append(a.routes, RouteRule{Target: target, AgentID: agentID, target: t})
+        return nil
+}
+
+func (a *Admin) RemoveRoute(target string) error {
+        a.routeMu.Lock()
+        defer a.routeMu.Unlock()
+
+        for i, rule := range a.routes {
+                if rule.Target == target {
+                        a.routes = append(a.routes[:i], a.routes[i+1:]...)
+                        return nil
+                }
+        }
+        return fmt.Errorf("no route for %s", target)
+}
+
+// SetDefaultRoute sets the agent used for destinations no rule matches. An
+// empty agentID removes the default.
+func (a *Admin) SetDefaultRoute(agentID string) {
+        a.routeMu.Lock()
+        defer a.routeMu.Unlock()
+        a.defaultRoute = agentID
+}
+
+func (a *Admin) DefaultRoute() string {
+        a.routeMu.Lock()
+        defer a.routeMu.Unlock()
+        return a.defaultRoute
+}
+
+// GetRoutes returns the active route table: the manual rules followed by
+// the rules derived from the subnets of the agents that are online.
+func (a *Admin) GetRoutes() []RouteRule {
+        a.routeMu.Lock()
+        routes := append([]RouteRule(nil), a.routes...)
+        a.routeMu.Unlock()
+
+        nodes := a.topology.GetAllNodes()
+        sort.Slice(nodes, func(i, j int) bool {
+                return nodes[i].ID < nodes[j].ID
+        })
+        for _, node := range nodes {
+                if !node.IsActive || node.Retired {
+                        continue
+                }
+                for _, network := range nodeNetworks(node) {
+                        t, err := scope.ParseTarget(network)
+                        if err != nil {
+                                continue
+                        }
+                        routes = append(routes, RouteRule{Target: network, AgentID: node.ID, Auto: true, target: t})
+                }
+        }
+        return routes
+}
+
+// nodeNetworks returns the subnets an agent reported. Agents predating
+// subnet reporting only send addresses, which are taken as /24 networks.
+func nodeNetworks(node *topology.NodeInfo) []string {
+        if len(node.Networks) > 0 {
+                return node.Networks
+        }
+
+        var networks []string
+        for _, addr := range node.LocalIPs {
+                if ip := net.ParseIP(addr).To4(); ip != nil {
+                        network := &net.IPNet{IP: ip.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}
+                        networks = append(networks, network.String())
+                }
+        }
+        return networks
+}
+
+// Route picks the agent for host. The most specific matching rule wins;
+// between rules of equal specificity a manual rule beats an auto rule and
+// an agent with a shorter path beats one further away. Rules for agents
+// that are offline are skipped, and the default agent is used when nothing
+// matches.
+func (a *Admin) Route(host string) (string, error) {
+        var best *RouteRule
+        bestDepth := 0
+        routes := a.GetRoutes()
+        for i := range routes {
+                rule := &routes[i]
+                if !rule.target.Match(host) || !a.routeUsable(rule.AgentID) {
+                        continue
+                }
+
+                depth := len(a.topology.GetPath(rule.AgentID))
+                if best == nil || a.betterRoute(rule, depth, best, bestDepth) {
+                        best, bestDepth = rule, depth
+                }
+        }
+        if best != nil {
+                return best.AgentID, nil
+        }
+
+        if defaultRoute := a.DefaultRoute(); defaultRoute != "" && a.routeUsable(defaultRoute) {
+                return defaultRoute, nil
+        }
+        return "", fmt.Errorf("%w: no route matches %s", errNoRoute, host)
+}
+
+func (a *Admin) betterRoute(rule *RouteRule, depth int, best *RouteRule, bestDepth int) bool {
+        if s, bestS := rule.target.Specificity(), best.target.Specificity(); s != bestS {
+                return s > bestS
+        }
+        if rule.Auto != best.Auto {
+                return !rule.Auto
+        }
+        return depth < bestDepth
+}
+
+func (a *Admin) routeUsable(agentID string) bool {
+        node, exists := a.topology.GetNode(agentID)
+        return exists && node.IsActive && !node.Retired
+}
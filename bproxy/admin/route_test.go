@@ -0,0 +1,157 @@
+package admin
+
+import (
+        "errors"
+        "testing"
+
+        "github.com/bproxy/bproxy/pkg/topology"
+)
+
+// newRouteTestAdmin builds the topology
+//
+//        a1 (10.0.0.0/8) -> a2 (10.1.0.0/16)
+//        b1 (10.1.0.0/16)
+//        c1 (no subnets, address 192.168.5.10)
+func newRouteTestAdmin(t *testing.T) *Admin {
+        a := &Admin{topology: topology.NewTopology()}
+
+        a.topology.AddNode("a1", "a1", []string{"10.0.0.1"}, "linux", "amd64")
+        a.topology.SetNetworks("a1", []string{"10.0.0.0/8"})
+        a.topology.AddNode("a2", "a2", []string{"10.1.0.1"}, "linux", "amd64")
+        a.topology.SetNetworks("a2", []string{"10.1.0.0/16"})
+        if err := a.topology.AddEdge("a1", "a2"); err != nil {
+                t.Fatal(err)
+        }
+        a.topology.AddNode("b1", "b1", []string{"10.1.0.2"}, "linux", "amd64")
+        a.topology.SetNetworks("b1", []string{"10.1.0.0/16"})
+        a.topology.AddNode("c1", "c1", []string{"192.168.5.10"}, "linux", "amd64")
+
+        return a
+}
+
+func TestRoute(t *testing.T) {
+        tests := []struct {
+                name         string
+                routes       [][2]string
+                defaultRoute string
+                offline      []string
+                host         string
+                want         string
+        }{
+                {
+                        name: "auto rule",
+                        host: "10.2.3.4",
+                        want: "a1",
+                },
+                {
+                        name:    "more specific auto rule beats a shorter path",
+                        offline: []string{"b1"},
+                        host:    "10.1.2.3",
+                        want:    "a2",
+                },
+                {
+                        name: "shorter path wins between equal auto rules",
+                        host: "10.1.2.3",
+                        want: "b1",
+                },
+                {
+                        name:   "manual beats auto of the same specificity",
+                        routes: [][2]string{{"10.1.0.0/16", "a2"}},
+                        host:   "10.1.2.3",
+                        want:   "a2",
+                },
+                {
+                        name:   "specificity beats manual",
+                        routes: [][2]string{{"10.0.0.0/8", "c1"}},
+                        host:   "10.1.2.3",
+                        want:   "b1",
+                },
+                {
+                        name:   "single address beats subnets",
+                        routes: [][2]string{{"10.1.2.3", "c1"}},
+                        host:   "10.1.2.3",
+                        want:   "c1",
+                },
+                {
+                        name:   "exact domain beats wildcard",
+                        routes: [][2]string{{"*.corp.local", "a1"}, {"db.corp.local", "a2"}},
+                        host:   "db.corp.local",
+                        want:   "a2",
+                },
+                {
+                        name:   "wildcard matches other subdomains",
+                        routes: [][2]string{{"*.corp.local", "a1"}, {"db.corp.local", "a2"}},
+                        host:   "web.corp.local",
+                        want:   "a1",
+                },
+                {
+                        name:   "longer wildcard wins",
+                        routes: [][2]string{{"*.corp.local", "a1"}, {"*.eu.corp.local", "b1"}},
+                        host:   "app.eu.corp.local",
+                        want:   "b1",
+                },
+                {
+                        name: "addresses of legacy agents are /24 networks",
+                        host: "192.168.5.77",
+                        want: "c1",
+                },
+                {
+                        name:    "offline agents are skipped",
+                        routes:  [][2]string{{"10.1.0.0/16", "a2"}},
+                        offline: []string{"a2"},
+                        host:    "10.1.2.3",
+                        want:    "b1",
+                },
+                {
+                        name:         "default when nothing matches",
+                        defaultRoute: "c1",
+                        host:         "172.16.0.1",
+                        want:         "c1",
+                },
+                {
+                        name:         "rules win over the default",
+                        defaultRoute: "c1",
+                        host:         "10.2.3.4",
+                        want:         "a1",
+                },
+                {
+                        name: "no route without a default",
+                        host: "172.16.0.1",
+                },
+                {
+                        name:         "offline default",
+                        defaultRoute: "c1",
+                        offline:      []string{"c1"},
+                        host:         "172.16.0.1",
+                },
+        }
+
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        a := newRouteTestAdmin(t)
+                        for _, route := range tt.routes {
+                                if err := a.AddRoute(route[0], route[1]); err != nil {
+                                        t.Fatalf("AddRoute(%q, %q): %v", route[0], route[1], err)
+                                }
+                        }
+                        a.SetDefaultRoute(tt.defaultRoute)
+                        for _, id := range tt.offline {
+                                a.topology.RemoveNode(id)
+                        }
+
+                        got, err := a.Route(tt.host)
+                        if tt.want == "" {
+                                if !errors.Is(err, errNoRoute) {
+                                        t.Fatalf("Route(%q) = %q, %v, want errNoRoute", tt.host, got, err)
+                                }
+                                return
+                        }
+                        if err != nil {
+                                t.Fatalf("Route(%q): %v", tt.host, err)
+                        }
+                        if got != tt.want {
+                                t.Errorf("Route(%q) = %q, want %q", tt.host, got, tt.want)
+                        }
+                })
+        }
+}
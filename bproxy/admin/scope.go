@@ -0,0 +1,67 @@
+package admin
+
+import (
+        pb "github.com/bproxy/bproxy/proto"
+        "github.com/bproxy/bproxy/pkg/scope"
+)
+
+// SetScope restricts the destinations reachable through the admin's
+// proxies and forwards. Refused attempts are recorded in audit. A nil scope
+// allows every destination.
+func (a *Admin) SetScope(s *scope.Scope, audit *scope.AuditLog) {
+        a.mu.Lock()
+        defer a.mu.Unlock()
+        a.scope = s
+        a.audit = audit
+}
+
+// Scope returns the scope passed to the last SetScope call. A different
+// pointer means the rules have changed since an earlier call.
+func (a *Admin) Scope() *scope.Scope {
+        a.mu.RLock()
+        defer a.mu.RUnlock()
+        return a.scope
+}
+
+// InScope reports whether source may reach host:port over network through
+// agentID, and records an audit entry if it may not.
+func (a *Admin) InScope(source, agentID, network, host string, port int) bool {
+        a.mu.RLock()
+        s := a.scope
+        a.mu.RUnlock()
+
+        if s.Allows(host, port) {
+                return true
+        }
+
+        a.auditLog().Denied("admin", source, agentID, network, host, port)
+        return false
+}
+
+// checkScope is InScope for the CONNECT path. It fails with the same error
+// an agent refusing the destination would produce.
+func (a *Admin) checkScope(source, agentID, host string, port int) error {
+        if a.InScope(source, agentID, "tcp", host, port) {
+                return nil
+        }
+
+        return &connectError{result: &pb.ConnectResult{
+                Error:     pb.ConnectError_CONNECT_NOT_ALLOWED,
+                FailedHop: "admin",
+                Message:   scope.DeniedMessage,
+        }}
+}
+
+// auditRefusal records a CONNECT or BIND that an agent refused because of
+// its own scope, which means the admin's scope is wider than the agent's.
+func (a *Admin) auditRefusal(source, agentID, host string, port int, result *pb.ConnectResult) {
+        if result.Error == pb.ConnectError_CONNECT_NOT_ALLOWED && result.Message == scope.DeniedMessage {
+                a.auditLog().Denied(result.FailedHop, source, agentID, "tcp", host, port)
+        }
+}
+
+func (a *Admin) auditLog() *scope.AuditLog {
+        a.mu.RLock()
+        defer a.mu.RUnlock()
+        return a.audit
+}
@@ -0,0 +1,299 @@
+package admin
+
+import (
+        "errors"
+        "fmt"
+        "io"
+        "log"
+        "net"
+        "sort"
+        "sync"
+        "time"
+
+        "github.com/google/uuid"
+        pb "github.com/bproxy/bproxy/proto"
+        "github.com/bproxy/bproxy/pkg/protocol"
+        "google.golang.org/protobuf/proto"
+)
+
+// ShellSession is an interactive shell running on a pseudo-terminal of an
+// agent. Reads return terminal output until the shell exits; writes are sent
+// as keystrokes, so control characters such as Ctrl-C reach the remote
+// terminal unchanged.
+type ShellSession struct {
+        ID      string
+        AgentID string
+
+        stream   net.Conn
+        output   *io.PipeReader
+        writeMu  sync.Mutex
+        done     chan struct{}
+        exitCode int32
+        err      error
+}
+
+// requireShell checks that agentID can run a shell. The agents in front of it
+// only forward the stream, which builds without pseudo-terminals do as well.
+func (a *Admin) requireShell(agentID string) error {
+        path := a.topology.GetPath(agentID)
+        for _, hop := range path[:len(path)-1] {
+                if !a.topology.HasCapability(hop, protocol.CapShellRelay) {
+                        return fmt.Errorf("%w: agent %s does not advertise %q", errUnsupported, hop, protocol.CapShellRelay)
+                }
+        }
+
+        if !a.topology.HasCapability(agentID, protocol.CapShell) {
+                return fmt.Errorf("%w: agent %s does not advertise %q", errUnsupported, agentID, protocol.CapShell)
+        }
+        return nil
+}
+
+// OpenShell starts a shell on agentID with the given terminal type and size.
+// A zero size leaves the agent's default of 80x24.
+func (a *Admin) OpenShell(agentID, term string, rows, cols uint32) (*ShellSession, error) {
+        if err := a.requireShell(agentID); err != nil {
+                return nil, err
+        }
+
+        payload, err := proto.Marshal(&pb.ShellRequest{Term: term, Rows: rows, Cols: cols})
+        if err != nil {
+                return nil, err
+        }
+
+        stream, err := a.openStream(agentID)
+        if err != nil {
+                return nil, err
+        }
+
+        id := uuid.New().String()
+        msg := &pb.Message{
+                Type:      pb.MessageType_SHELL,
+                SessionId: id,
+                SourceId:  "admin",
+                TargetId:  agentID,
+                Timestamp: time.Now().Unix(),
+                Payload:   payload,
+        }
+
+        if err := protocol.WriteMessage(stream, msg); err != nil {
+                stream.Close()
+                return nil, fmt.Errorf("failed to send shell request: %v", err)
+        }
+
+        reader, writer := io.Pipe()
+        session := &ShellSession{
+                ID:      id,
+                AgentID: agentID,
+                stream:  stream,
+                output:  reader,
+                done:    make(chan struct{}),
+        }
+
+        go session.readLoop(writer)
+
+        return session, nil
+}
+
+func (s *ShellSession) readLoop(output *io.PipeWriter) {
+        defer close(s.done)
+        defer output.Close()
+        defer s.stream.Close()
+
+        for {
+                msg, err := protocol.ReadMessage(s.stream)
+                if err != nil {
+                        s.exitCode = -1
+                        s.err = fmt.Errorf("shell stream closed: %v", err)
+                        return
+                }
+
+                frame := &pb.ExecOutput{}
+                if err := proto.Unmarshal(msg.Payload, frame); err != nil {
+                        s.exitCode = -1
+                        s.err = fmt.Errorf("failed to unmarshal shell output: %v", err)
+                        return
+                }
+
+                if frame.Stream == pb.ExecStream_EXEC_EXIT {
+                        s.exitCode = frame.ExitCode
+                        if frame.Error != "" {
+                                s.err = errors.New(frame.Error)
+                        }
+                        return
+                }
+
+                if _, err := output.Write(frame.Data); err != nil {
+                        s.exitCode = -1
+                        s.err = errors.New("shell closed")
+                        return
+                }
+        }
+}
+
+// Read returns terminal output. It returns io.EOF once the shell has exited.
+func (s *ShellSession) Read(p []byte) (int, error) {
+        return s.output.Read(p)
+}
+
+// Write sends keystrokes to the shell.
+func (s *ShellSession) Write(p []byte) (int, error) {
+        data := make([]byte, len(p))
+        copy(data, p)
+
+        if err := s.send(&pb.ShellInput{Data: data}); err != nil {
+                return 0, err
+        }
+        return len(p), nil
+}
+
+// Resize changes the size of the remote terminal.
+func (s *ShellSession) Resize(rows, cols uint32) error {
+        return s.send(&pb.ShellInput{Rows: rows, Cols: cols})
+}
+
+func (s *ShellSession) send(input *pb.ShellInput) error {
+        payload, err := proto.Marshal(input)
+        if err != nil {
+                return err
+        }
+
+        s.writeMu.Lock()
+        defer s.writeMu.Unlock()
+        return protocol.WriteMessage(s.stream, &pb.Message{
+                Type:      pb.MessageType_SHELL,
+                SessionId: s.ID,
+                SourceId:  "admin",
+                TargetId:  s.AgentID,
+                Timestamp: time.Now().Unix(),
+                Payload:   payload,
+        })
+}
+
+// Close ends the session. The agent kills the shell when the stream closes.
+func (s *ShellSession) Close() error {
+        s.output.Close()
+        return s.stream.Close()
+}
+
+// Wait blocks until the shell has exited or the session was closed and
+// returns the exit code.
+func (s *ShellSession) Wait() (int32, error) {
+        <-s.done
+        return s.exitCode, s.err
+}
+
+// ShellListener attaches every connection accepted on Addr to a new shell on
+// AgentID, so that tools like socat or nc can be used as the terminal.
+type ShellListener struct {
+        Network  string
+        Addr     string
+        AgentID  string
+        listener net.Listener
+}
+
+// StartShellListener listens on a "tcp" or "unix" address for shell clients.
+func (a *Admin) StartShellListener(network, addr, agentID string) error {
+        if err := a.requireShell(agentID); err != nil {
+                return err
+        }
+
+        // Hold the lock across Listen, as StartPortForward does, so two
+        // concurrent starts on the same address cannot both pass the check.
+        a.shellMu.Lock()
+        defer a.shellMu.Unlock()
+
+        if _, exists := a.shellListeners[addr]; exists {
+                return fmt.Errorf("shell listener already running on %s", addr)
+        }
+
+        listener, err := net.Listen(network, addr)
+        if err != nil {
+                return fmt.Errorf("failed to start shell listener: %v", err)
+        }
+
+        sl := &ShellListener{
+                Network:  network,
+                Addr:     addr,
+                AgentID:  agentID,
+                listener: listener,
+        }
+        a.shellListeners[addr] = sl
+
+        log.Printf("Shell listener started on %s %s -> agent %s", network, addr, agentID)
+
+        go func() {
+                defer func() {
+                        a.shellMu.Lock()
+                        if a.shellListeners[addr] == sl {
+                                delete(a.shellListeners, addr)
+                        }
+                        a.shellMu.Unlock()
+                        listener.Close()
+                }()
+
+                for {
+                        conn, err := listener.Accept()
+                        if err != nil {
+                                log.Printf("Shell listener %s accept error: %v", addr, err)
+                                return
+                        }
+
+                        go a.handleShellConnection(conn, sl)
+                }
+        }()
+
+        return nil
+}
+
+func (a *Admin) StopShellListener(addr string) error {
+        a.shellMu.Lock()
+        sl, exists := a.shellListeners[addr]
+        if !exists {
+                a.shellMu.Unlock()
+                return fmt.Errorf("no shell listener running on %s", addr)
+        }
+        delete(a.shellListeners, addr)
+        a.shellMu.Unlock()
+
+        log.Printf("Shell listener stopped on %s", addr)
+        return sl.listener.Close()
+}
+
+func (a *Admin) GetShellListeners() []ShellListener {
+        a.shellMu.Lock()
+        defer a.shellMu.Unlock()
+
+        listeners := make([]ShellListener, 0, len(a.shellListeners))
+        for _, sl := range a.shellListeners {
+                listeners = append(listeners, *sl)
+        }
+        sort.Slice(listeners, func(i, j int) bool {
+                return listeners[i].Addr < listeners[j].Addr
+        })
+        return listeners
+}
+
+func (a *Admin) handleShellConnection(conn net.Conn, sl *ShellListener) {
+        defer conn.Close()
+
+        shell, err := a.OpenShell(sl.AgentID, "", 0, 0)
+        if err != nil {
+                log.Printf("Shell listener %s: failed to open shell on agent %s: %v", sl.Addr, sl.AgentID, err)
+                return
+        }
+        defer shell.Close()
+
+        log.Printf("Shell listener %s: %s attached to agent %s", sl.Addr, conn.RemoteAddr(), sl.AgentID)
+
+        go func() {
+                io.Copy(shell, conn)
+                shell.Close()
+        }()
+        io.Copy(conn, shell)
+
+        if exitCode, err := shell.Wait(); err != nil {
+                log.Printf("Shell listener %s: session on agent %s ended: %v", sl.Addr, sl.AgentID, err)
+        } else {
+                log.Printf("Shell listener %s: shell on agent %s exited with code %d", sl.Addr, sl.AgentID, exitCode)
+        }
+}
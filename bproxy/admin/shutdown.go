@@ -0,0 +1,107 @@
+package admin
+
+import (
+        "errors"
+        "fmt"
+        "log"
+        "time"
+
+        "github.com/google/uuid"
+        pb "github.com/bproxy/bproxy/proto"
+        "github.com/bproxy/bproxy/pkg/protocol"
+        "google.golang.org/protobuf/proto"
+)
+
+// shutdownTimeout bounds the wait for an agent to confirm a shutdown.
+const shutdownTimeout = 10 * time.Second
+
+// Shutdown stops agentID for good and marks it as retired in the topology.
+// With cascade set, the agents below it are shut down first, deepest first;
+// otherwise an agent with active children is refused so that they are not
+// left reconnecting forever. The retired IDs are returned even if a later
+// agent fails.
+func (a *Admin) Shutdown(agentID string, cascade bool, reason string) ([]string, error) {
+        node, exists := a.topology.GetNode(agentID)
+        if !exists {
+                return nil, fmt.Errorf("unknown agent %s", agentID)
+        }
+        if !node.IsActive {
+                return nil, fmt.Errorf("agent %s is offline", agentID)
+        }
+
+        targets := []string{agentID}
+        if cascade {
+                targets = a.topology.Subtree(agentID)
+        } else {
+                for _, childID := range node.Children {
+                        if child, exists := a.topology.GetNode(childID); exists && child.IsActive {
+                                return nil, fmt.Errorf("agent %s has active children, shut down its subtree instead", agentID)
+                        }
+                }
+        }
+
+        var retired []string
+        for _, id := range targets {
+                if target, exists := a.topology.GetNode(id); !exists || !target.IsActive {
+                        log.Printf("Skipping shutdown of offline agent %s", id)
+                        continue
+                }
+
+                if err := a.shutdownAgent(id, reason); err != nil {
+                        return retired, fmt.Errorf("failed to shut down agent %s: %w", id, err)
+                }
+
+                a.topology.RetireNode(id)
+                retired = append(retired, id)
+                log.Printf("Agent %s retired", id)
+        }
+
+        return retired, nil
+}
+
+func (a *Admin) shutdownAgent(agentID, reason string) error {
+        if err := a.requireCapability(agentID, protocol.CapShutdown); err != nil {
+                return err
+        }
+
+        payload, err := proto.Marshal(&pb.ShutdownRequest{Reason: reason})
+        if err != nil {
+                return err
+        }
+
+        stream, err := a.openStream(agentID)
+        if err != nil {
+                return err
+        }
+        defer stream.Close()
+
+        stream.SetDeadline(time.Now().Add(shutdownTimeout))
+
+        if err := protocol.WriteMessage(stream, &pb.Message{
+                Type:      pb.MessageType_SHUTDOWN,
+                SessionId: uuid.New().String(),
+                SourceId:  "admin",
+                TargetId:  agentID,
+                Timestamp: time.Now().Unix(),
+                Payload:   payload,
+        }); err != nil {
+                return fmt.Errorf("failed to send shutdown: %v", err)
+        }
+
+        msg, err := protocol.ReadMessage(stream)
+        if err != nil {
+                return fmt.Errorf("no confirmation: %v", err)
+        }
+        if msg.Type != pb.MessageType_SHUTDOWN {
+                return fmt.Errorf("unexpected %v response", msg.Type)
+        }
+
+        resp := &pb.ShutdownResponse{}
+        if err := proto.Unmarshal(msg.Payload, resp); err != nil {
+                return fmt.Errorf("failed to unmarshal shutdown response: %v", err)
+        }
+        if resp.Error != "" {
+                return errors.New(resp.Error)
+        }
+        return nil
+}
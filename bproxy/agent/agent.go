@@ -2,23 +2,33 @@ package agent
 
 import (
         "crypto/tls"
+        "errors"
         "fmt"
         "io"
         "log"
         "net"
         "os"
         "runtime"
+        "strconv"
+        "strings"
         "sync"
+        "syscall"
         "time"
 
         "github.com/google/uuid"
         "github.com/hashicorp/yamux"
         pb "github.com/bproxy/bproxy/proto"
+        "github.com/bproxy/bproxy/pkg/auth"
+        "github.com/bproxy/bproxy/pkg/netstack"
         "github.com/bproxy/bproxy/pkg/protocol"
+        "github.com/bproxy/bproxy/pkg/schedule"
+        "github.com/bproxy/bproxy/pkg/scope"
         tlsutil "github.com/bproxy/bproxy/pkg/tls"
         "google.golang.org/protobuf/proto"
 )
 
+const bindTimeout = 2 * time.Minute
+
 type Agent struct {
         id           string
         adminAddr    string
@@ -26,9 +36,44 @@ type Agent struct {
         conn         net.Conn
         mu           sync.Mutex
         relayMap     map[string]*yamux.Session
+        routes       map[string]string
+        descendants  map[string]*pb.RegisterPayload
         tlsConfig    *tls.Config
         cascadePort  int
         cascadeListener net.Listener
+        cascadeTLS   *tls.Config
+        cascadeCertFile string
+        cascadeKeyFile  string
+        clientCAFile string
+        secret       string
+        killDate     time.Time
+        workingHours schedule.Window
+        scope        *scope.Scope
+        audit        *scope.AuditLog
+        processes    map[int]func() error
+        processWG    sync.WaitGroup
+        stop         chan struct{}
+        stopOnce     sync.Once
+}
+
+// LoadOrCreateID returns the agent ID stored in path. If the file does not
+// exist a new ID is generated and saved there, so the agent keeps its
+// identity across restarts.
+func LoadOrCreateID(path string) (string, error) {
+        data, err := os.ReadFile(path)
+        if err == nil {
+                if id := strings.TrimSpace(string(data)); id != "" {
+                        return id, nil
+                }
+        } else if !os.IsNotExist(err) {
+                return "", err
+        }
+
+        id := uuid.New().String()
+        if err := os.WriteFile(path, []byte(id+"\n"), 0600); err != nil {
+                return "", err
+        }
+        return id, nil
 }
 
 func NewAgent(adminAddr string, cascadePort int) *Agent {
@@ -36,28 +81,124 @@ func NewAgent(adminAddr string, cascadePort int) *Agent {
                 id:          uuid.New().String(),
                 adminAddr:   adminAddr,
                 relayMap:    make(map[string]*yamux.Session),
-                tlsConfig:   tlsutil.GetClientTLSConfig(),
+                routes:      make(map[string]string),
+                descendants: make(map[string]*pb.RegisterPayload),
+                processes:   make(map[int]func() error),
+                tlsConfig:   tlsutil.GetClientTLSConfig(""),
                 cascadePort: cascadePort,
+                stop:        make(chan struct{}),
+        }
+}
+
+// SetID replaces the randomly generated agent ID.
+func (a *Agent) SetID(id string) {
+        a.id = id
+}
+
+// SetRegistrationSecret signs registrations with the secret shared with the
+// admin.
+func (a *Agent) SetRegistrationSecret(secret string) {
+        a.secret = secret
+}
+
+// SetPinnedFingerprint makes the agent verify the SPKI SHA-256 fingerprint
+// of the admin, or of the parent agent's cascade listener.
+func (a *Agent) SetPinnedFingerprint(fingerprint string) {
+        tlsConfig := tlsutil.GetClientTLSConfig(fingerprint)
+        tlsConfig.Certificates = a.tlsConfig.Certificates
+        a.tlsConfig = tlsConfig
+}
+
+// SetClientCertificate presents the key pair to the admin or parent agent.
+// The certificate's common name is used as the agent ID, since peers
+// requiring mutual TLS bind the connection to it.
+func (a *Agent) SetClientCertificate(certFile, keyFile string) error {
+        commonName, err := tlsutil.LoadClientCertificate(a.tlsConfig, certFile, keyFile)
+        if err != nil {
+                return err
+        }
+
+        if commonName != "" {
+                a.id = commonName
+        }
+        return nil
+}
+
+// SetCascadeCertificate serves the cascade listener with the key pair in
+// certFile and keyFile, generating and saving one if both are missing, so
+// child agents can keep pinning the same fingerprint across restarts.
+func (a *Agent) SetCascadeCertificate(certFile, keyFile string) error {
+        if _, err := tlsutil.LoadOrGenerateCert(certFile, keyFile); err != nil {
+                return err
         }
+
+        a.cascadeCertFile = certFile
+        a.cascadeKeyFile = keyFile
+        return nil
+}
+
+// SetClientCA requires child agents connecting to the cascade listener to
+// present a client certificate issued by a CA in caFile.
+func (a *Agent) SetClientCA(caFile string) {
+        a.clientCAFile = caFile
 }
 
 func (a *Agent) Start() error {
+        go a.enforceLifetime()
+
         for {
+                if a.expired() {
+                        log.Printf("Kill date has passed, not reconnecting")
+                        a.Shutdown()
+                        return nil
+                }
+                if !a.waitForWorkingHours() {
+                        return nil
+                }
+
                 if err := a.connect(); err != nil {
                         log.Printf("Connection failed: %v, retrying in 5s...", err)
-                        time.Sleep(5 * time.Second)
+                        if !a.sleep(5 * time.Second) {
+                                return nil
+                        }
                         continue
                 }
+                go a.replayDescendants()
 
                 if a.cascadePort > 0 {
                         go a.startCascadeListener()
                 }
 
                 if err := a.run(); err != nil {
+                        if a.stopped() {
+                                log.Printf("Agent %s stopped", a.id)
+                                return nil
+                        }
                         log.Printf("Agent error: %v, reconnecting...", err)
                 }
 
-                time.Sleep(5 * time.Second)
+                if !a.sleep(5 * time.Second) {
+                        return nil
+                }
+        }
+}
+
+// sleep waits for d and reports false if the agent was shut down meanwhile.
+func (a *Agent) sleep(d time.Duration) bool {
+        select {
+        case <-a.stop:
+                return false
+        case <-time.After(d):
+                return true
+        }
+}
+
+func (a *Agent) stopped() bool {
+        select {
+        case <-a.stop:
+                return true
+        default:
+                return false
         }
 }
 
@@ -73,8 +214,10 @@ func (a *Agent) connect() error {
                 return fmt.Errorf("failed to create yamux session: %v", err)
         }
 
+        a.mu.Lock()
         a.conn = conn
         a.session = session
+        a.mu.Unlock()
 
         if err := a.register(); err != nil {
                 session.Close()
@@ -87,7 +230,7 @@ func (a *Agent) connect() error {
 }
 
 func (a *Agent) register() error {
-        stream, err := a.session.OpenStream()
+        stream, err := a.parentSession().OpenStream()
         if err != nil {
                 return err
         }
@@ -97,11 +240,29 @@ func (a *Agent) register() error {
         localIPs := a.getLocalIPs()
 
         regPayload := &pb.RegisterPayload{
-                AgentId:  a.id,
-                Hostname: hostname,
-                LocalIps: localIPs,
-                Os:       runtime.GOOS,
-                Arch:     runtime.GOARCH,
+                AgentId:         a.id,
+                Hostname:        hostname,
+                LocalIps:        localIPs,
+                LocalNetworks:   a.getLocalNetworks(),
+                Os:              runtime.GOOS,
+                Arch:            runtime.GOARCH,
+                ProtocolVersion: protocol.Version,
+                Capabilities:    capabilities(),
+        }
+        a.registerLifetime(regPayload)
+
+        if a.cascadePort > 0 {
+                fingerprint, err := a.cascadeFingerprint()
+                if err != nil {
+                        return err
+                }
+                regPayload.CascadeFingerprint = fingerprint
+        }
+
+        if a.secret != "" {
+                if err := auth.SignRegistration(a.secret, regPayload); err != nil {
+                        return err
+                }
         }
 
         payload, err := proto.Marshal(regPayload)
@@ -127,10 +288,14 @@ func (a *Agent) register() error {
                 return err
         }
 
-        if ackMsg.Type != pb.MessageType_COMMAND || string(ackMsg.Payload) != "OK" {
+        if ackMsg.Type != pb.MessageType_COMMAND {
                 return fmt.Errorf("registration failed")
         }
 
+        if string(ackMsg.Payload) != "OK" {
+                return fmt.Errorf("registration rejected by admin: %s", strings.TrimPrefix(string(ackMsg.Payload), "REJECTED: "))
+        }
+
         return nil
 }
 
@@ -138,7 +303,7 @@ func (a *Agent) run() error {
         go a.heartbeatLoop()
 
         for {
-                stream, err := a.session.AcceptStream()
+                stream, err := a.parentSession().AcceptStream()
                 if err != nil {
                         return fmt.Errorf("failed to accept stream: %v", err)
                 }
@@ -169,6 +334,30 @@ func (a *Agent) handleStream(stream net.Conn) {
         case pb.MessageType_RELAY:
                 a.handleRelay(msg, stream)
 
+        case pb.MessageType_TUNNEL:
+                a.handleTunnel(msg, stream)
+
+        case pb.MessageType_UDP:
+                a.handleUDP(msg, stream)
+
+        case pb.MessageType_BIND:
+                a.handleBind(msg, stream)
+
+        case pb.MessageType_REVERSE_LISTEN:
+                a.handleReverseListen(msg, stream)
+
+        case pb.MessageType_EXEC:
+                a.handleExec(msg, stream)
+
+        case pb.MessageType_SHELL:
+                a.handleShell(msg, stream)
+
+        case pb.MessageType_FILE:
+                a.handleFile(msg, stream)
+
+        case pb.MessageType_SHUTDOWN:
+                a.handleShutdown(msg, stream)
+
         case pb.MessageType_DATA:
                 log.Printf("Data received: %d bytes", len(msg.Payload))
 
@@ -177,27 +366,6 @@ func (a *Agent) handleStream(stream net.Conn) {
         }
 }
 
-func (a *Agent) handleCommand(msg *pb.Message, stream net.Conn) {
-        cmdPayload := &pb.CommandPayload{}
-        if err := proto.Unmarshal(msg.Payload, cmdPayload); err != nil {
-                log.Printf("Failed to unmarshal command: %v", err)
-                return
-        }
-
-        log.Printf("Command received: %s %v", cmdPayload.Command, cmdPayload.Args)
-
-        response := &pb.Message{
-                Type:      pb.MessageType_DATA,
-                SessionId: msg.SessionId,
-                SourceId:  a.id,
-                TargetId:  msg.SourceId,
-                Timestamp: time.Now().Unix(),
-                Payload:   []byte("Command executed"),
-        }
-
-        protocol.WriteMessage(stream, response)
-}
-
 func (a *Agent) handleConnect(msg *pb.Message, stream net.Conn) {
         connectPayload := &pb.ConnectPayload{}
         if err := proto.Unmarshal(msg.Payload, connectPayload); err != nil {
@@ -208,34 +376,15 @@ func (a *Agent) handleConnect(msg *pb.Message, stream net.Conn) {
         // Check if this agent is the target or if we need to forward to a child
         if connectPayload.TargetAgentId != a.id {
                 // Need to forward to a child agent
-                a.mu.Lock()
-                // First check if the target is a direct child
-                childSession, exists := a.relayMap[connectPayload.TargetAgentId]
-                
-                // If not a direct child, select any available child to forward the request
-                // The child will recursively handle the request until it reaches the target
-                if !exists && len(a.relayMap) > 0 {
-                        for childID, session := range a.relayMap {
-                                log.Printf("Target %s is not a direct child, forwarding via %s", 
-                                        connectPayload.TargetAgentId, childID)
-                                childSession = session
-                                exists = true
-                                break
-                        }
-                }
-                a.mu.Unlock()
+                childSession, exists := a.childSessionFor(connectPayload.TargetAgentId)
 
                 if !exists {
                         log.Printf("No children available to forward connect to %s", connectPayload.TargetAgentId)
-                        response := &pb.Message{
-                                Type:      pb.MessageType_DATA,
-                                SessionId: msg.SessionId,
-                                SourceId:  a.id,
-                                TargetId:  msg.SourceId,
-                                Timestamp: time.Now().Unix(),
-                                Payload:   []byte("Failed"),
-                        }
-                        protocol.WriteMessage(stream, response)
+                        a.sendConnectResult(stream, msg, &pb.ConnectResult{
+                                Error:     pb.ConnectError_CONNECT_NO_ROUTE,
+                                FailedHop: a.id,
+                                Message:   fmt.Sprintf("no route to agent %s", connectPayload.TargetAgentId),
+                        })
                         return
                 }
 
@@ -243,15 +392,11 @@ func (a *Agent) handleConnect(msg *pb.Message, stream net.Conn) {
                 childStream, err := childSession.OpenStream()
                 if err != nil {
                         log.Printf("Failed to open stream to child: %v", err)
-                        response := &pb.Message{
-                                Type:      pb.MessageType_DATA,
-                                SessionId: msg.SessionId,
-                                SourceId:  a.id,
-                                TargetId:  msg.SourceId,
-                                Timestamp: time.Now().Unix(),
-                                Payload:   []byte("Failed"),
-                        }
-                        protocol.WriteMessage(stream, response)
+                        a.sendConnectResult(stream, msg, &pb.ConnectResult{
+                                Error:     pb.ConnectError_CONNECT_NO_ROUTE,
+                                FailedHop: a.id,
+                                Message:   err.Error(),
+                        })
                         return
                 }
                 defer childStream.Close()
@@ -259,15 +404,11 @@ func (a *Agent) handleConnect(msg *pb.Message, stream net.Conn) {
                 // Forward the message
                 if err := protocol.WriteMessage(childStream, msg); err != nil {
                         log.Printf("Failed to forward connect to child: %v", err)
-                        response := &pb.Message{
-                                Type:      pb.MessageType_DATA,
-                                SessionId: msg.SessionId,
-                                SourceId:  a.id,
-                                TargetId:  msg.SourceId,
-                                Timestamp: time.Now().Unix(),
-                                Payload:   []byte("Failed"),
-                        }
-                        protocol.WriteMessage(stream, response)
+                        a.sendConnectResult(stream, msg, &pb.ConnectResult{
+                                Error:     pb.ConnectError_CONNECT_NO_ROUTE,
+                                FailedHop: a.id,
+                                Message:   err.Error(),
+                        })
                         return
                 }
 
@@ -275,15 +416,11 @@ func (a *Agent) handleConnect(msg *pb.Message, stream net.Conn) {
                 childResponse, err := protocol.ReadMessage(childStream)
                 if err != nil {
                         log.Printf("Failed to read response from child: %v", err)
-                        response := &pb.Message{
-                                Type:      pb.MessageType_DATA,
-                                SessionId: msg.SessionId,
-                                SourceId:  a.id,
-                                TargetId:  msg.SourceId,
-                                Timestamp: time.Now().Unix(),
-                                Payload:   []byte("Failed"),
-                        }
-                        protocol.WriteMessage(stream, response)
+                        a.sendConnectResult(stream, msg, &pb.ConnectResult{
+                                Error:     pb.ConnectError_CONNECT_GENERAL_FAILURE,
+                                FailedHop: a.id,
+                                Message:   err.Error(),
+                        })
                         return
                 }
 
@@ -293,8 +430,9 @@ func (a *Agent) handleConnect(msg *pb.Message, stream net.Conn) {
                         return
                 }
 
-                if string(childResponse.Payload) != "Connected" {
-                        log.Printf("Child connection failed")
+                result, err := protocol.ParseConnectResponse(childResponse)
+                if err != nil || result.Error != pb.ConnectError_CONNECT_OK {
+                        log.Printf("Child connection failed: %v", result.GetError())
                         return
                 }
 
@@ -319,35 +457,32 @@ func (a *Agent) handleConnect(msg *pb.Message, stream net.Conn) {
         }
 
         // This agent is the target, connect to the actual destination
-        targetAddr := fmt.Sprintf("%s:%d", connectPayload.TargetAddress, connectPayload.TargetPort)
+        targetAddr := net.JoinHostPort(connectPayload.TargetAddress, strconv.Itoa(int(connectPayload.TargetPort)))
         log.Printf("Connecting to %s", targetAddr)
 
+        if !a.inScope(msg, "tcp", connectPayload.TargetAddress, int(connectPayload.TargetPort)) {
+                a.sendConnectResult(stream, msg, a.outOfScope())
+                return
+        }
+
         targetConn, err := net.DialTimeout("tcp", targetAddr, 10*time.Second)
         if err != nil {
                 log.Printf("Failed to connect to target: %v", err)
-                response := &pb.Message{
-                        Type:      pb.MessageType_DATA,
-                        SessionId: msg.SessionId,
-                        SourceId:  a.id,
-                        TargetId:  msg.SourceId,
-                        Timestamp: time.Now().Unix(),
-                        Payload:   []byte("Failed"),
-                }
-                protocol.WriteMessage(stream, response)
+                a.sendConnectResult(stream, msg, &pb.ConnectResult{
+                        Error:     dialError(err),
+                        FailedHop: a.id,
+                        Message:   err.Error(),
+                })
                 return
         }
         defer targetConn.Close()
 
-        response := &pb.Message{
-                Type:      pb.MessageType_DATA,
-                SessionId: msg.SessionId,
-                SourceId:  a.id,
-                TargetId:  msg.SourceId,
-                Timestamp: time.Now().Unix(),
-                Payload:   []byte("Connected"),
-        }
-
-        if err := protocol.WriteMessage(stream, response); err != nil {
+        localAddr := targetConn.LocalAddr().(*net.TCPAddr)
+        if err := a.sendConnectResult(stream, msg, &pb.ConnectResult{
+                Error:        pb.ConnectError_CONNECT_OK,
+                BoundAddress: localAddr.IP.String(),
+                BoundPort:    int32(localAddr.Port),
+        }); err != nil {
                 log.Printf("Failed to send connect response: %v", err)
                 return
         }
@@ -370,29 +505,488 @@ func (a *Agent) handleConnect(msg *pb.Message, stream net.Conn) {
         log.Printf("Tunnel closed to %s", targetAddr)
 }
 
-func (a *Agent) handleRelay(msg *pb.Message, stream net.Conn) {
-        if msg.TargetId == a.id {
-                a.handleCommand(msg, stream)
-                return
+// childSessionFor returns the cascade session that leads towards targetID,
+// either a direct child or the child a descendant registered through.
+func (a *Agent) childSessionFor(targetID string) (*yamux.Session, bool) {
+        a.mu.Lock()
+        defer a.mu.Unlock()
+
+        if session, exists := a.relayMap[targetID]; exists {
+                return session, true
         }
 
-        a.mu.Lock()
-        relaySession, exists := a.relayMap[msg.TargetId]
-        a.mu.Unlock()
+        childID, exists := a.routes[targetID]
+        if !exists {
+                log.Printf("No route to %s", targetID)
+                return nil, false
+        }
 
+        session, exists := a.relayMap[childID]
+        return session, exists
+}
+
+func (a *Agent) sendConnectResult(stream net.Conn, msg *pb.Message, result *pb.ConnectResult) error {
+        payload, err := proto.Marshal(result)
+        if err != nil {
+                return err
+        }
+
+        return protocol.WriteMessage(stream, &pb.Message{
+                Type:      pb.MessageType_CONNECT_RESULT,
+                SessionId: msg.SessionId,
+                SourceId:  a.id,
+                TargetId:  msg.SourceId,
+                Timestamp: time.Now().Unix(),
+                Payload:   payload,
+        })
+}
+
+// dialError classifies a failed dial so the admin can pick a SOCKS5 reply.
+func dialError(err error) pb.ConnectError {
+        var dnsErr *net.DNSError
+        var netErr net.Error
+        switch {
+        case errors.As(err, &dnsErr):
+                return pb.ConnectError_CONNECT_DNS_FAILURE
+        case errors.As(err, &netErr) && netErr.Timeout():
+                return pb.ConnectError_CONNECT_TIMEOUT
+        case errors.Is(err, syscall.ECONNREFUSED):
+                return pb.ConnectError_CONNECT_REFUSED
+        case errors.Is(err, syscall.EHOSTUNREACH):
+                return pb.ConnectError_CONNECT_HOST_UNREACHABLE
+        case errors.Is(err, syscall.ENETUNREACH):
+                return pb.ConnectError_CONNECT_NETWORK_UNREACHABLE
+        case errors.Is(err, syscall.EACCES), errors.Is(err, syscall.EPERM):
+                return pb.ConnectError_CONNECT_NOT_ALLOWED
+        default:
+                return pb.ConnectError_CONNECT_GENERAL_FAILURE
+        }
+}
+
+// forwardStream passes msg to the child leading towards msg.TargetId and then
+// splices the parent stream with the child stream until either side closes.
+func (a *Agent) forwardStream(msg *pb.Message, stream net.Conn) {
+        childSession, exists := a.childSessionFor(msg.TargetId)
         if !exists {
-                log.Printf("No relay session for target %s", msg.TargetId)
+                log.Printf("No children available to forward %v to %s", msg.Type, msg.TargetId)
                 return
         }
 
-        relayStream, err := relaySession.OpenStream()
+        childStream, err := childSession.OpenStream()
         if err != nil {
-                log.Printf("Failed to open relay stream: %v", err)
+                log.Printf("Failed to open stream to child: %v", err)
+                return
+        }
+        defer childStream.Close()
+
+        if err := protocol.WriteMessage(childStream, msg); err != nil {
+                log.Printf("Failed to forward %v to child: %v", msg.Type, err)
+                return
+        }
+
+        splice(childStream, stream)
+}
+
+// handleTunnel terminates an L3 tunnel from the admin TUN interface. Every
+// DATA message on the stream carries one IP packet; reply packets produced by
+// the userspace stack are written back the same way.
+func (a *Agent) handleTunnel(msg *pb.Message, stream net.Conn) {
+        if msg.TargetId != a.id {
+                a.forwardStream(msg, stream)
                 return
         }
-        defer relayStream.Close()
 
-        protocol.WriteMessage(relayStream, msg)
+        var writeMu sync.Mutex
+        ns, err := netstack.New(func(packet []byte) error {
+                payload, err := proto.Marshal(&pb.DataPayload{Data: packet})
+                if err != nil {
+                        return err
+                }
+
+                writeMu.Lock()
+                defer writeMu.Unlock()
+                return protocol.WriteMessage(stream, &pb.Message{
+                        Type:      pb.MessageType_DATA,
+                        SessionId: msg.SessionId,
+                        SourceId:  a.id,
+                        TargetId:  msg.SourceId,
+                        Timestamp: time.Now().Unix(),
+                        Payload:   payload,
+                })
+        })
+        if err != nil {
+                log.Printf("Failed to start netstack: %v", err)
+                return
+        }
+        defer ns.Close()
+
+        ns.SetFilter(func(network, host string, port int) bool {
+                return a.inScope(msg, network, host, port)
+        })
+
+        log.Printf("L3 tunnel %s established", msg.SessionId)
+
+        for {
+                packetMsg, err := protocol.ReadMessage(stream)
+                if err != nil {
+                        log.Printf("L3 tunnel %s closed: %v", msg.SessionId, err)
+                        return
+                }
+
+                if packetMsg.Type != pb.MessageType_DATA {
+                        continue
+                }
+
+                dataPayload := &pb.DataPayload{}
+                if err := proto.Unmarshal(packetMsg.Payload, dataPayload); err != nil {
+                        log.Printf("Failed to unmarshal tunnel packet: %v", err)
+                        continue
+                }
+
+                ns.Inject(dataPayload.Data)
+        }
+}
+
+// handleUDP serves a SOCKS5 UDP association. Each UDP message on the stream
+// is sent from a local UDP socket, and datagrams received on that socket are
+// returned with their source address.
+func (a *Agent) handleUDP(msg *pb.Message, stream net.Conn) {
+        if msg.TargetId != a.id {
+                a.forwardStream(msg, stream)
+                return
+        }
+
+        udpConn, err := net.ListenPacket("udp", ":0")
+        if err != nil {
+                log.Printf("Failed to open UDP socket: %v", err)
+                return
+        }
+        defer udpConn.Close()
+
+        log.Printf("UDP association %s opened on %s", msg.SessionId, udpConn.LocalAddr())
+
+        go func() {
+                buf := make([]byte, 65535)
+                for {
+                        n, from, err := udpConn.ReadFrom(buf)
+                        if err != nil {
+                                return
+                        }
+
+                        fromAddr := from.(*net.UDPAddr)
+                        payload, err := proto.Marshal(&pb.UdpPayload{
+                                Address: fromAddr.IP.String(),
+                                Port:    int32(fromAddr.Port),
+                                Data:    buf[:n],
+                        })
+                        if err != nil {
+                                continue
+                        }
+
+                        if err := protocol.WriteMessage(stream, &pb.Message{
+                                Type:      pb.MessageType_UDP,
+                                SessionId: msg.SessionId,
+                                SourceId:  a.id,
+                                TargetId:  msg.SourceId,
+                                Timestamp: time.Now().Unix(),
+                                Payload:   payload,
+                        }); err != nil {
+                                return
+                        }
+                }
+        }()
+
+        for {
+                datagramMsg, err := protocol.ReadMessage(stream)
+                if err != nil {
+                        log.Printf("UDP association %s closed: %v", msg.SessionId, err)
+                        return
+                }
+
+                udpPayload := &pb.UdpPayload{}
+                if datagramMsg.Type != pb.MessageType_UDP || proto.Unmarshal(datagramMsg.Payload, udpPayload) != nil {
+                        continue
+                }
+
+                if !a.inScope(msg, "udp", udpPayload.Address, int(udpPayload.Port)) {
+                        continue
+                }
+
+                targetAddr := net.JoinHostPort(udpPayload.Address, strconv.Itoa(int(udpPayload.Port)))
+                addr, err := net.ResolveUDPAddr("udp", targetAddr)
+                if err != nil {
+                        log.Printf("Failed to resolve UDP target %s: %v", targetAddr, err)
+                        continue
+                }
+
+                if _, err := udpConn.WriteTo(udpPayload.Data, addr); err != nil {
+                        log.Printf("Failed to send UDP datagram to %s: %v", targetAddr, err)
+                }
+        }
+}
+
+// handleBind serves a SOCKS5 BIND request. The agent listens on the address
+// it would use to reach the expected peer, reports it, and splices the first
+// inbound connection with the stream.
+func (a *Agent) handleBind(msg *pb.Message, stream net.Conn) {
+        if msg.TargetId != a.id {
+                a.forwardStream(msg, stream)
+                return
+        }
+
+        connectPayload := &pb.ConnectPayload{}
+        if err := proto.Unmarshal(msg.Payload, connectPayload); err != nil {
+                log.Printf("Failed to unmarshal bind payload: %v", err)
+                return
+        }
+
+        sendFailure := func(code pb.ConnectError, err error) {
+                a.sendConnectResult(stream, msg, &pb.ConnectResult{
+                        Error:     code,
+                        FailedHop: a.id,
+                        Message:   err.Error(),
+                })
+        }
+
+        sendBound := func(addr *net.TCPAddr) error {
+                payload, err := proto.Marshal(&pb.BindPayload{
+                        Address: addr.IP.String(),
+                        Port:    int32(addr.Port),
+                })
+                if err != nil {
+                        return err
+                }
+
+                return protocol.WriteMessage(stream, &pb.Message{
+                        Type:      pb.MessageType_BIND,
+                        SessionId: msg.SessionId,
+                        SourceId:  a.id,
+                        TargetId:  msg.SourceId,
+                        Timestamp: time.Now().Unix(),
+                        Payload:   payload,
+                })
+        }
+
+        if ip := net.ParseIP(connectPayload.TargetAddress); ip == nil || !ip.IsUnspecified() {
+                if !a.inScope(msg, "tcp", connectPayload.TargetAddress, int(connectPayload.TargetPort)) {
+                        a.sendConnectResult(stream, msg, a.outOfScope())
+                        return
+                }
+        }
+
+        bindIP := a.routeIP(connectPayload.TargetAddress, connectPayload.TargetPort)
+        listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: bindIP})
+        if err != nil {
+                log.Printf("Failed to open BIND listener on %s: %v", bindIP, err)
+                sendFailure(pb.ConnectError_CONNECT_GENERAL_FAILURE, err)
+                return
+        }
+        defer listener.Close()
+
+        boundAddr := listener.Addr().(*net.TCPAddr)
+        if err := sendBound(boundAddr); err != nil {
+                log.Printf("Failed to send bind response: %v", err)
+                return
+        }
+
+        log.Printf("BIND listener %s waiting for %s:%d", boundAddr, connectPayload.TargetAddress, connectPayload.TargetPort)
+
+        // RFC 1928 section 4: only the peer named in DST.ADDR may connect.
+        // Anyone else is turned away and the listener keeps waiting.
+        listener.SetDeadline(time.Now().Add(bindTimeout))
+        var peerConn net.Conn
+        for {
+                conn, err := listener.Accept()
+                if err != nil {
+                        log.Printf("BIND accept failed: %v", err)
+                        if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+                                sendFailure(pb.ConnectError_CONNECT_TIMEOUT, err)
+                        } else {
+                                sendFailure(pb.ConnectError_CONNECT_GENERAL_FAILURE, err)
+                        }
+                        return
+                }
+                if expectedPeer(connectPayload.TargetAddress, conn.RemoteAddr().(*net.TCPAddr).IP) {
+                        peerConn = conn
+                        break
+                }
+                log.Printf("BIND rejected connection from %s, expected %s", conn.RemoteAddr(), connectPayload.TargetAddress)
+                conn.Close()
+        }
+        defer peerConn.Close()
+
+        // The expected peer may be unspecified, so check whoever connected
+        if !a.inScope(msg, "tcp", peerConn.RemoteAddr().(*net.TCPAddr).IP.String(), 0) {
+                a.sendConnectResult(stream, msg, a.outOfScope())
+                return
+        }
+
+        if err := sendBound(peerConn.RemoteAddr().(*net.TCPAddr)); err != nil {
+                log.Printf("Failed to send bind response: %v", err)
+                return
+        }
+
+        log.Printf("BIND connection accepted from %s", peerConn.RemoteAddr())
+
+        splice(peerConn, stream)
+        log.Printf("BIND tunnel closed for %s", peerConn.RemoteAddr())
+}
+
+// expectedPeer reports whether peer may answer a BIND request for host. An
+// unspecified host accepts anyone; a hostname accepts any of its addresses.
+func expectedPeer(host string, peer net.IP) bool {
+        if ip := net.ParseIP(host); ip != nil {
+                return ip.IsUnspecified() || ip.Equal(peer)
+        }
+
+        addrs, err := net.LookupIP(host)
+        if err != nil {
+                return false
+        }
+        for _, addr := range addrs {
+                if addr.Equal(peer) {
+                        return true
+                }
+        }
+        return false
+}
+
+// routeIP returns the local address this host would use to reach host:port.
+// When the peer is unknown the first non-loopback address is used instead.
+func (a *Agent) routeIP(host string, port int32) net.IP {
+        if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+                if localIPs := a.getLocalIPs(); len(localIPs) > 0 {
+                        return net.ParseIP(localIPs[0])
+                }
+                return net.IPv4zero
+        }
+
+        conn, err := net.Dial("udp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+        if err != nil {
+                return net.IPv4zero
+        }
+        defer conn.Close()
+
+        return conn.LocalAddr().(*net.UDPAddr).IP
+}
+
+// handleReverseListen opens a listener for a reverse port forward. The
+// listener lives as long as the admin keeps the control stream open; every
+// inbound connection is carried back to the admin on a new stream.
+func (a *Agent) handleReverseListen(msg *pb.Message, stream net.Conn) {
+        if msg.TargetId != a.id {
+                a.forwardStream(msg, stream)
+                return
+        }
+
+        fwdPayload := &pb.ReverseForwardPayload{}
+        if err := proto.Unmarshal(msg.Payload, fwdPayload); err != nil {
+                log.Printf("Failed to unmarshal reverse forward payload: %v", err)
+                return
+        }
+
+        listenAddr := net.JoinHostPort(fwdPayload.Address, strconv.Itoa(int(fwdPayload.Port)))
+        listener, err := net.Listen("tcp", listenAddr)
+        if err != nil {
+                log.Printf("Failed to start reverse forward listener on %s: %v", listenAddr, err)
+                a.sendConnectResult(stream, msg, &pb.ConnectResult{
+                        Error:     pb.ConnectError_CONNECT_GENERAL_FAILURE,
+                        FailedHop: a.id,
+                        Message:   err.Error(),
+                })
+                return
+        }
+        defer listener.Close()
+
+        boundAddr := listener.Addr().(*net.TCPAddr)
+        payload, err := proto.Marshal(&pb.ReverseForwardPayload{
+                ForwardId: fwdPayload.ForwardId,
+                Address:   boundAddr.IP.String(),
+                Port:      int32(boundAddr.Port),
+        })
+        if err != nil {
+                return
+        }
+
+        if err := protocol.WriteMessage(stream, &pb.Message{
+                Type:      pb.MessageType_REVERSE_LISTEN,
+                SessionId: msg.SessionId,
+                SourceId:  a.id,
+                TargetId:  msg.SourceId,
+                Timestamp: time.Now().Unix(),
+                Payload:   payload,
+        }); err != nil {
+                log.Printf("Failed to send reverse forward response: %v", err)
+                return
+        }
+
+        log.Printf("Reverse forward %s listening on %s", fwdPayload.ForwardId, boundAddr)
+
+        // Closing the control stream stops the forward
+        go func() {
+                io.Copy(io.Discard, stream)
+                listener.Close()
+        }()
+
+        for {
+                conn, err := listener.Accept()
+                if err != nil {
+                        log.Printf("Reverse forward %s stopped: %v", fwdPayload.ForwardId, err)
+                        return
+                }
+
+                go a.handleReverseConnection(fwdPayload.ForwardId, conn)
+        }
+}
+
+func (a *Agent) handleReverseConnection(forwardID string, conn net.Conn) {
+        defer conn.Close()
+
+        peerAddr := conn.RemoteAddr().(*net.TCPAddr)
+        payload, err := proto.Marshal(&pb.ReverseForwardPayload{
+                ForwardId: forwardID,
+                Address:   peerAddr.IP.String(),
+                Port:      int32(peerAddr.Port),
+        })
+        if err != nil {
+                return
+        }
+
+        parentStream, err := a.parentSession().OpenStream()
+        if err != nil {
+                log.Printf("Failed to open reverse forward stream: %v", err)
+                return
+        }
+        defer parentStream.Close()
+
+        msg := &pb.Message{
+                Type:      pb.MessageType_REVERSE_CONNECT,
+                SessionId: uuid.New().String(),
+                SourceId:  a.id,
+                TargetId:  "admin",
+                Timestamp: time.Now().Unix(),
+                Payload:   payload,
+        }
+
+        if err := protocol.WriteMessage(parentStream, msg); err != nil {
+                log.Printf("Failed to send reverse connect: %v", err)
+                return
+        }
+
+        log.Printf("Reverse forward %s: connection from %s", forwardID, peerAddr)
+
+        splice(parentStream, conn)
+        log.Printf("Reverse forward %s: connection from %s closed", forwardID, peerAddr)
+}
+
+func (a *Agent) handleRelay(msg *pb.Message, stream net.Conn) {
+        if msg.TargetId == a.id {
+                a.handleCommand(msg, stream)
+                return
+        }
+
+        // Keep the stream open so the target's response flows back
+        a.forwardStream(msg, stream)
 }
 
 func (a *Agent) heartbeatLoop() {
@@ -408,7 +1002,7 @@ func (a *Agent) heartbeatLoop() {
 }
 
 func (a *Agent) sendHeartbeat() error {
-        stream, err := a.session.OpenStream()
+        stream, err := a.parentSession().OpenStream()
         if err != nil {
                 return err
         }
@@ -441,6 +1035,27 @@ func (a *Agent) sendHeartbeat() error {
         return err
 }
 
+// getLocalNetworks returns the IPv4 subnets of the non-loopback interfaces,
+// which the admin uses to route destinations to this agent.
+func (a *Agent) getLocalNetworks() []string {
+        networks := []string{}
+        addrs, err := net.InterfaceAddrs()
+        if err != nil {
+                return networks
+        }
+
+        for _, addr := range addrs {
+                if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
+                        if ip4 := ipnet.IP.To4(); ip4 != nil {
+                                network := &net.IPNet{IP: ip4.Mask(ipnet.Mask), Mask: ipnet.Mask}
+                                networks = append(networks, network.String())
+                        }
+                }
+        }
+
+        return networks
+}
+
 func (a *Agent) getLocalIPs() []string {
         ips := []string{}
         addrs, err := net.InterfaceAddrs()
@@ -460,20 +1075,58 @@ func (a *Agent) getLocalIPs() []string {
 }
 
 func (a *Agent) Close() error {
-        if a.cascadeListener != nil {
-                a.cascadeListener.Close()
+        a.mu.Lock()
+        cascadeListener, session, conn := a.cascadeListener, a.session, a.conn
+        a.mu.Unlock()
+
+        if cascadeListener != nil {
+                cascadeListener.Close()
         }
-        if a.session != nil {
-                a.session.Close()
+        if session != nil {
+                session.Close()
         }
-        if a.conn != nil {
-                a.conn.Close()
+        if conn != nil {
+                conn.Close()
         }
         return nil
 }
 
+// parentSession returns the session to the admin or parent agent, which
+// connect replaces after every reconnect.
+func (a *Agent) parentSession() *yamux.Session {
+        a.mu.Lock()
+        defer a.mu.Unlock()
+        return a.session
+}
+
+// cascadeTLSConfig returns the server configuration of the cascade listener.
+// The certificate is generated once so that children can pin it.
+func (a *Agent) cascadeTLSConfig() (*tls.Config, error) {
+        a.mu.Lock()
+        defer a.mu.Unlock()
+
+        if a.cascadeTLS == nil {
+                tlsConfig, err := tlsutil.GetServerTLSConfig(a.cascadeCertFile, a.cascadeKeyFile, a.clientCAFile)
+                if err != nil {
+                        return nil, err
+                }
+                a.cascadeTLS = tlsConfig
+        }
+
+        return a.cascadeTLS, nil
+}
+
+func (a *Agent) cascadeFingerprint() (string, error) {
+        tlsConfig, err := a.cascadeTLSConfig()
+        if err != nil {
+                return "", fmt.Errorf("failed to setup TLS for cascade: %v", err)
+        }
+
+        return tlsutil.Fingerprint(tlsConfig.Certificates[0])
+}
+
 func (a *Agent) startCascadeListener() error {
-        tlsConfig, err := tlsutil.GetServerTLSConfig("", "")
+        tlsConfig, err := a.cascadeTLSConfig()
         if err != nil {
                 return fmt.Errorf("failed to setup TLS for cascade: %v", err)
         }
@@ -483,8 +1136,11 @@ func (a *Agent) startCascadeListener() error {
                 return fmt.Errorf("failed to start cascade listener: %v", err)
         }
 
+        a.mu.Lock()
         a.cascadeListener = listener
-        log.Printf("Cascade listener started on port %d", a.cascadePort)
+        a.mu.Unlock()
+        fingerprint, _ := tlsutil.Fingerprint(tlsConfig.Certificates[0])
+        log.Printf("Cascade listener started on port %d (fingerprint %s)", a.cascadePort, fingerprint)
 
         for {
                 conn, err := listener.Accept()
@@ -500,6 +1156,12 @@ func (a *Agent) startCascadeListener() error {
 func (a *Agent) handleCascadeConnection(conn net.Conn) {
         defer conn.Close()
 
+        identity, err := tlsutil.PeerIdentity(conn)
+        if err != nil {
+                log.Printf("Cascade TLS handshake with %s failed: %v", conn.RemoteAddr(), err)
+                return
+        }
+
         childSession, err := yamux.Server(conn, nil)
         if err != nil {
                 log.Printf("Failed to create yamux session for cascade: %v", err)
@@ -532,19 +1194,41 @@ func (a *Agent) handleCascadeConnection(conn net.Conn) {
         }
 
         childID := regPayload.AgentId
+        if err := a.verifyChildIdentity(identity, childID); err != nil {
+                log.Printf("Rejected child agent %s from %s: %v", childID, conn.RemoteAddr(), err)
+                a.rejectChild(stream, msg, childID)
+                return
+        }
         log.Printf("Child agent %s connected via cascade", childID)
 
         a.mu.Lock()
+        previous, reconnected := a.relayMap[childID]
         a.relayMap[childID] = childSession
         a.mu.Unlock()
 
+        // The child restarted before its old connection timed out
+        if reconnected {
+                previous.Close()
+        }
+
         defer func() {
                 a.mu.Lock()
+                defer a.mu.Unlock()
+
+                if a.relayMap[childID] != childSession {
+                        return
+                }
                 delete(a.relayMap, childID)
-                a.mu.Unlock()
+                delete(a.descendants, childID)
+                for descendantID, via := range a.routes {
+                        if via == childID {
+                                delete(a.routes, descendantID)
+                                delete(a.descendants, descendantID)
+                        }
+                }
         }()
 
-        parentStream, err := a.session.OpenStream()
+        parentStream, err := a.parentSession().OpenStream()
         if err != nil {
                 log.Printf("Failed to open stream to admin for child registration: %v", err)
                 return
@@ -581,7 +1265,13 @@ func (a *Agent) handleCascadeConnection(conn net.Conn) {
                 return
         }
 
+        if string(ackMsg.Payload) != "OK" {
+                log.Printf("Child agent %s rejected by admin: %s", childID, strings.TrimPrefix(string(ackMsg.Payload), "REJECTED: "))
+                return
+        }
+
         log.Printf("Child agent %s registered with admin via relay", childID)
+        a.rememberDescendant(regPayload)
 
         for {
                 childStream, err := childSession.AcceptStream()
@@ -610,10 +1300,31 @@ func (a *Agent) relayChildMessage(childID string, childStream net.Conn) {
         if msg.SourceId == "" {
                 msg.SourceId = childID
         }
-        
+
+        // Descendants announce themselves through registrations relayed by
+        // the child, which tells us which branch leads to them. Anything else
+        // must come from a descendant already known to live behind the child.
+        var regPayload *pb.RegisterPayload
+        if msg.Type == pb.MessageType_REGISTER {
+                regPayload = &pb.RegisterPayload{}
+                if err := proto.Unmarshal(msg.Payload, regPayload); err != nil {
+                        log.Printf("Failed to unmarshal descendant register from child %s: %v", childID, err)
+                        return
+                }
+                if !a.claimDescendant(regPayload.AgentId, regPayload.ParentId, childID) {
+                        log.Printf("Rejected registration of %s via child %s: not in its subtree", regPayload.AgentId, childID)
+                        a.rejectChild(childStream, msg, regPayload.AgentId)
+                        return
+                }
+                msg.SourceId = regPayload.AgentId
+        } else if !a.behindChild(msg.SourceId, childID) {
+                log.Printf("Dropped %v message from %s: not behind child %s", msg.Type, msg.SourceId, childID)
+                return
+        }
+
         log.Printf("Relaying %v message from %s via child %s", msg.Type, msg.SourceId, childID)
 
-        parentStream, err := a.session.OpenStream()
+        parentStream, err := a.parentSession().OpenStream()
         if err != nil {
                 log.Printf("Failed to open stream to admin: %v", err)
                 return
@@ -625,6 +1336,12 @@ func (a *Agent) relayChildMessage(childID string, childStream net.Conn) {
                 return
         }
 
+        // Reverse forward connections carry raw data after the first message
+        if msg.Type == pb.MessageType_REVERSE_CONNECT {
+                splice(parentStream, childStream)
+                return
+        }
+
         response, err := protocol.ReadMessage(parentStream)
         if err != nil {
                 log.Printf("Failed to read response from admin: %v", err)
@@ -635,4 +1352,173 @@ func (a *Agent) relayChildMessage(childID string, childStream net.Conn) {
                 log.Printf("Failed to send response to child: %v", err)
                 return
         }
+
+        if regPayload != nil && string(response.Payload) == "OK" {
+                a.rememberDescendant(regPayload)
+        }
+}
+
+// verifyChildIdentity binds a cascade connection to the common name of the
+// child's client certificate when the cascade listener requires one.
+func (a *Agent) verifyChildIdentity(identity, childID string) error {
+        if a.clientCAFile == "" {
+                return nil
+        }
+        if identity == "" || identity != childID {
+                return fmt.Errorf("certificate %q does not match agent ID", identity)
+        }
+        return nil
+}
+
+// behindChild reports whether id is childID or a descendant reached through it.
+func (a *Agent) behindChild(id, childID string) bool {
+        if id == childID {
+                return true
+        }
+
+        a.mu.Lock()
+        defer a.mu.Unlock()
+        return a.routes[id] == childID
+}
+
+// claimDescendant records descendantID as reachable through childID, provided
+// its parent lives behind that child and the ID is not already in use by this
+// agent or another branch.
+func (a *Agent) claimDescendant(descendantID, parentID, childID string) bool {
+        if descendantID == "" || descendantID == a.id || !a.behindChild(parentID, childID) {
+                return false
+        }
+
+        a.mu.Lock()
+        defer a.mu.Unlock()
+
+        if _, direct := a.relayMap[descendantID]; direct {
+                return false
+        }
+        if via, known := a.routes[descendantID]; known && via != childID {
+                return false
+        }
+
+        if a.routes[descendantID] != childID {
+                log.Printf("Route learned: %s via child %s", descendantID, childID)
+                a.routes[descendantID] = childID
+        }
+        return true
+}
+
+// rememberDescendant keeps the registration of an agent in this subtree, so
+// it can be announced again after this agent reconnects to its parent.
+func (a *Agent) rememberDescendant(regPayload *pb.RegisterPayload) {
+        a.mu.Lock()
+        defer a.mu.Unlock()
+        a.descendants[regPayload.AgentId] = regPayload
+}
+
+// replayDescendants registers the agents behind this one again after it
+// reconnected, since the parent forgets every route through a child whose
+// connection dropped. Agents are announced parents first, so each one's
+// parent is already known upstream, and the registrations are signed afresh
+// because the admin refuses reused nonces.
+func (a *Agent) replayDescendants() {
+        a.mu.Lock()
+        pending := make([]*pb.RegisterPayload, 0, len(a.descendants))
+        for _, regPayload := range a.descendants {
+                pending = append(pending, proto.Clone(regPayload).(*pb.RegisterPayload))
+        }
+        a.mu.Unlock()
+
+        announced := map[string]bool{a.id: true}
+        for len(pending) > 0 {
+                var deferred []*pb.RegisterPayload
+                for _, regPayload := range pending {
+                        if !announced[regPayload.ParentId] {
+                                deferred = append(deferred, regPayload)
+                                continue
+                        }
+                        if err := a.replayRegistration(regPayload); err != nil {
+                                log.Printf("Failed to re-register descendant %s: %v", regPayload.AgentId, err)
+                                continue
+                        }
+                        announced[regPayload.AgentId] = true
+                }
+                if len(deferred) == len(pending) {
+                        for _, regPayload := range deferred {
+                                log.Printf("Skipped re-registering %s: parent %s is not registered", regPayload.AgentId, regPayload.ParentId)
+                        }
+                        return
+                }
+                pending = deferred
+        }
+}
+
+func (a *Agent) replayRegistration(regPayload *pb.RegisterPayload) error {
+        if a.secret != "" {
+                if err := auth.SignRegistration(a.secret, regPayload); err != nil {
+                        return err
+                }
+        }
+        payload, err := proto.Marshal(regPayload)
+        if err != nil {
+                return err
+        }
+
+        stream, err := a.parentSession().OpenStream()
+        if err != nil {
+                return err
+        }
+        defer stream.Close()
+
+        err = protocol.WriteMessage(stream, &pb.Message{
+                Type:      pb.MessageType_REGISTER,
+                SessionId: uuid.New().String(),
+                SourceId:  regPayload.AgentId,
+                TargetId:  "admin",
+                Timestamp: time.Now().Unix(),
+                Payload:   payload,
+        })
+        if err != nil {
+                return err
+        }
+
+        ackMsg, err := protocol.ReadMessage(stream)
+        if err != nil {
+                return err
+        }
+        if string(ackMsg.Payload) != "OK" {
+                return fmt.Errorf("%s", strings.TrimPrefix(string(ackMsg.Payload), "REJECTED: "))
+        }
+
+        log.Printf("Descendant %s registered again via %s", regPayload.AgentId, a.id)
+        return nil
+}
+
+func (a *Agent) rejectChild(stream net.Conn, msg *pb.Message, childID string) {
+        rejectMsg := &pb.Message{
+                Type:      pb.MessageType_COMMAND,
+                SessionId: msg.SessionId,
+                SourceId:  a.id,
+                TargetId:  childID,
+                Timestamp: time.Now().Unix(),
+                Payload:   []byte("REJECTED: authentication failed"),
+        }
+        if err := protocol.WriteMessage(stream, rejectMsg); err != nil {
+                log.Printf("Failed to send rejection to child: %v", err)
+        }
+}
+
+// splice copies data between two connections until either side closes.
+func splice(left, right net.Conn) {
+        errChan := make(chan error, 2)
+
+        go func() {
+                _, err := io.Copy(left, right)
+                errChan <- err
+        }()
+
+        go func() {
+                _, err := io.Copy(right, left)
+                errChan <- err
+        }()
+
+        <-errChan
 }
\ No newline at end of file
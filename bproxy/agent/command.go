@@ -0,0 +1,159 @@
+package agent
+
+import (
+        "fmt"
+        "log"
+        "net"
+        "os"
+        "runtime"
+        "sort"
+        "strings"
+        "time"
+
+        pb "github.com/bproxy/bproxy/proto"
+        "github.com/bproxy/bproxy/pkg/protocol"
+        "google.golang.org/protobuf/proto"
+)
+
+const defaultCommandTimeout = 30 * time.Second
+
+// commandHandler implements a built-in command and returns its output.
+type commandHandler func(a *Agent, cmd *pb.CommandPayload) ([]byte, error)
+
+var commands = map[string]commandHandler{
+        "ping":     cmdPing,
+        "info":     cmdInfo,
+        "routes":   cmdRoutes,
+        "lifetime": cmdLifetime,
+}
+
+func (a *Agent) handleCommand(msg *pb.Message, stream net.Conn) {
+        if msg.TargetId != "" && msg.TargetId != a.id {
+                a.forwardStream(msg, stream)
+                return
+        }
+
+        cmdPayload := &pb.CommandPayload{}
+        if err := proto.Unmarshal(msg.Payload, cmdPayload); err != nil {
+                log.Printf("Failed to unmarshal command: %v", err)
+                a.sendCommandResponse(stream, msg, &pb.CommandResponse{
+                        Status: pb.CommandStatus_COMMAND_FAILED,
+                        Error:  fmt.Sprintf("invalid command payload: %v", err),
+                })
+                return
+        }
+
+        // Other agents may relay messages through the admin, but only the
+        // admin itself may run commands
+        if msg.SourceId != "admin" {
+                log.Printf("Refused command %s from %s", cmdPayload.Command, msg.SourceId)
+                a.sendCommandResponse(stream, msg, &pb.CommandResponse{
+                        RequestId: cmdPayload.RequestId,
+                        Status:    pb.CommandStatus_COMMAND_FAILED,
+                        Error:     "commands are only accepted from the admin",
+                })
+                return
+        }
+
+        log.Printf("Command received: %s %v (request %s)", cmdPayload.Command, cmdPayload.Args, cmdPayload.RequestId)
+
+        response := a.runCommand(cmdPayload)
+        response.RequestId = cmdPayload.RequestId
+        if err := a.sendCommandResponse(stream, msg, response); err != nil {
+                log.Printf("Failed to send command response: %v", err)
+        }
+}
+
+// runCommand executes cmd, giving up once its timeout has passed.
+func (a *Agent) runCommand(cmd *pb.CommandPayload) *pb.CommandResponse {
+        handler, exists := commands[cmd.Command]
+        if !exists {
+                return &pb.CommandResponse{
+                        Status: pb.CommandStatus_COMMAND_UNKNOWN,
+                        Error:  fmt.Sprintf("unknown command %q", cmd.Command),
+                }
+        }
+
+        timeout := defaultCommandTimeout
+        if cmd.TimeoutMs > 0 {
+                timeout = time.Duration(cmd.TimeoutMs) * time.Millisecond
+        }
+
+        done := make(chan *pb.CommandResponse, 1)
+        go func() {
+                output, err := handler(a, cmd)
+                if err != nil {
+                        done <- &pb.CommandResponse{
+                                Status: pb.CommandStatus_COMMAND_FAILED,
+                                Output: output,
+                                Error:  err.Error(),
+                        }
+                        return
+                }
+                done <- &pb.CommandResponse{
+                        Status: pb.CommandStatus_COMMAND_OK,
+                        Output: output,
+                }
+        }()
+
+        select {
+        case response := <-done:
+                return response
+        case <-time.After(timeout):
+                return &pb.CommandResponse{
+                        Status: pb.CommandStatus_COMMAND_TIMEOUT,
+                        Error:  fmt.Sprintf("command timed out after %v", timeout),
+                }
+        }
+}
+
+func (a *Agent) sendCommandResponse(stream net.Conn, msg *pb.Message, response *pb.CommandResponse) error {
+        payload, err := proto.Marshal(response)
+        if err != nil {
+                return err
+        }
+
+        return protocol.WriteMessage(stream, &pb.Message{
+                Type:      pb.MessageType_COMMAND_RESPONSE,
+                SessionId: msg.SessionId,
+                SourceId:  a.id,
+                TargetId:  msg.SourceId,
+                Timestamp: time.Now().Unix(),
+                Payload:   payload,
+        })
+}
+
+func cmdPing(a *Agent, cmd *pb.CommandPayload) ([]byte, error) {
+        return []byte("pong"), nil
+}
+
+func cmdInfo(a *Agent, cmd *pb.CommandPayload) ([]byte, error) {
+        hostname, _ := os.Hostname()
+        cwd, _ := os.Getwd()
+
+        var sb strings.Builder
+        fmt.Fprintf(&sb, "id: %s\n", a.id)
+        fmt.Fprintf(&sb, "hostname: %s\n", hostname)
+        fmt.Fprintf(&sb, "platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+        fmt.Fprintf(&sb, "protocol: %d\n", protocol.Version)
+        fmt.Fprintf(&sb, "pid: %d\n", os.Getpid())
+        fmt.Fprintf(&sb, "uid: %d\n", os.Getuid())
+        fmt.Fprintf(&sb, "cwd: %s\n", cwd)
+        fmt.Fprintf(&sb, "ips: %s\n", strings.Join(a.getLocalIPs(), ", "))
+        return []byte(sb.String()), nil
+}
+
+func cmdRoutes(a *Agent, cmd *pb.CommandPayload) ([]byte, error) {
+        a.mu.Lock()
+        lines := make([]string, 0, len(a.relayMap)+len(a.routes))
+        for childID := range a.relayMap {
+                lines = append(lines, fmt.Sprintf("%s direct", childID))
+        }
+        for descendantID, childID := range a.routes {
+                lines = append(lines, fmt.Sprintf("%s via %s", descendantID, childID))
+        }
+        a.mu.Unlock()
+
+        sort.Strings(lines)
+        return []byte(strings.Join(lines, "\n")), nil
+}
\ No newline at end of file
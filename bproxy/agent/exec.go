@@ -0,0 +1,146 @@
+package agent
+
+import (
+        "context"
+        "errors"
+        "log"
+        "net"
+        "os"
+        "os/exec"
+        "sync"
+        "time"
+
+        pb "github.com/bproxy/bproxy/proto"
+        "github.com/bproxy/bproxy/pkg/protocol"
+        "google.golang.org/protobuf/proto"
+)
+
+// execWaitDelay bounds how long output from a killed process's descendants
+// keeps the pipes open.
+const execWaitDelay = 2 * time.Second
+
+// handleExec runs a process and streams its output back as EXEC messages,
+// finishing with an EXEC_EXIT frame. The admin cancels the process by sending
+// an ExecControl on the same stream or by closing it.
+func (a *Agent) handleExec(msg *pb.Message, stream net.Conn) {
+        if msg.TargetId != a.id {
+                a.forwardStream(msg, stream)
+                return
+        }
+
+        send := a.execSender(msg, stream)
+
+        cmdPayload := &pb.CommandPayload{}
+        if err := proto.Unmarshal(msg.Payload, cmdPayload); err != nil {
+                send(&pb.ExecOutput{Stream: pb.ExecStream_EXEC_EXIT, ExitCode: -1, Error: "invalid exec payload"})
+                return
+        }
+
+        if msg.SourceId != "admin" {
+                log.Printf("Refused exec of %s from %s", cmdPayload.Command, msg.SourceId)
+                send(&pb.ExecOutput{Stream: pb.ExecStream_EXEC_EXIT, ExitCode: -1, Error: "exec is only accepted from the admin"})
+                return
+        }
+
+        ctx, cancel := context.WithCancel(context.Background())
+        defer cancel()
+
+        cmd := exec.CommandContext(ctx, cmdPayload.Command, cmdPayload.Args...)
+        cmd.Env = os.Environ()
+        for key, value := range cmdPayload.Env {
+                cmd.Env = append(cmd.Env, key+"="+value)
+        }
+        cmd.Stdout = &execWriter{stream: pb.ExecStream_EXEC_STDOUT, send: send}
+        cmd.Stderr = &execWriter{stream: pb.ExecStream_EXEC_STDERR, send: send}
+        cmd.WaitDelay = execWaitDelay
+        setProcessGroup(cmd)
+
+        if err := cmd.Start(); err != nil {
+                log.Printf("Failed to start %s: %v", cmdPayload.Command, err)
+                send(&pb.ExecOutput{Stream: pb.ExecStream_EXEC_EXIT, ExitCode: -1, Error: err.Error()})
+                return
+        }
+
+        log.Printf("Exec started: %s %v (pid %d)", cmdPayload.Command, cmdPayload.Args, cmd.Process.Pid)
+
+        // Cancelling kills the whole process group, see setProcessGroup
+        reaped := a.trackProcess(cmd.Process.Pid, func() error {
+                cancel()
+                return nil
+        })
+
+        go func() {
+                for {
+                        controlMsg, err := protocol.ReadMessage(stream)
+                        if err != nil {
+                                cancel()
+                                return
+                        }
+
+                        control := &pb.ExecControl{}
+                        if err := proto.Unmarshal(controlMsg.Payload, control); err == nil && control.Cancel {
+                                log.Printf("Exec of %s cancelled", cmdPayload.Command)
+                                cancel()
+                                return
+                        }
+                }
+        }()
+
+        exit := &pb.ExecOutput{Stream: pb.ExecStream_EXEC_EXIT}
+        err := cmd.Wait()
+        reaped()
+
+        var exitErr *exec.ExitError
+        switch {
+        case ctx.Err() != nil:
+                exit.ExitCode = int32(cmd.ProcessState.ExitCode())
+                exit.Error = "cancelled"
+        case errors.As(err, &exitErr):
+                exit.ExitCode = int32(exitErr.ExitCode())
+        case err != nil:
+                exit.ExitCode = int32(cmd.ProcessState.ExitCode())
+                exit.Error = err.Error()
+        }
+
+        log.Printf("Exec finished: %s (exit code %d)", cmdPayload.Command, exit.ExitCode)
+        send(exit)
+}
+
+// execSender returns a function that writes ExecOutput frames in reply to msg.
+// It is safe for concurrent use.
+func (a *Agent) execSender(msg *pb.Message, stream net.Conn) func(*pb.ExecOutput) error {
+        var writeMu sync.Mutex
+        return func(output *pb.ExecOutput) error {
+                payload, err := proto.Marshal(output)
+                if err != nil {
+                        return err
+                }
+
+                writeMu.Lock()
+                defer writeMu.Unlock()
+                return protocol.WriteMessage(stream, &pb.Message{
+                        Type:      msg.Type,
+                        SessionId: msg.SessionId,
+                        SourceId:  a.id,
+                        TargetId:  msg.SourceId,
+                        Timestamp: time.Now().Unix(),
+                        Payload:   payload,
+                })
+        }
+}
+
+// execWriter turns process output into EXEC frames.
+type execWriter struct {
+        stream pb.ExecStream
+        send   func(*pb.ExecOutput) error
+}
+
+func (w *execWriter) Write(p []byte) (int, error) {
+        data := make([]byte, len(p))
+        copy(data, p)
+
+        if err := w.send(&pb.ExecOutput{Stream: w.stream, Data: data}); err != nil {
+                return 0, err
+        }
+        return len(p), nil
+}
\ No newline at end of file
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package agent
+
+import (
+        "os/exec"
+        "syscall"
+)
+
+// setProcessGroup starts cmd in its own process group so that cancelling
+// it also kills any children it spawned.
+func setProcessGroup(cmd *exec.Cmd) {
+        cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+        cmd.Cancel = func() error {
+                return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+        }
+}
\ No newline at end of file
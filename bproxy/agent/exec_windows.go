@@ -0,0 +1,9 @@
+//go:build windows
+
+package agent
+
+import "os/exec"
+
+// setProcessGroup is a no-op on Windows, where only the process itself is
+// killed on cancellation.
+func setProcessGroup(cmd *exec.Cmd) {}
\ No newline at end of file
@@ -0,0 +1,239 @@
+package agent
+
+import (
+        "errors"
+        "fmt"
+        "io"
+        "log"
+        "net"
+        "os"
+        "time"
+
+        pb "github.com/bproxy/bproxy/proto"
+        "github.com/bproxy/bproxy/pkg/protocol"
+        "google.golang.org/protobuf/proto"
+)
+
+// handleFile serves a file transfer. Uploads are written to a partial file
+// next to the destination and renamed once their SHA-256 matches; downloads
+// are streamed from the offset the admin already has. File data travels in
+// DATA messages numbered by chunk, so neither side holds the whole file.
+func (a *Agent) handleFile(msg *pb.Message, stream net.Conn) {
+        if msg.TargetId != a.id {
+                a.forwardStream(msg, stream)
+                return
+        }
+
+        req := &pb.FileRequest{}
+        if err := proto.Unmarshal(msg.Payload, req); err != nil {
+                a.sendFileStatus(msg, stream, &pb.FileStatus{Error: "invalid file request"})
+                return
+        }
+
+        if msg.SourceId != "admin" {
+                log.Printf("Refused file transfer of %s from %s", req.Path, msg.SourceId)
+                a.sendFileStatus(msg, stream, &pb.FileStatus{Error: "file transfers are only accepted from the admin"})
+                return
+        }
+
+        chunkSize := int64(req.ChunkSize)
+        if chunkSize <= 0 {
+                chunkSize = protocol.FileChunkSize
+        }
+
+        var err error
+        switch req.Direction {
+        case pb.FileDirection_FILE_UPLOAD:
+                err = a.receiveFile(msg, req, chunkSize, stream)
+        case pb.FileDirection_FILE_DOWNLOAD:
+                err = a.sendFile(msg, req, chunkSize, stream)
+        }
+
+        if err != nil {
+                log.Printf("File transfer of %s failed: %v", req.Path, err)
+                a.sendFileStatus(msg, stream, &pb.FileStatus{Error: err.Error()})
+        }
+}
+
+func (a *Agent) receiveFile(msg *pb.Message, req *pb.FileRequest, chunkSize int64, stream net.Conn) error {
+        partPath := protocol.PartialPath(req.Path, req.Sha256)
+
+        file, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0600)
+        if err != nil {
+                return err
+        }
+        defer file.Close()
+
+        info, err := file.Stat()
+        if err != nil {
+                return err
+        }
+
+        offset := protocol.ResumeOffset(info.Size(), req.Size, chunkSize)
+        if err := file.Truncate(offset); err != nil {
+                return err
+        }
+        if _, err := file.Seek(offset, io.SeekStart); err != nil {
+                return err
+        }
+
+        if offset > 0 {
+                log.Printf("Resuming upload of %s at %d/%d bytes", req.Path, offset, req.Size)
+        } else {
+                log.Printf("Receiving %s (%d bytes)", req.Path, req.Size)
+        }
+
+        if err := a.sendFileStatus(msg, stream, &pb.FileStatus{Size: req.Size, Offset: offset}); err != nil {
+                return err
+        }
+
+        sequence := int32(offset / chunkSize)
+        for written := offset; written < req.Size; sequence++ {
+                dataMsg, err := protocol.ReadMessage(stream)
+                if err != nil {
+                        log.Printf("Upload of %s interrupted at %d/%d bytes", req.Path, written, req.Size)
+                        return nil
+                }
+
+                chunk := &pb.DataPayload{}
+                if err := proto.Unmarshal(dataMsg.Payload, chunk); err != nil {
+                        return fmt.Errorf("invalid chunk: %v", err)
+                }
+                if chunk.Sequence != sequence {
+                        return fmt.Errorf("expected chunk %d, got %d", sequence, chunk.Sequence)
+                }
+                if written+int64(len(chunk.Data)) > req.Size {
+                        return errors.New("received more data than announced")
+                }
+
+                if _, err := file.Write(chunk.Data); err != nil {
+                        return err
+                }
+                written += int64(len(chunk.Data))
+        }
+
+        if err := file.Close(); err != nil {
+                return err
+        }
+
+        sum, err := protocol.HashFile(partPath)
+        if err != nil {
+                return err
+        }
+        if sum != req.Sha256 {
+                os.Remove(partPath)
+                return fmt.Errorf("checksum mismatch: got %s", sum)
+        }
+
+        if err := os.Rename(partPath, req.Path); err != nil {
+                return err
+        }
+        if req.Mode != 0 {
+                os.Chmod(req.Path, os.FileMode(req.Mode).Perm())
+        }
+
+        log.Printf("Received %s (%d bytes, sha256 %s)", req.Path, req.Size, sum)
+        return a.sendFileStatus(msg, stream, &pb.FileStatus{Size: req.Size, Offset: req.Size, Sha256: sum})
+}
+
+func (a *Agent) sendFile(msg *pb.Message, req *pb.FileRequest, chunkSize int64, stream net.Conn) error {
+        file, err := os.Open(req.Path)
+        if err != nil {
+                return err
+        }
+        defer file.Close()
+
+        info, err := file.Stat()
+        if err != nil {
+                return err
+        }
+        if info.IsDir() {
+                return fmt.Errorf("%s is a directory", req.Path)
+        }
+
+        sum, err := protocol.HashFile(req.Path)
+        if err != nil {
+                return err
+        }
+
+        if err := a.sendFileStatus(msg, stream, &pb.FileStatus{Size: info.Size(), Sha256: sum}); err != nil {
+                return err
+        }
+
+        // The admin answers with the offset of the data it already has
+        startMsg, err := protocol.ReadMessage(stream)
+        if err != nil {
+                return nil
+        }
+
+        start := &pb.FileRequest{}
+        if err := proto.Unmarshal(startMsg.Payload, start); err != nil {
+                return fmt.Errorf("invalid resume request: %v", err)
+        }
+        if start.Offset < 0 || start.Offset > info.Size() || start.Offset%chunkSize != 0 {
+                return fmt.Errorf("invalid resume offset %d", start.Offset)
+        }
+
+        if _, err := file.Seek(start.Offset, io.SeekStart); err != nil {
+                return err
+        }
+
+        log.Printf("Sending %s (%d bytes from offset %d)", req.Path, info.Size(), start.Offset)
+
+        // Nothing else is expected from the admin; stop sending once it goes away
+        go func() {
+                protocol.ReadMessage(stream)
+                stream.Close()
+        }()
+
+        buf := make([]byte, chunkSize)
+        sequence := int32(start.Offset / chunkSize)
+        for {
+                n, err := io.ReadFull(file, buf)
+                if n > 0 {
+                        payload, marshalErr := proto.Marshal(&pb.DataPayload{Data: buf[:n], Sequence: sequence})
+                        if marshalErr != nil {
+                                return marshalErr
+                        }
+
+                        if writeErr := protocol.WriteMessage(stream, &pb.Message{
+                                Type:      pb.MessageType_DATA,
+                                SessionId: msg.SessionId,
+                                SourceId:  a.id,
+                                TargetId:  msg.SourceId,
+                                Timestamp: time.Now().Unix(),
+                                Payload:   payload,
+                        }); writeErr != nil {
+                                log.Printf("Download of %s interrupted: %v", req.Path, writeErr)
+                                return nil
+                        }
+                        sequence++
+                }
+
+                if err == io.EOF || err == io.ErrUnexpectedEOF {
+                        break
+                }
+                if err != nil {
+                        return err
+                }
+        }
+
+        log.Printf("Sent %s (%d bytes)", req.Path, info.Size())
+        return nil
+}
+
+func (a *Agent) sendFileStatus(msg *pb.Message, stream net.Conn, status *pb.FileStatus) error {
+        payload, err := proto.Marshal(status)
+        if err != nil {
+                return err
+        }
+
+        return protocol.WriteMessage(stream, &pb.Message{
+                Type:      pb.MessageType_FILE,
+                SessionId: msg.SessionId,
+                SourceId:  a.id,
+                TargetId:  msg.SourceId,
+                Timestamp: time.Now().Unix(),
+                Payload:   payload,
+        })
+}
\ No newline at end of file
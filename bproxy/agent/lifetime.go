@@ -0,0 +1,136 @@
+package agent
+
+import (
+        "fmt"
+        "log"
+        "strconv"
+        "strings"
+        "time"
+
+        pb "github.com/bproxy/bproxy/proto"
+        "github.com/bproxy/bproxy/pkg/schedule"
+)
+
+// lifetimeCheckInterval is how often the working hours are checked while the
+// agent is connected.
+const lifetimeCheckInterval = 10 * time.Second
+
+// SetKillDate makes the agent exit for good once t has passed.
+func (a *Agent) SetKillDate(t time.Time) {
+        a.mu.Lock()
+        defer a.mu.Unlock()
+        a.killDate = t
+}
+
+// SetWorkingHours keeps the agent disconnected outside the daily window w,
+// which is interpreted in the agent's local time.
+func (a *Agent) SetWorkingHours(w schedule.Window) {
+        a.mu.Lock()
+        defer a.mu.Unlock()
+        a.workingHours = w
+}
+
+func (a *Agent) lifetime() (time.Time, schedule.Window) {
+        a.mu.Lock()
+        defer a.mu.Unlock()
+        return a.killDate, a.workingHours
+}
+
+func (a *Agent) expired() bool {
+        killDate, _ := a.lifetime()
+        return !killDate.IsZero() && !time.Now().Before(killDate)
+}
+
+// waitForWorkingHours blocks until the working hours begin and reports false
+// if the agent was shut down meanwhile.
+func (a *Agent) waitForWorkingHours() bool {
+        _, hours := a.lifetime()
+        wait := hours.Until(time.Now())
+        if wait == 0 {
+                return true
+        }
+
+        log.Printf("Outside working hours %s, waiting %s", hours, wait.Round(time.Minute))
+        return a.sleep(wait)
+}
+
+// enforceLifetime shuts the agent down when its kill date is reached and
+// drops the connection when the working hours end.
+func (a *Agent) enforceLifetime() {
+        for {
+                killDate, hours := a.lifetime()
+                now := time.Now()
+
+                if !killDate.IsZero() && !now.Before(killDate) {
+                        log.Printf("Kill date %s reached, shutting down", killDate.Format(time.RFC3339))
+                        a.Shutdown()
+                        return
+                }
+
+                if session := a.parentSession(); !hours.Contains(now) && session != nil && !session.IsClosed() {
+                        log.Printf("Working hours %s are over, disconnecting", hours)
+                        a.Close()
+                }
+
+                wait := lifetimeCheckInterval
+                if !killDate.IsZero() && killDate.Sub(now) < wait {
+                        wait = killDate.Sub(now)
+                }
+                if !a.sleep(wait) {
+                        return
+                }
+        }
+}
+
+// registerLifetime adds the kill date and working hours to a registration.
+func (a *Agent) registerLifetime(reg *pb.RegisterPayload) {
+        killDate, hours := a.lifetime()
+        if !killDate.IsZero() {
+                reg.KillDate = killDate.Unix()
+        }
+        reg.WorkingHours = hours.String()
+}
+
+// cmdLifetime reports the kill date and working hours. The admin passes its
+// own limits as arguments, a Unix kill date (0 for none) and optionally a
+// window: the earlier kill date wins, and the window only applies if the
+// agent has none.
+func cmdLifetime(a *Agent, cmd *pb.CommandPayload) ([]byte, error) {
+        if len(cmd.Args) > 0 {
+                seconds, err := strconv.ParseInt(cmd.Args[0], 10, 64)
+                if err != nil {
+                        return nil, fmt.Errorf("invalid kill date %q", cmd.Args[0])
+                }
+
+                var hours schedule.Window
+                if len(cmd.Args) > 1 {
+                        if hours, err = schedule.ParseWindow(cmd.Args[1]); err != nil {
+                                return nil, err
+                        }
+                }
+
+                a.mu.Lock()
+                if seconds > 0 {
+                        a.killDate = schedule.Earliest(a.killDate, time.Unix(seconds, 0))
+                }
+                if a.workingHours.IsZero() {
+                        a.workingHours = hours
+                }
+                a.mu.Unlock()
+        }
+
+        killDate, hours := a.lifetime()
+
+        var sb strings.Builder
+        if killDate.IsZero() {
+                sb.WriteString("kill date: none\n")
+        } else {
+                fmt.Fprintf(&sb, "kill date: %s (in %s)\n", killDate.Format(time.RFC3339), time.Until(killDate).Round(time.Second))
+        }
+        if hours.IsZero() {
+                sb.WriteString("working hours: any\n")
+        } else {
+                fmt.Fprintf(&sb, "working hours: %s (local time %s)\n", hours, time.Now().Format("15:04"))
+        }
+        return []byte(sb.String()), nil
+}
\ No newline at end of file
@@ -0,0 +1,33 @@
+package agent
+
+import (
+        pb "github.com/bproxy/bproxy/proto"
+        "github.com/bproxy/bproxy/pkg/scope"
+)
+
+// SetScope restricts the destinations this agent connects to, independently
+// of the checks made by the admin. A nil scope allows every destination.
+func (a *Agent) SetScope(s *scope.Scope, audit *scope.AuditLog) {
+        a.scope = s
+        a.audit = audit
+}
+
+// inScope reports whether the request in msg may reach host:port, and
+// records an audit entry if it may not.
+func (a *Agent) inScope(msg *pb.Message, network, host string, port int) bool {
+        if a.scope.Allows(host, port) {
+                return true
+        }
+
+        a.audit.Denied(a.id, msg.SourceId, a.id, network, host, port)
+        return false
+}
+
+// outOfScope is the ConnectResult for a destination refused by inScope.
+func (a *Agent) outOfScope() *pb.ConnectResult {
+        return &pb.ConnectResult{
+                Error:     pb.ConnectError_CONNECT_NOT_ALLOWED,
+                FailedHop: a.id,
+                Message:   scope.DeniedMessage,
+        }
+}
\ No newline at end of file
@@ -0,0 +1,120 @@
+package agent
+
+import (
+        "errors"
+        "io"
+        "log"
+        "net"
+        "os"
+        "os/exec"
+        "time"
+
+        pb "github.com/bproxy/bproxy/proto"
+        "github.com/bproxy/bproxy/pkg/protocol"
+        "google.golang.org/protobuf/proto"
+)
+
+// shellProcess is a shell attached to the master side of a pseudo-terminal.
+type shellProcess struct {
+        cmd *exec.Cmd
+        pty *os.File
+}
+
+// capabilities lists the features this agent advertises at registration.
+func capabilities() []string {
+        caps := append([]string(nil), protocol.Capabilities...)
+        if shellSupported {
+                caps = append(caps, protocol.CapShell)
+        }
+        return caps
+}
+
+// handleShell runs an interactive shell on a pseudo-terminal. Terminal output
+// is sent back as EXEC_STDOUT frames followed by EXEC_EXIT, and the admin
+// sends ShellInput messages with keystrokes and window size changes. Closing
+// the stream kills the shell.
+func (a *Agent) handleShell(msg *pb.Message, stream net.Conn) {
+        if msg.TargetId != a.id {
+                a.forwardStream(msg, stream)
+                return
+        }
+
+        send := a.execSender(msg, stream)
+
+        req := &pb.ShellRequest{}
+        if err := proto.Unmarshal(msg.Payload, req); err != nil {
+                send(&pb.ExecOutput{Stream: pb.ExecStream_EXEC_EXIT, ExitCode: -1, Error: "invalid shell request"})
+                return
+        }
+
+        if msg.SourceId != "admin" {
+                log.Printf("Refused shell from %s", msg.SourceId)
+                send(&pb.ExecOutput{Stream: pb.ExecStream_EXEC_EXIT, ExitCode: -1, Error: "shells are only accepted from the admin"})
+                return
+        }
+
+        shell, err := startShell(req)
+        if err != nil {
+                log.Printf("Failed to start shell: %v", err)
+                send(&pb.ExecOutput{Stream: pb.ExecStream_EXEC_EXIT, ExitCode: -1, Error: err.Error()})
+                return
+        }
+
+        log.Printf("Shell started: %s (pid %d)", shell.cmd.Path, shell.cmd.Process.Pid)
+        reaped := a.trackProcess(shell.cmd.Process.Pid, shell.kill)
+
+        outputDone := make(chan struct{})
+        go func() {
+                defer close(outputDone)
+                io.Copy(&execWriter{stream: pb.ExecStream_EXEC_STDOUT, send: send}, shell.pty)
+        }()
+
+        go func() {
+                for {
+                        inputMsg, err := protocol.ReadMessage(stream)
+                        if err != nil {
+                                shell.kill()
+                                return
+                        }
+
+                        input := &pb.ShellInput{}
+                        if err := proto.Unmarshal(inputMsg.Payload, input); err != nil {
+                                continue
+                        }
+
+                        if input.Rows > 0 && input.Cols > 0 {
+                                if err := shell.resize(input.Rows, input.Cols); err != nil {
+                                        log.Printf("Failed to resize shell: %v", err)
+                                }
+                        }
+                        if len(input.Data) > 0 {
+                                if _, err := shell.pty.Write(input.Data); err != nil {
+                                        return
+                                }
+                        }
+                }
+        }()
+
+        exit := &pb.ExecOutput{Stream: pb.ExecStream_EXEC_EXIT}
+        err = shell.cmd.Wait()
+        reaped()
+
+        var exitErr *exec.ExitError
+        switch {
+        case errors.As(err, &exitErr):
+                exit.ExitCode = int32(exitErr.ExitCode())
+        case err != nil:
+                exit.ExitCode = -1
+                exit.Error = err.Error()
+        }
+
+        // Background jobs may still hold the terminal open
+        select {
+        case <-outputDone:
+        case <-time.After(execWaitDelay):
+        }
+        shell.pty.Close()
+
+        log.Printf("Shell finished: %s (exit code %d)", shell.cmd.Path, exit.ExitCode)
+        send(exit)
+}
\ No newline at end of file
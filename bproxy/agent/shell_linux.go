@@ -0,0 +1,120 @@
+//go:build linux
+
+package agent
+
+import (
+        "fmt"
+        "os"
+        "os/exec"
+        "strconv"
+        "syscall"
+
+        pb "github.com/bproxy/bproxy/proto"
+        "golang.org/x/sys/unix"
+)
+
+const shellSupported = true
+
+// startShell runs the requested shell, or the agent user's login shell, as
+// the leader of a new session whose controlling terminal is a fresh PTY.
+func startShell(req *pb.ShellRequest) (*shellProcess, error) {
+        path := req.Shell
+        if path == "" {
+                path = defaultShell()
+        }
+
+        master, slave, err := openPTY()
+        if err != nil {
+                return nil, err
+        }
+        defer slave.Close()
+
+        shell := &shellProcess{pty: master}
+        if req.Rows > 0 && req.Cols > 0 {
+                if err := shell.resize(req.Rows, req.Cols); err != nil {
+                        master.Close()
+                        return nil, err
+                }
+        }
+
+        term := req.Term
+        if term == "" {
+                term = "xterm"
+        }
+
+        shell.cmd = exec.Command(path)
+        shell.cmd.Env = append(os.Environ(), "TERM="+term)
+        shell.cmd.Stdin = slave
+        shell.cmd.Stdout = slave
+        shell.cmd.Stderr = slave
+        shell.cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+
+        if err := shell.cmd.Start(); err != nil {
+                master.Close()
+                return nil, err
+        }
+        return shell, nil
+}
+
+func defaultShell() string {
+        if shell := os.Getenv("SHELL"); shell != "" {
+                return shell
+        }
+        if _, err := os.Stat("/bin/bash"); err == nil {
+                return "/bin/bash"
+        }
+        return "/bin/sh"
+}
+
+// openPTY allocates a pseudo-terminal pair. The master stays in non-blocking
+// mode so that closing it interrupts pending reads.
+func openPTY() (*os.File, *os.File, error) {
+        master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+        if err != nil {
+                return nil, nil, fmt.Errorf("failed to open pty: %v", err)
+        }
+
+        var index uint32
+        err = control(master, func(fd int) error {
+                if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+                        return err
+                }
+                index, err = unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+                return err
+        })
+        if err != nil {
+                master.Close()
+                return nil, nil, fmt.Errorf("failed to unlock pty: %v", err)
+        }
+
+        slave, err := os.OpenFile("/dev/pts/"+strconv.Itoa(int(index)), os.O_RDWR|syscall.O_NOCTTY, 0)
+        if err != nil {
+                master.Close()
+                return nil, nil, fmt.Errorf("failed to open pty slave: %v", err)
+        }
+        return master, slave, nil
+}
+
+func (s *shellProcess) resize(rows, cols uint32) error {
+        return control(s.pty, func(fd int) error {
+                return unix.IoctlSetWinsize(fd, unix.TIOCSWINSZ, &unix.Winsize{Row: uint16(rows), Col: uint16(cols)})
+        })
+}
+
+// kill ends the shell together with everything started from it.
+func (s *shellProcess) kill() error {
+        return syscall.Kill(-s.cmd.Process.Pid, syscall.SIGKILL)
+}
+
+func control(file *os.File, fn func(fd int) error) error {
+        conn, err := file.SyscallConn()
+        if err != nil {
+                return err
+        }
+
+        var fnErr error
+        if err := conn.Control(func(fd uintptr) { fnErr = fn(int(fd)) }); err != nil {
+                return err
+        }
+        return fnErr
+}
\ No newline at end of file
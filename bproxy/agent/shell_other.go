@@ -0,0 +1,25 @@
+//go:build !linux
+
+package agent
+
+import (
+        "errors"
+
+        pb "github.com/bproxy/bproxy/proto"
+)
+
+const shellSupported = false
+
+var errShellUnsupported = errors.New("interactive shells are only supported on Linux agents")
+
+func startShell(req *pb.ShellRequest) (*shellProcess, error) {
+        return nil, errShellUnsupported
+}
+
+func (s *shellProcess) resize(rows, cols uint32) error {
+        return errShellUnsupported
+}
+
+func (s *shellProcess) kill() error {
+        return errShellUnsupported
+}
\ No newline at end of file
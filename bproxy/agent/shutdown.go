@@ -0,0 +1,128 @@
+package agent
+
+import (
+        "log"
+        "net"
+        "time"
+
+        pb "github.com/bproxy/bproxy/proto"
+        "github.com/bproxy/bproxy/pkg/protocol"
+        "google.golang.org/protobuf/proto"
+)
+
+// shutdownAckTimeout bounds how long the agent waits for the admin to read
+// the confirmation of a shutdown before exiting anyway.
+const shutdownAckTimeout = 5 * time.Second
+
+// shutdownProcessTimeout bounds how long Shutdown waits for killed exec and
+// shell processes to be reaped.
+const shutdownProcessTimeout = 5 * time.Second
+
+// Shutdown stops the agent for good: running exec and shell process groups
+// are killed, the cascade listener and the sessions of all children are
+// closed, the admin session is torn down and Start returns instead of
+// reconnecting. It returns once the killed processes have been reaped.
+func (a *Agent) Shutdown() {
+        a.stopOnce.Do(func() {
+                close(a.stop)
+
+                a.mu.Lock()
+                for pid, kill := range a.processes {
+                        if err := kill(); err != nil {
+                                log.Printf("Failed to kill process group %d: %v", pid, err)
+                        }
+                }
+                for childID, session := range a.relayMap {
+                        session.Close()
+                        delete(a.relayMap, childID)
+                }
+                a.mu.Unlock()
+
+                a.Close()
+                a.waitProcesses()
+        })
+}
+
+// trackProcess records a running exec or shell so that Shutdown can kill its
+// process group with kill. The returned function must be called once the
+// process has been reaped. A process started while the agent is shutting
+// down is killed straight away.
+func (a *Agent) trackProcess(pid int, kill func() error) func() {
+        a.mu.Lock()
+        defer a.mu.Unlock()
+
+        if a.stopped() {
+                kill()
+                return func() {}
+        }
+
+        a.processes[pid] = kill
+        a.processWG.Add(1)
+        return func() {
+                a.mu.Lock()
+                delete(a.processes, pid)
+                a.mu.Unlock()
+                a.processWG.Done()
+        }
+}
+
+func (a *Agent) waitProcesses() {
+        done := make(chan struct{})
+        go func() {
+                a.processWG.Wait()
+                close(done)
+        }()
+
+        select {
+        case <-done:
+        case <-time.After(shutdownProcessTimeout):
+                log.Printf("Gave up waiting for exec and shell processes to exit")
+        }
+}
+
+// handleShutdown confirms a shutdown requested by the admin and then stops
+// the agent. Children are not touched beyond closing their sessions; the
+// admin retires a subtree by shutting down its nodes deepest first.
+func (a *Agent) handleShutdown(msg *pb.Message, stream net.Conn) {
+        if msg.TargetId != a.id {
+                a.forwardStream(msg, stream)
+                return
+        }
+
+        req := &pb.ShutdownRequest{}
+        resp := &pb.ShutdownResponse{}
+        if err := proto.Unmarshal(msg.Payload, req); err != nil {
+                resp.Error = "invalid shutdown request"
+        } else if msg.SourceId != "admin" {
+                log.Printf("Refused shutdown from %s", msg.SourceId)
+                resp.Error = "shutdown is only accepted from the admin"
+        }
+
+        payload, err := proto.Marshal(resp)
+        if err != nil {
+                return
+        }
+
+        if err := protocol.WriteMessage(stream, &pb.Message{
+                Type:      pb.MessageType_SHUTDOWN,
+                SessionId: msg.SessionId,
+                SourceId:  a.id,
+                TargetId:  msg.SourceId,
+                Timestamp: time.Now().Unix(),
+                Payload:   payload,
+        }); err != nil {
+                log.Printf("Failed to confirm shutdown: %v", err)
+                return
+        }
+        if resp.Error != "" {
+                return
+        }
+
+        log.Printf("Shutdown requested by admin: %s", req.Reason)
+
+        // Let the confirmation reach the admin before the session goes away
+        stream.SetReadDeadline(time.Now().Add(shutdownAckTimeout))
+        protocol.ReadMessage(stream)
+
+        a.Shutdown()
+}
\ No newline at end of file
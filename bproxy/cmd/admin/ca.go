@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tlsutil "github.com/bproxy/bproxy/pkg/tls"
+)
+
+const caUsage = `Usage:
+  admin ca init  [-dir certs] [-name "BProxy CA"]
+  admin ca issue [-dir certs] [-force] -name <agent-id>
+`
+
+// runCA implements the "ca" subcommand, which manages a small certificate
+// authority for agent client certificates.
+func runCA(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, caUsage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "init":
+		caInit(args[1:])
+	case "issue":
+		caIssue(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, caUsage)
+		os.Exit(2)
+	}
+}
+
+func caInit(args []string) {
+	fs := flag.NewFlagSet("ca init", flag.ExitOnError)
+	dir := fs.String("dir", "certs", "Directory for the CA files")
+	name := fs.String("name", "BProxy CA", "CA common name")
+	fs.Parse(args)
+
+	certFile := filepath.Join(*dir, "ca.crt")
+	keyFile := filepath.Join(*dir, "ca.key")
+	for _, path := range []string{certFile, keyFile} {
+		if _, err := os.Stat(path); err == nil {
+			log.Fatalf("CA already exists at %s", path)
+		}
+	}
+
+	if err := os.MkdirAll(*dir, 0700); err != nil {
+		log.Fatalf("Failed to create %s: %v", *dir, err)
+	}
+
+	certPEM, keyPEM, err := tlsutil.GenerateCA(*name)
+	if err != nil {
+		log.Fatalf("Failed to generate CA: %v", err)
+	}
+
+	if err := tlsutil.WriteKeyPair(certFile, keyFile, certPEM, keyPEM); err != nil {
+		log.Fatalf("Failed to write CA: %v", err)
+	}
+
+	log.Printf("CA written to %s and %s", certFile, keyFile)
+}
+
+func caIssue(args []string) {
+	fs := flag.NewFlagSet("ca issue", flag.ExitOnError)
+	dir := fs.String("dir", "certs", "Directory containing ca.crt and ca.key")
+	name := fs.String("name", "", "Client certificate common name (the agent ID)")
+	force := fs.Bool("force", false, "Replace an existing certificate for the same name")
+	fs.Parse(args)
+
+	if *name == "" {
+		log.Fatalf("-name is required")
+	}
+	if err := checkCertName(*name); err != nil {
+		log.Fatalf("Invalid -name: %v", err)
+	}
+
+	certPEM, keyPEM, err := tlsutil.IssueClientCert(filepath.Join(*dir, "ca.crt"), filepath.Join(*dir, "ca.key"), *name)
+	if err != nil {
+		log.Fatalf("Failed to issue certificate: %v", err)
+	}
+
+	certFile := filepath.Join(*dir, *name+".crt")
+	keyFile := filepath.Join(*dir, *name+".key")
+	if *force {
+		for _, path := range []string{certFile, keyFile} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				log.Fatalf("Failed to remove %s: %v", path, err)
+			}
+		}
+	}
+	if err := tlsutil.WriteKeyPair(certFile, keyFile, certPEM, keyPEM); err != nil {
+		if os.IsExist(err) {
+			log.Fatalf("Certificate for %s already exists in %s, use -force to replace it", *name, *dir)
+		}
+		log.Fatalf("Failed to write certificate: %v", err)
+	}
+
+	log.Printf("Client certificate for %s written to %s and %s", *name, certFile, keyFile)
+}
+
+// checkCertName rejects names that would write outside dir or over the CA's
+// own key pair, since the name doubles as the file name.
+func checkCertName(name string) error {
+	switch {
+	case strings.EqualFold(name, "ca"):
+		return fmt.Errorf("%q is reserved for the CA", name)
+	case strings.ContainsAny(name, `/\`) || strings.Contains(name, ".."):
+		return fmt.Errorf("%q must not contain path separators or \"..\"", name)
+	}
+	return nil
+}
\ No newline at end of file
@@ -3,23 +3,74 @@ package main
 import (
 	"flag"
 	"log"
+	"os"
 
 	"github.com/bproxy/bproxy/admin"
+	"github.com/bproxy/bproxy/pkg/schedule"
+	"github.com/bproxy/bproxy/pkg/scope"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "ca" {
+		runCA(os.Args[2:])
+		return
+	}
+
 	addr := flag.String("addr", "0.0.0.0:8443", "Admin server listen address")
-	certFile := flag.String("cert", "", "TLS certificate file (optional)")
-	keyFile := flag.String("key", "", "TLS key file (optional)")
+	certFile := flag.String("cert", "", "TLS certificate file (generated and saved if missing)")
+	keyFile := flag.String("key", "", "TLS key file (generated and saved if missing)")
+	caFile := flag.String("ca", "", "CA bundle for agent client certificates (enables mutual TLS)")
+	secret := flag.String("secret", os.Getenv("BPROXY_SECRET"), "Pre-shared agent registration secret (default $BPROXY_SECRET)")
+	killDate := flag.String("kill-date", "", "Kill date pushed to registering agents (YYYY-MM-DD or RFC 3339)")
+	hours := flag.String("hours", "", "Working hours pushed to agents without their own, in agent local time (e.g. 08:00-18:00)")
+	scopeFile := flag.String("scope", "", "Engagement scope file listing the allowed destinations (default: allow all)")
+	auditFile := flag.String("audit-log", "", "File recording out-of-scope connection attempts")
 	flag.Parse()
 
 	log.Printf("Starting BProxy Admin Server...")
 
-	adminServer, err := admin.NewAdmin(*addr, *certFile, *keyFile)
+	adminServer, err := admin.NewAdmin(*addr, *certFile, *keyFile, *caFile)
 	if err != nil {
 		log.Fatalf("Failed to create admin server: %v", err)
 	}
 
+	if *secret != "" {
+		adminServer.SetRegistrationSecret(*secret)
+	} else {
+		log.Printf("Warning: no registration secret set, any agent can register")
+	}
+
+	if *killDate != "" {
+		t, err := schedule.ParseKillDate(*killDate)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		adminServer.SetKillDate(t)
+	}
+	window, err := schedule.ParseWindow(*hours)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	adminServer.SetWorkingHours(window)
+
+	var engagementScope *scope.Scope
+	if *scopeFile != "" {
+		engagementScope, err = scope.Load(*scopeFile)
+		if err != nil {
+			log.Fatalf("Failed to load scope: %v", err)
+		}
+		log.Printf("Scope: %d rules loaded from %s", engagementScope.Len(), *scopeFile)
+	}
+	var audit *scope.AuditLog
+	if *auditFile != "" {
+		audit, err = scope.OpenAuditLog(*auditFile)
+		if err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		defer audit.Close()
+	}
+	adminServer.SetScope(engagementScope, audit)
+
 	if err := adminServer.Start(); err != nil {
 		log.Fatalf("Admin server error: %v", err)
 	}
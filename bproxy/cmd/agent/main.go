@@ -3,13 +3,30 @@ package main
 import (
         "flag"
         "log"
+        "os"
+        "time"
 
         "github.com/bproxy/bproxy/agent"
+        "github.com/bproxy/bproxy/pkg/schedule"
+        "github.com/bproxy/bproxy/pkg/scope"
 )
 
 func main() {
         adminAddr := flag.String("admin", "127.0.0.1:8443", "Admin server address")
         cascadePort := flag.Int("cascade", 0, "Port for cascade connections (0 = disabled)")
+        secret := flag.String("secret", os.Getenv("BPROXY_SECRET"), "Pre-shared registration secret (default $BPROXY_SECRET)")
+        fingerprint := flag.String("fingerprint", "", "Pinned SPKI SHA-256 fingerprint of the admin or parent cascade listener")
+        certFile := flag.String("cert", "", "Client certificate for mutual TLS (its common name becomes the agent ID)")
+        keyFile := flag.String("key", "", "Client certificate key")
+        cascadeCert := flag.String("cascade-cert", "", "Cascade listener certificate (generated and saved if missing)")
+        cascadeKey := flag.String("cascade-key", "", "Cascade listener key (generated and saved if missing)")
+        caFile := flag.String("ca", "", "CA bundle required from child agents on the cascade listener")
+        id := flag.String("id", "", "Agent ID (default: random, or read from -id-file)")
+        idFile := flag.String("id-file", "", "File holding the agent ID, created on first start")
+        killDate := flag.String("kill-date", "", "Exit for good after this date (YYYY-MM-DD or RFC 3339)")
+        hours := flag.String("hours", "", "Only stay connected during these local hours (e.g. 08:00-18:00)")
+        scopeFile := flag.String("scope", "", "Scope file listing the destinations this agent may reach (default: allow all)")
+        auditFile := flag.String("audit-log", "", "File recording out-of-scope connection attempts")
         flag.Parse()
 
         log.Printf("Starting BProxy Agent...")
@@ -19,6 +36,68 @@ func main() {
         }
 
         agentClient := agent.NewAgent(*adminAddr, *cascadePort)
+        agentClient.SetRegistrationSecret(*secret)
+        if *id != "" {
+                agentClient.SetID(*id)
+        } else if *idFile != "" {
+                storedID, err := agent.LoadOrCreateID(*idFile)
+                if err != nil {
+                        log.Fatalf("Failed to load agent ID: %v", err)
+                }
+                agentClient.SetID(storedID)
+        }
+        if *fingerprint != "" {
+                agentClient.SetPinnedFingerprint(*fingerprint)
+        } else {
+                log.Printf("Warning: no -fingerprint given, the admin certificate is not verified")
+        }
+        if *certFile != "" {
+                if *id != "" || *idFile != "" {
+                        log.Printf("Warning: -cert is set, the agent ID is taken from the certificate")
+                }
+                if err := agentClient.SetClientCertificate(*certFile, *keyFile); err != nil {
+                        log.Fatalf("Failed to load client certificate: %v", err)
+                }
+        }
+        agentClient.SetClientCA(*caFile)
+        if *cascadeCert != "" || *cascadeKey != "" {
+                if *cascadeCert == "" || *cascadeKey == "" {
+                        log.Fatalf("-cascade-cert and -cascade-key must be given together")
+                }
+                if err := agentClient.SetCascadeCertificate(*cascadeCert, *cascadeKey); err != nil {
+                        log.Fatalf("Failed to load cascade certificate: %v", err)
+                }
+        }
+        if *killDate != "" {
+                t, err := schedule.ParseKillDate(*killDate)
+                if err != nil {
+                        log.Fatalf("%v", err)
+                }
+                log.Printf("Kill date: %s", t.Format(time.RFC3339))
+                agentClient.SetKillDate(t)
+        }
+        window, err := schedule.ParseWindow(*hours)
+        if err != nil {
+                log.Fatalf("%v", err)
+        }
+        agentClient.SetWorkingHours(window)
+        var engagementScope *scope.Scope
+        if *scopeFile != "" {
+                engagementScope, err = scope.Load(*scopeFile)
+                if err != nil {
+                        log.Fatalf("Failed to load scope: %v", err)
+                }
+                log.Printf("Scope: %d rules loaded from %s", engagementScope.Len(), *scopeFile)
+        }
+        var audit *scope.AuditLog
+        if *auditFile != "" {
+                audit, err = scope.OpenAuditLog(*auditFile)
+                if err != nil {
+                        log.Fatalf("Failed to open audit log: %v", err)
+                }
+                defer audit.Close()
+        }
+        agentClient.SetScope(engagementScope, audit)
         if err := agentClient.Start(); err != nil {
                 log.Fatalf("Agent error: %v", err)
         }
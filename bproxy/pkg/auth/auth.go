@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	pb "github.com/bproxy/bproxy/proto"
+)
+
+// MaxClockSkew bounds how old or how far in the future a signed
+// registration may be.
+const MaxClockSkew = 5 * time.Minute
+
+var (
+	ErrMissingMAC = errors.New("registration is not signed")
+	ErrBadMAC     = errors.New("registration signature mismatch")
+	ErrExpired    = errors.New("registration timestamp outside allowed window")
+	ErrReplayed   = errors.New("registration nonce already used")
+)
+
+func registrationMAC(secret, agentID string, timestamp int64, nonce []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("bproxy-register"))
+	mac.Write([]byte(agentID))
+	binary.Write(mac, binary.BigEndian, timestamp)
+	mac.Write(nonce)
+	return mac.Sum(nil)
+}
+
+// SignRegistration fills in the authentication fields of reg with an HMAC
+// over the agent ID, the current time and a random nonce.
+func SignRegistration(secret string, reg *pb.RegisterPayload) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	reg.AuthTimestamp = time.Now().Unix()
+	reg.AuthNonce = nonce
+	reg.AuthMac = registrationMAC(secret, reg.AgentId, reg.AuthTimestamp, nonce)
+	return nil
+}
+
+// NonceCache remembers the nonces of accepted registrations until they fall
+// out of the allowed clock skew window.
+type NonceCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func NewNonceCache() *NonceCache {
+	return &NonceCache{seen: make(map[string]time.Time)}
+}
+
+func (c *NonceCache) add(nonce []byte, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, expires := range c.seen {
+		if now.After(expires) {
+			delete(c.seen, key)
+		}
+	}
+
+	key := hex.EncodeToString(nonce)
+	if _, exists := c.seen[key]; exists {
+		return false
+	}
+	c.seen[key] = now.Add(2 * MaxClockSkew)
+	return true
+}
+
+// VerifyRegistration checks a registration signed with SignRegistration.
+func VerifyRegistration(secret string, reg *pb.RegisterPayload, nonces *NonceCache) error {
+	if len(reg.AuthMac) == 0 || len(reg.AuthNonce) == 0 {
+		return ErrMissingMAC
+	}
+
+	expected := registrationMAC(secret, reg.AgentId, reg.AuthTimestamp, reg.AuthNonce)
+	if !hmac.Equal(expected, reg.AuthMac) {
+		return ErrBadMAC
+	}
+
+	now := time.Now()
+	signedAt := time.Unix(reg.AuthTimestamp, 0)
+	if signedAt.Before(now.Add(-MaxClockSkew)) || signedAt.After(now.Add(MaxClockSkew)) {
+		return ErrExpired
+	}
+
+	if !nonces.add(reg.AuthNonce, now) {
+		return ErrReplayed
+	}
+
+	return nil
+}
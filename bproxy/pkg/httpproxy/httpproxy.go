@@ -0,0 +1,148 @@
+package httpproxy
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const Realm = "BProxy"
+
+// hopHeaders are only meaningful for a single connection and must not be
+// forwarded to the origin server.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Authorized checks the Basic Proxy-Authorization header. An empty username
+// disables authentication.
+func Authorized(req *http.Request, username, password string) bool {
+	if username == "" {
+		return true
+	}
+
+	auth := req.Header.Get("Proxy-Authorization")
+	encoded, ok := strings.CutPrefix(auth, "Basic ")
+	if !ok {
+		return false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return false
+	}
+
+	user, pass, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return false
+	}
+
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(username)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(password)) == 1
+	return userOK && passOK
+}
+
+// TargetAddress returns the host and port a proxy request is aimed at.
+// CONNECT requests use the authority form, everything else must carry an
+// absolute URI.
+func TargetAddress(req *http.Request) (string, int, error) {
+	hostport := req.Host
+	defaultPort := "443"
+
+	if req.Method != http.MethodConnect {
+		if !req.URL.IsAbs() || req.URL.Host == "" {
+			return "", 0, fmt.Errorf("request URI is not absolute: %s", req.RequestURI)
+		}
+		if req.URL.Scheme != "http" {
+			return "", 0, fmt.Errorf("unsupported scheme: %s", req.URL.Scheme)
+		}
+		hostport = req.URL.Host
+		defaultPort = "80"
+	}
+
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, portStr = strings.Trim(hostport, "[]"), defaultPort
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port in %s", hostport)
+	}
+
+	return host, port, nil
+}
+
+// removeHopHeaders deletes the hop-by-hop headers and any header named in
+// Connection.
+func removeHopHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			header.Del(strings.TrimSpace(name))
+		}
+	}
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+// PrepareOutbound rewrites a proxy request so it can be sent to the origin
+// server in origin form.
+func PrepareOutbound(req *http.Request) {
+	removeHopHeaders(req.Header)
+
+	// Keep net/http from adding its own User-Agent
+	if _, ok := req.Header["User-Agent"]; !ok {
+		req.Header.Set("User-Agent", "")
+	}
+
+	req.RequestURI = ""
+}
+
+// PrepareResponse strips the origin's hop-by-hop headers from a response
+// before it is relayed to the client. Response.Write adds its own framing and
+// Connection: close where needed.
+func PrepareResponse(resp *http.Response) {
+	removeHopHeaders(resp.Header)
+}
+
+// WriteInterim relays a 1xx response. Response.Write is not used because it
+// adds a Content-Length, which is not allowed on informational responses.
+func WriteInterim(w io.Writer, resp *http.Response) error {
+	if _, err := fmt.Fprintf(w, "HTTP/1.1 %s\r\n", resp.Status); err != nil {
+		return err
+	}
+	if err := resp.Header.Write(w); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\r\n")
+	return err
+}
+
+func WriteStatus(w io.Writer, code int) error {
+	extra := ""
+	if code == http.StatusProxyAuthRequired {
+		extra = fmt.Sprintf("Proxy-Authenticate: Basic realm=%q\r\n", Realm)
+	}
+
+	_, err := fmt.Fprintf(w, "HTTP/1.1 %d %s\r\n%sContent-Length: 0\r\n\r\n", code, http.StatusText(code), extra)
+	return err
+}
+
+func WriteConnectEstablished(w io.Writer) error {
+	_, err := io.WriteString(w, "HTTP/1.1 200 Connection Established\r\n\r\n")
+	return err
+}
@@ -0,0 +1,181 @@
+package netstack
+
+import (
+	"encoding/binary"
+	"log"
+	"net"
+	"time"
+)
+
+const (
+	icmpProtocol      = 1
+	icmpEchoReply     = 0
+	icmpEchoRequest   = 8
+	icmpv6Protocol    = 58
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+	pingTimeout       = 2 * time.Second
+)
+
+func isICMPEchoRequest(packet []byte) bool {
+	if len(packet) < 20 || packet[9] != icmpProtocol {
+		return false
+	}
+	headerLen := int(packet[0]&0x0F) * 4
+	return len(packet) >= headerLen+8 && packet[headerLen] == icmpEchoRequest
+}
+
+// isICMPv6EchoRequest only recognises echo requests directly after the fixed
+// IPv6 header; anything behind extension headers goes to the stack.
+func isICMPv6EchoRequest(packet []byte) bool {
+	return len(packet) >= 48 && packet[6] == icmpv6Protocol && packet[40] == icmpv6EchoRequest
+}
+
+// handleICMPEcho pings the real destination from this host and, if it
+// answers, writes a matching echo reply back towards the admin TUN.
+func (ns *Stack) handleICMPEcho(packet []byte) {
+	headerLen := int(packet[0]&0x0F) * 4
+	dstIP := net.IP(append([]byte(nil), packet[16:20]...))
+	echo := packet[headerLen:]
+
+	if !ns.allowed("icmp", dstIP.String(), 0) {
+		return
+	}
+
+	if !ping(dstIP, echo, false) {
+		return
+	}
+
+	reply := make([]byte, len(packet))
+	copy(reply, packet)
+
+	// Swap addresses and reset TTL, then fix up the IPv4 header checksum.
+	copy(reply[12:16], packet[16:20])
+	copy(reply[16:20], packet[12:16])
+	reply[8] = 64
+	reply[10], reply[11] = 0, 0
+	binary.BigEndian.PutUint16(reply[10:12], checksum(reply[:headerLen]))
+
+	icmpReply := reply[headerLen:]
+	icmpReply[0] = icmpEchoReply
+	icmpReply[2], icmpReply[3] = 0, 0
+	binary.BigEndian.PutUint16(icmpReply[2:4], checksum(icmpReply))
+
+	if err := ns.write(reply); err != nil {
+		log.Printf("Netstack: failed to write ICMP reply: %v", err)
+	}
+}
+
+// handleICMPv6Echo is handleICMPEcho for IPv6. The ICMPv6 checksum covers a
+// pseudo-header, so it is recomputed from the swapped addresses.
+func (ns *Stack) handleICMPv6Echo(packet []byte) {
+	dstIP := net.IP(append([]byte(nil), packet[24:40]...))
+	echo := packet[40:]
+
+	if !ns.allowed("icmp", dstIP.String(), 0) {
+		return
+	}
+
+	if !ping(dstIP, echo, true) {
+		return
+	}
+
+	reply := make([]byte, len(packet))
+	copy(reply, packet)
+
+	copy(reply[8:24], packet[24:40])
+	copy(reply[24:40], packet[8:24])
+	reply[7] = 64
+
+	icmpReply := reply[40:]
+	icmpReply[0] = icmpv6EchoReply
+	icmpReply[2], icmpReply[3] = 0, 0
+
+	pseudo := make([]byte, 0, 40+len(icmpReply))
+	pseudo = append(pseudo, reply[8:40]...)
+	pseudo = binary.BigEndian.AppendUint32(pseudo, uint32(len(icmpReply)))
+	pseudo = append(pseudo, 0, 0, 0, icmpv6Protocol)
+	pseudo = append(pseudo, icmpReply...)
+	binary.BigEndian.PutUint16(icmpReply[2:4], checksum(pseudo))
+
+	if err := ns.write(reply); err != nil {
+		log.Printf("Netstack: failed to write ICMPv6 reply: %v", err)
+	}
+}
+
+// ping sends the captured echo request to dst, preferring a raw socket and
+// falling back to an unprivileged ICMP datagram socket. Only a reply carrying
+// the request's identifier and sequence number counts, so concurrent pings to
+// the same host do not answer each other.
+func ping(dst net.IP, echo []byte, v6 bool) bool {
+	network, laddr, replyType := "ip4:icmp", "0.0.0.0", byte(icmpEchoReply)
+	if v6 {
+		network, laddr, replyType = "ip6:ipv6-icmp", "::", icmpv6EchoReply
+	}
+
+	conn, err := net.ListenPacket(network, laddr)
+	var target net.Addr = &net.IPAddr{IP: dst}
+	datagram := false
+	if err != nil {
+		conn, err = listenICMPDatagram(v6)
+		if err != nil {
+			log.Printf("Netstack: cannot open ICMP socket: %v", err)
+			return false
+		}
+		target = &net.UDPAddr{IP: dst}
+		datagram = true
+	}
+	defer conn.Close()
+
+	if _, err := conn.WriteTo(echo, target); err != nil {
+		return false
+	}
+
+	deadline := time.Now().Add(pingTimeout)
+	conn.SetReadDeadline(deadline)
+
+	buf := make([]byte, 1500)
+	for time.Now().Before(deadline) {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return false
+		}
+		if n < 8 || buf[0] != replyType {
+			continue
+		}
+		// The kernel replaces the identifier on datagram sockets with the
+		// socket's own and only delivers replies carrying it.
+		if !datagram && binary.BigEndian.Uint16(buf[4:6]) != binary.BigEndian.Uint16(echo[4:6]) {
+			continue
+		}
+		if binary.BigEndian.Uint16(buf[6:8]) != binary.BigEndian.Uint16(echo[6:8]) {
+			continue
+		}
+		switch addr := from.(type) {
+		case *net.IPAddr:
+			if addr.IP.Equal(dst) {
+				return true
+			}
+		case *net.UDPAddr:
+			if addr.IP.Equal(dst) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i : i+2]))
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = (sum & 0xFFFF) + (sum >> 16)
+	}
+	return ^uint16(sum)
+}
\ No newline at end of file
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package netstack
+
+import (
+	"errors"
+	"net"
+)
+
+func listenICMPDatagram(v6 bool) (net.PacketConn, error) {
+	return nil, errors.New("unprivileged ICMP sockets are not supported on this platform")
+}
\ No newline at end of file
@@ -0,0 +1,33 @@
+//go:build linux || darwin
+
+package netstack
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// listenICMPDatagram opens an unprivileged ICMP or ICMPv6 socket, which Linux
+// allows for groups in net.ipv4.ping_group_range.
+func listenICMPDatagram(v6 bool) (net.PacketConn, error) {
+	family, proto := syscall.AF_INET, syscall.IPPROTO_ICMP
+	var addr syscall.Sockaddr = &syscall.SockaddrInet4{}
+	if v6 {
+		family, proto = syscall.AF_INET6, syscall.IPPROTO_ICMPV6
+		addr = &syscall.SockaddrInet6{}
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_DGRAM, proto)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err := syscall.Bind(fd, addr); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+
+	f := os.NewFile(uintptr(fd), "icmp")
+	defer f.Close()
+	return net.FilePacketConn(f)
+}
\ No newline at end of file
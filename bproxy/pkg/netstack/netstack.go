@@ -0,0 +1,272 @@
+package netstack
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/icmp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	nicID       = 1
+	mtu         = 1500
+	queueSize   = 1024
+	maxInFlight = 2048
+	dialTimeout = 5 * time.Second
+	udpIdle     = 60 * time.Second
+)
+
+// Stack terminates the IP packets received from the admin TUN interface and
+// re-originates the TCP/UDP/ICMP flows from this host. Reply packets are
+// handed to the writer passed to New.
+type Stack struct {
+	stack  *stack.Stack
+	ep     *channel.Endpoint
+	write  func([]byte) error
+	filter func(network, host string, port int) bool
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(write func([]byte) error) (*Stack, error) {
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol, udp.NewProtocol, icmp.NewProtocol4, icmp.NewProtocol6},
+	})
+
+	ep := channel.New(queueSize, mtu, "")
+	if err := s.CreateNIC(nicID, ep); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to create NIC: %v", err)
+	}
+
+	// Accept packets for any destination and answer on its behalf.
+	if err := s.SetPromiscuousMode(nicID, true); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to enable promiscuous mode: %v", err)
+	}
+	if err := s.SetSpoofing(nicID, true); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to enable spoofing: %v", err)
+	}
+
+	s.SetRouteTable([]tcpip.Route{
+		{Destination: header.IPv4EmptySubnet, NIC: nicID},
+		{Destination: header.IPv6EmptySubnet, NIC: nicID},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ns := &Stack{
+		stack:  s,
+		ep:     ep,
+		write:  write,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	tcpForwarder := tcp.NewForwarder(s, 0, maxInFlight, ns.handleTCP)
+	s.SetTransportProtocolHandler(tcp.ProtocolNumber, tcpForwarder.HandlePacket)
+
+	udpForwarder := udp.NewForwarder(s, ns.handleUDP)
+	s.SetTransportProtocolHandler(udp.ProtocolNumber, udpForwarder.HandlePacket)
+
+	ns.wg.Add(1)
+	go ns.outboundLoop()
+
+	return ns, nil
+}
+
+// Inject feeds a raw IP packet captured on the admin side into the stack.
+func (ns *Stack) Inject(packet []byte) {
+	if len(packet) == 0 {
+		return
+	}
+
+	var proto tcpip.NetworkProtocolNumber
+	switch header.IPVersion(packet) {
+	case header.IPv4Version:
+		if isICMPEchoRequest(packet) {
+			go ns.handleICMPEcho(packet)
+			return
+		}
+		proto = ipv4.ProtocolNumber
+	case header.IPv6Version:
+		if isICMPv6EchoRequest(packet) {
+			go ns.handleICMPv6Echo(packet)
+			return
+		}
+		proto = ipv6.ProtocolNumber
+	default:
+		return
+	}
+
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Payload: buffer.MakeWithData(packet),
+	})
+	ns.ep.InjectInbound(proto, pkt)
+	pkt.DecRef()
+}
+
+// SetFilter makes the stack drop new flows for which allow returns false.
+// ICMP echo requests are checked with port 0. It must be called before the
+// first packet is injected.
+func (ns *Stack) SetFilter(allow func(network, host string, port int) bool) {
+	ns.filter = allow
+}
+
+func (ns *Stack) allowed(network, host string, port int) bool {
+	return ns.filter == nil || ns.filter(network, host, port)
+}
+
+func (ns *Stack) Close() {
+	ns.cancel()
+	ns.ep.Close()
+	ns.stack.Close()
+	ns.wg.Wait()
+}
+
+func (ns *Stack) outboundLoop() {
+	defer ns.wg.Done()
+
+	for {
+		pkt := ns.ep.ReadContext(ns.ctx)
+		if pkt == nil {
+			return
+		}
+
+		view := pkt.ToView()
+		packet := make([]byte, view.Size())
+		copy(packet, view.AsSlice())
+		view.Release()
+		pkt.DecRef()
+
+		if err := ns.write(packet); err != nil {
+			log.Printf("Netstack: failed to write reply packet: %v", err)
+		}
+	}
+}
+
+func (ns *Stack) handleTCP(r *tcp.ForwarderRequest) {
+	id := r.ID()
+	target := net.JoinHostPort(id.LocalAddress.String(), strconv.Itoa(int(id.LocalPort)))
+
+	if !ns.allowed("tcp", id.LocalAddress.String(), int(id.LocalPort)) {
+		r.Complete(true)
+		return
+	}
+
+	outConn, err := net.DialTimeout("tcp", target, dialTimeout)
+	if err != nil {
+		log.Printf("Netstack: TCP dial %s failed: %v", target, err)
+		r.Complete(true)
+		return
+	}
+
+	var wq waiter.Queue
+	ep, tcpErr := r.CreateEndpoint(&wq)
+	if tcpErr != nil {
+		log.Printf("Netstack: failed to create TCP endpoint for %s: %v", target, tcpErr)
+		outConn.Close()
+		r.Complete(true)
+		return
+	}
+	r.Complete(false)
+
+	inConn := gonet.NewTCPConn(&wq, ep)
+	log.Printf("Netstack: TCP flow %s:%d -> %s", id.RemoteAddress, id.RemotePort, target)
+
+	go splice(inConn, outConn)
+}
+
+func (ns *Stack) handleUDP(r *udp.ForwarderRequest) {
+	id := r.ID()
+	target := net.JoinHostPort(id.LocalAddress.String(), strconv.Itoa(int(id.LocalPort)))
+
+	if !ns.allowed("udp", id.LocalAddress.String(), int(id.LocalPort)) {
+		return
+	}
+
+	var wq waiter.Queue
+	ep, udpErr := r.CreateEndpoint(&wq)
+	if udpErr != nil {
+		log.Printf("Netstack: failed to create UDP endpoint for %s: %v", target, udpErr)
+		return
+	}
+	inConn := gonet.NewUDPConn(&wq, ep)
+
+	outConn, err := net.Dial("udp", target)
+	if err != nil {
+		log.Printf("Netstack: UDP dial %s failed: %v", target, err)
+		inConn.Close()
+		return
+	}
+
+	log.Printf("Netstack: UDP flow %s:%d -> %s", id.RemoteAddress, id.RemotePort, target)
+
+	go relayUDP(inConn, outConn)
+}
+
+func splice(a, b net.Conn) {
+	defer a.Close()
+	defer b.Close()
+
+	errChan := make(chan error, 2)
+
+	go func() {
+		_, err := io.Copy(a, b)
+		errChan <- err
+	}()
+
+	go func() {
+		_, err := io.Copy(b, a)
+		errChan <- err
+	}()
+
+	<-errChan
+}
+
+// relayUDP copies datagrams in both directions until the flow has been idle
+// for udpIdle.
+func relayUDP(inConn, outConn net.Conn) {
+	defer inConn.Close()
+	defer outConn.Close()
+
+	done := make(chan struct{}, 2)
+	copyDatagrams := func(dst, src net.Conn) {
+		buf := make([]byte, 65535)
+		for {
+			src.SetReadDeadline(time.Now().Add(udpIdle))
+			n, err := src.Read(buf)
+			if err != nil {
+				break
+			}
+			if _, err := dst.Write(buf[:n]); err != nil {
+				break
+			}
+		}
+		done <- struct{}{}
+	}
+
+	go copyDatagrams(outConn, inConn)
+	go copyDatagrams(inConn, outConn)
+
+	<-done
+}
@@ -0,0 +1,47 @@
+package protocol
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// FileChunkSize is the amount of file data carried by one DATA message.
+const FileChunkSize = 32 * 1024
+
+// PartialPath names the file that a transfer of content with checksum sum
+// into path is written to until it has been verified. Keying it on the
+// checksum lets an interrupted transfer resume without mixing in data from a
+// different file.
+func PartialPath(path, sum string) string {
+	if len(sum) > 16 {
+		sum = sum[:16]
+	}
+	return path + "." + sum + ".part"
+}
+
+// ResumeOffset returns where a transfer of size bytes continues given a
+// partial file of partSize bytes: the last complete chunk boundary, or zero
+// if the partial file cannot belong to the transfer.
+func ResumeOffset(partSize, size, chunkSize int64) int64 {
+	if partSize > size || chunkSize <= 0 {
+		return 0
+	}
+	return partSize / chunkSize * chunkSize
+}
+
+// HashFile returns the hex encoded SHA-256 of the file at path.
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
\ No newline at end of file
@@ -0,0 +1,74 @@
+package protocol
+
+import (
+	"fmt"
+
+	pb "github.com/bproxy/bproxy/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// Version is the protocol version spoken by this build. Agents that register
+// without a version predate negotiation and only support plain CONNECT.
+const Version = 7
+
+// Capabilities an agent can advertise when it registers.
+const (
+	CapConnect        = "connect"
+	CapConnectResult  = "connect-result"
+	CapTunnel         = "tunnel"
+	CapUDP            = "udp"
+	CapBind           = "bind"
+	CapReverseForward = "reverse-forward"
+	CapCommand        = "command"
+	CapExec           = "exec"
+	CapShell          = "shell"
+	CapShellRelay     = "shell-relay"
+	CapFile           = "file"
+	CapShutdown       = "shutdown"
+	CapLifetime       = "lifetime"
+)
+
+// Capabilities lists the features implemented by this build on every
+// platform. Agents add CapShell where they can allocate a pseudo-terminal,
+// while CapShellRelay only means SHELL streams are forwarded to descendants.
+var Capabilities = []string{
+	CapConnect,
+	CapConnectResult,
+	CapTunnel,
+	CapUDP,
+	CapBind,
+	CapReverseForward,
+	CapCommand,
+	CapExec,
+	CapShellRelay,
+	CapFile,
+	CapShutdown,
+	CapLifetime,
+}
+
+// LegacyCapabilities is assumed for agents that register without a version.
+var LegacyCapabilities = []string{CapConnect}
+
+// ParseConnectResponse decodes the reply to a CONNECT. Agents predating
+// ConnectResult answer with a DATA message reading "Connected" or "Failed".
+func ParseConnectResponse(msg *pb.Message) (*pb.ConnectResult, error) {
+	switch msg.Type {
+	case pb.MessageType_CONNECT_RESULT:
+		result := &pb.ConnectResult{}
+		if err := proto.Unmarshal(msg.Payload, result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	case pb.MessageType_DATA:
+		if string(msg.Payload) == "Connected" {
+			return &pb.ConnectResult{}, nil
+		}
+		return &pb.ConnectResult{
+			Error:     pb.ConnectError_CONNECT_GENERAL_FAILURE,
+			FailedHop: msg.SourceId,
+			Message:   string(msg.Payload),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unexpected %v response", msg.Type)
+	}
+}
\ No newline at end of file
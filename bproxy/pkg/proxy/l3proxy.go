@@ -1,32 +1,50 @@
 package proxy
 
 import (
+	"encoding/binary"
 	"fmt"
 	"log"
+	"net"
 	"sync"
+	"time"
 
 	pb "github.com/bproxy/bproxy/proto"
 	"github.com/bproxy/bproxy/admin"
+	"github.com/bproxy/bproxy/pkg/protocol"
+	"github.com/bproxy/bproxy/pkg/scope"
 	"google.golang.org/protobuf/proto"
 )
 
+// flowIdle is how long a flow may go without packets before it is forgotten
+// and its next packet is treated as a new flow.
+const flowIdle = 2 * time.Minute
+
 type L3Proxy struct {
 	tun       *TunProxy
 	admin     *admin.Admin
 	targetID  string
 	sessions  map[string]*ProxySession
-	mu        sync.RWMutex
+	lastSweep time.Time
+	mu        sync.Mutex
+	tunnel    net.Conn
+	tunnelMu  sync.Mutex
+	writeMu   sync.Mutex
 }
 
+// ProxySession remembers the scope decision for one flow. The decision only
+// holds for the scope it was made under.
 type ProxySession struct {
 	ID       string
 	SrcIP    string
 	DstIP    string
 	Protocol uint8
+	Denied   bool
+	scope    *scope.Scope
+	lastSeen time.Time
 }
 
-func NewL3Proxy(tunIP, tunMask, targetNet string, adminServer *admin.Admin, targetAgentID string) (*L3Proxy, error) {
-	tun, err := NewTunProxy(tunIP, tunMask, targetNet)
+func NewL3Proxy(tunName, tunIP, tunMask, targetNet string, adminServer *admin.Admin, targetAgentID string) (*L3Proxy, error) {
+	tun, err := NewTunProxy(tunName, tunIP, tunMask, targetNet)
 	if err != nil {
 		return nil, err
 	}
@@ -39,33 +57,126 @@ func NewL3Proxy(tunIP, tunMask, targetNet string, adminServer *admin.Admin, targ
 	}, nil
 }
 
+// Start opens the tunnel to the target agent and then carries the packets
+// read from the TUN interface in the background until Close is called.
 func (lp *L3Proxy) Start() error {
 	log.Printf("Starting L3 Proxy for target agent: %s", lp.targetID)
 
-	return lp.tun.Start(lp.handlePacket)
+	if _, err := lp.getTunnel(); err != nil {
+		return err
+	}
+
+	go func() {
+		err := lp.tun.Start(lp.handlePacket)
+		log.Printf("L3 Proxy on %s stopped: %v", lp.tun.Name(), err)
+	}()
+	return nil
+}
+
+// Name returns the name of the TUN interface.
+func (lp *L3Proxy) Name() string {
+	return lp.tun.Name()
+}
+
+func (lp *L3Proxy) TargetID() string {
+	return lp.targetID
+}
+
+// getTunnel returns the packet tunnel to the target agent, reopening it if
+// the previous one was torn down.
+func (lp *L3Proxy) getTunnel() (net.Conn, error) {
+	lp.tunnelMu.Lock()
+	defer lp.tunnelMu.Unlock()
+
+	if lp.tunnel != nil {
+		return lp.tunnel, nil
+	}
+
+	stream, err := lp.admin.OpenTunnel(lp.targetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tunnel to agent %s: %v", lp.targetID, err)
+	}
+
+	lp.tunnel = stream
+	go lp.readLoop(stream)
+
+	log.Printf("L3 tunnel opened to agent %s", lp.targetID)
+	return stream, nil
+}
+
+func (lp *L3Proxy) resetTunnel(stream net.Conn) {
+	lp.tunnelMu.Lock()
+	if lp.tunnel == stream {
+		lp.tunnel = nil
+	}
+	lp.tunnelMu.Unlock()
+
+	stream.Close()
+}
+
+func (lp *L3Proxy) readLoop(stream net.Conn) {
+	defer lp.resetTunnel(stream)
+
+	for {
+		msg, err := protocol.ReadMessage(stream)
+		if err != nil {
+			log.Printf("L3 tunnel to agent %s closed: %v", lp.targetID, err)
+			return
+		}
+
+		if msg.Type != pb.MessageType_DATA {
+			continue
+		}
+
+		dataPayload := &pb.DataPayload{}
+		if err := proto.Unmarshal(msg.Payload, dataPayload); err != nil {
+			log.Printf("Failed to unmarshal tunnel packet: %v", err)
+			continue
+		}
+
+		if err := lp.WritePacket(dataPayload.Data); err != nil {
+			log.Printf("Failed to write packet to TUN: %v", err)
+		}
+	}
 }
 
 func (lp *L3Proxy) handlePacket(packet []byte) error {
-	srcIP, dstIP, protocol, _, err := ParseIPPacket(packet)
+	srcIP, dstIP, ipProtocol, transport, err := ParseIPPacket(packet)
 	if err != nil {
 		return fmt.Errorf("failed to parse packet: %v", err)
 	}
 
-	log.Printf("L3 Proxy: %s -> %s (protocol: %d)", srcIP, dstIP, protocol)
+	network, dstPort := flowDestination(ipProtocol, transport)
+	sessionID := fmt.Sprintf("%s-%s-%d-%d", srcIP, dstIP, ipProtocol, dstPort)
 
-	sessionID := fmt.Sprintf("%s-%s-%d", srcIP, dstIP, protocol)
+	current := lp.admin.Scope()
+	now := time.Now()
 
 	lp.mu.Lock()
-	if _, exists := lp.sessions[sessionID]; !exists {
-		lp.sessions[sessionID] = &ProxySession{
+	lp.expireSessions(now)
+	session, exists := lp.sessions[sessionID]
+	if !exists || session.scope != current {
+		if !exists {
+			log.Printf("L3 Proxy: new %s flow %s -> %s:%d", network, srcIP, dstIP, dstPort)
+		}
+		session = &ProxySession{
 			ID:       sessionID,
 			SrcIP:    srcIP.String(),
 			DstIP:    dstIP.String(),
-			Protocol: protocol,
+			Protocol: ipProtocol,
+			Denied:   !lp.admin.InScope(srcIP.String(), lp.targetID, network, dstIP.String(), dstPort),
+			scope:    current,
 		}
+		lp.sessions[sessionID] = session
 	}
+	session.lastSeen = now
+	denied := session.Denied
 	lp.mu.Unlock()
 
+	if denied {
+		return nil
+	}
+
 	dataPayload := &pb.DataPayload{
 		Data:     packet,
 		Sequence: 0,
@@ -76,18 +187,65 @@ func (lp *L3Proxy) handlePacket(packet []byte) error {
 		return err
 	}
 
-	_ = &pb.Message{
+	msg := &pb.Message{
 		Type:      pb.MessageType_DATA,
 		SessionId: sessionID,
 		SourceId:  "admin",
 		TargetId:  lp.targetID,
+		Timestamp: time.Now().Unix(),
 		Payload:   payload,
 	}
 
-	return lp.admin.SendCommand(lp.targetID, &pb.CommandPayload{
-		Command: "forward_packet",
-		Args:    []string{sessionID},
-	})
+	stream, err := lp.getTunnel()
+	if err != nil {
+		return err
+	}
+
+	lp.writeMu.Lock()
+	err = protocol.WriteMessage(stream, msg)
+	lp.writeMu.Unlock()
+
+	if err != nil {
+		lp.resetTunnel(stream)
+		return fmt.Errorf("failed to send packet to agent %s: %v", lp.targetID, err)
+	}
+
+	return nil
+}
+
+// expireSessions drops the flows that have been idle for flowIdle, at most
+// once per flowIdle. lp.mu must be held.
+func (lp *L3Proxy) expireSessions(now time.Time) {
+	if now.Sub(lp.lastSweep) < flowIdle {
+		return
+	}
+	lp.lastSweep = now
+
+	for id, session := range lp.sessions {
+		if now.Sub(session.lastSeen) >= flowIdle {
+			delete(lp.sessions, id)
+		}
+	}
+}
+
+// flowDestination names the transport protocol of an IP packet and returns
+// its destination port, or 0 for protocols without ports.
+func flowDestination(ipProtocol uint8, transport []byte) (string, int) {
+	switch ipProtocol {
+	case 6, 17:
+		network := "tcp"
+		if ipProtocol == 17 {
+			network = "udp"
+		}
+		if len(transport) < 4 {
+			return network, 0
+		}
+		return network, int(binary.BigEndian.Uint16(transport[2:4]))
+	case 1, 58:
+		return "icmp", 0
+	default:
+		return fmt.Sprintf("ip/%d", ipProtocol), 0
+	}
 }
 
 func (lp *L3Proxy) WritePacket(packet []byte) error {
@@ -96,5 +254,12 @@ func (lp *L3Proxy) WritePacket(packet []byte) error {
 }
 
 func (lp *L3Proxy) Close() error {
+	lp.tunnelMu.Lock()
+	if lp.tunnel != nil {
+		lp.tunnel.Close()
+		lp.tunnel = nil
+	}
+	lp.tunnelMu.Unlock()
+
 	return lp.tun.Close()
 }
\ No newline at end of file
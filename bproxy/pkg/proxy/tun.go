@@ -16,10 +16,15 @@ type TunProxy struct {
 	targetNet string
 }
 
-func NewTunProxy(ipAddr, netmask, targetNet string) (*TunProxy, error) {
+// NewTunProxy creates the TUN interface name, or a kernel-named one if name
+// is empty, and routes targetNet through it. The interface address is
+// optional: without one the kernel picks the source address of another
+// interface, as ligolo-ng does.
+func NewTunProxy(name, ipAddr, netmask, targetNet string) (*TunProxy, error) {
 	config := water.Config{
 		DeviceType: water.TUN,
 	}
+	setInterfaceName(&config, name)
 
 	iface, err := water.New(config)
 	if err != nil {
@@ -44,12 +49,14 @@ func NewTunProxy(ipAddr, netmask, targetNet string) (*TunProxy, error) {
 func (tp *TunProxy) setupInterface() error {
 	ifaceName := tp.iface.Name()
 
-	cmd := exec.Command("ip", "addr", "add", fmt.Sprintf("%s/%s", tp.ipAddr, tp.netmask), "dev", ifaceName)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to set IP address: %v", err)
+	if tp.ipAddr != "" {
+		cmd := exec.Command("ip", "addr", "add", fmt.Sprintf("%s/%s", tp.ipAddr, tp.netmask), "dev", ifaceName)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to set IP address: %v", err)
+		}
 	}
 
-	cmd = exec.Command("ip", "link", "set", "dev", ifaceName, "up")
+	cmd := exec.Command("ip", "link", "set", "dev", ifaceName, "up")
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to bring interface up: %v", err)
 	}
@@ -59,10 +66,18 @@ func (tp *TunProxy) setupInterface() error {
 		log.Printf("Warning: failed to add route (may already exist): %v", err)
 	}
 
-	log.Printf("TUN interface %s configured: %s/%s -> %s", ifaceName, tp.ipAddr, tp.netmask, tp.targetNet)
+	if tp.ipAddr != "" {
+		log.Printf("TUN interface %s configured: %s/%s -> %s", ifaceName, tp.ipAddr, tp.netmask, tp.targetNet)
+	} else {
+		log.Printf("TUN interface %s configured -> %s", ifaceName, tp.targetNet)
+	}
 	return nil
 }
 
+func (tp *TunProxy) Name() string {
+	return tp.iface.Name()
+}
+
 func (tp *TunProxy) Read(buf []byte) (int, error) {
 	return tp.iface.Read(buf)
 }
@@ -100,20 +115,21 @@ func ParseIPPacket(packet []byte) (srcIP, dstIP net.IP, protocol uint8, payload
 		return nil, nil, 0, nil, fmt.Errorf("packet too short")
 	}
 
-	version := packet[0] >> 4
-	if version != 4 {
-		return nil, nil, 0, nil, fmt.Errorf("not IPv4 packet")
-	}
-
-	headerLen := int(packet[0]&0x0F) * 4
-	if len(packet) < headerLen {
-		return nil, nil, 0, nil, fmt.Errorf("invalid header length")
+	switch packet[0] >> 4 {
+	case 4:
+		headerLen := int(packet[0]&0x0F) * 4
+		if len(packet) < headerLen {
+			return nil, nil, 0, nil, fmt.Errorf("invalid header length")
+		}
+		return net.IP(packet[12:16]), net.IP(packet[16:20]), packet[9], packet[headerLen:], nil
+	case 6:
+		// Extension headers are not walked; the flow is keyed on the first
+		// next-header value, which is the transport protocol in practice.
+		if len(packet) < 40 {
+			return nil, nil, 0, nil, fmt.Errorf("packet too short")
+		}
+		return net.IP(packet[8:24]), net.IP(packet[24:40]), packet[6], packet[40:], nil
+	default:
+		return nil, nil, 0, nil, fmt.Errorf("unknown IP version %d", packet[0]>>4)
 	}
-
-	protocol = packet[9]
-	srcIP = net.IP(packet[12:16])
-	dstIP = net.IP(packet[16:20])
-	payload = packet[headerLen:]
-
-	return srcIP, dstIP, protocol, payload, nil
 }
\ No newline at end of file
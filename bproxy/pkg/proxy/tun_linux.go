@@ -0,0 +1,10 @@
+//go:build linux
+
+package proxy
+
+import "github.com/songgao/water"
+
+// setInterfaceName asks the kernel for a TUN interface called name.
+func setInterfaceName(config *water.Config, name string) {
+	config.Name = name
+}
\ No newline at end of file
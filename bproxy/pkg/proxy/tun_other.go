@@ -0,0 +1,9 @@
+//go:build !linux
+
+package proxy
+
+import "github.com/songgao/water"
+
+// setInterfaceName is a no-op where the interface is configured by hand
+// instead of with ip(8).
+func setInterfaceName(config *water.Config, name string) {}
\ No newline at end of file
@@ -0,0 +1,136 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// Window is a daily time range in local time. End may be earlier than Start
+// for windows spanning midnight. The zero Window allows any time.
+type Window struct {
+	Start time.Duration
+	End   time.Duration
+	set   bool
+}
+
+// ParseWindow parses a range such as "08:00-18:00" or "22:00-06:00". An
+// empty string returns the zero Window.
+func ParseWindow(s string) (Window, error) {
+	if s == "" {
+		return Window{}, nil
+	}
+
+	startStr, endStr, ok := strings.Cut(s, "-")
+	if !ok {
+		return Window{}, fmt.Errorf("invalid window %q, expected HH:MM-HH:MM", s)
+	}
+
+	start, err := parseClock(startStr)
+	if err != nil {
+		return Window{}, err
+	}
+	end, err := parseClock(endStr)
+	if err != nil {
+		return Window{}, err
+	}
+	if start == end {
+		return Window{}, fmt.Errorf("invalid window %q, start and end are equal", s)
+	}
+
+	return Window{Start: start, End: end, set: true}, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// IsZero reports whether the window allows any time.
+func (w Window) IsZero() bool {
+	return !w.set
+}
+
+func (w Window) String() string {
+	if !w.set {
+		return ""
+	}
+	return formatClock(w.Start) + "-" + formatClock(w.End)
+}
+
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
+
+// Contains reports whether t falls inside the window.
+func (w Window) Contains(t time.Time) bool {
+	if !w.set {
+		return true
+	}
+
+	offset := sinceMidnight(t)
+	if w.Start < w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// Until returns how long it is from t until the window opens, or zero if t
+// is inside it.
+func (w Window) Until(t time.Time) time.Duration {
+	if w.Contains(t) {
+		return 0
+	}
+
+	wait := w.Start - sinceMidnight(t)
+	if wait < 0 {
+		wait += day
+	}
+	return wait
+}
+
+// Remaining returns how long the window stays open after t, or zero if t is
+// outside it. It is zero for the zero Window, which never closes.
+func (w Window) Remaining(t time.Time) time.Duration {
+	if !w.set || !w.Contains(t) {
+		return 0
+	}
+
+	remaining := w.End - sinceMidnight(t)
+	if remaining <= 0 {
+		remaining += day
+	}
+	return remaining
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+}
+
+// ParseKillDate parses an RFC 3339 timestamp or a plain date. A plain date
+// means midnight at the start of that day in local time.
+func ParseKillDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid kill date %q, expected YYYY-MM-DD or RFC 3339", s)
+}
+
+// Earliest returns the earlier of two kill dates, treating the zero time as
+// no kill date.
+func Earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
\ No newline at end of file
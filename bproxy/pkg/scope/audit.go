@@ -0,0 +1,48 @@
+package scope
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditLog records connection attempts refused because their destination
+// is out of scope. Every entry is logged, and also appended to the audit
+// file if one was opened. A nil AuditLog only logs.
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenAuditLog appends audit entries to path, creating it if needed.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{file: f}, nil
+}
+
+// Denied records that source tried to reach host:port over network through
+// agent and was stopped by enforcer, the admin or the agent that refused it.
+func (l *AuditLog) Denied(enforcer, source, agent, network, host string, port int) {
+	log.Printf("Scope: denied %s %s:%d from %s via agent %s (enforced by %s)", network, host, port, source, agent, enforcer)
+
+	if l == nil || l.file == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.file, "%s DENY network=%s dst=%s:%d src=%s agent=%s enforcer=%s\n",
+		time.Now().Format(time.RFC3339), network, host, port, source, agent, enforcer)
+}
+
+func (l *AuditLog) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
\ No newline at end of file
@@ -0,0 +1,146 @@
+package scope
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DeniedMessage is reported by agents that refuse a destination because it
+// is out of their scope.
+const DeniedMessage = "destination out of scope"
+
+// Scope is an allowlist of destinations. Each rule is a Target, optionally
+// limited to a set of ports. A nil Scope allows every destination.
+type Scope struct {
+	rules []rule
+}
+
+type rule struct {
+	target Target
+	ports  []portRange
+}
+
+type portRange struct {
+	low  int
+	high int
+}
+
+// Load reads a scope file. See Parse for the format.
+func Load(path string) (*Scope, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return s, nil
+}
+
+// Parse reads one rule per line: a target followed by an optional comma
+// separated list of ports and port ranges, for example
+//
+//	10.0.0.0/8
+//	192.168.1.20 22,80,443
+//	*.corp.example.com 8000-8100
+//
+// Blank lines and text after '#' are ignored.
+func Parse(r io.Reader) (*Scope, error) {
+	s := &Scope{}
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: expected target and ports, got %q", lineNo, strings.TrimSpace(line))
+		}
+
+		rule, err := parseRule(fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		s.rules = append(s.rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func parseRule(fields []string) (rule, error) {
+	target, err := ParseTarget(fields[0])
+	if err != nil {
+		return rule{}, err
+	}
+	r := rule{target: target}
+
+	if len(fields) == 2 {
+		for _, item := range strings.Split(fields[1], ",") {
+			lowStr, highStr, isRange := strings.Cut(item, "-")
+			if !isRange {
+				highStr = lowStr
+			}
+			low, err1 := parsePort(lowStr)
+			high, err2 := parsePort(highStr)
+			if err1 != nil || err2 != nil || low > high {
+				return rule{}, fmt.Errorf("invalid port %q", item)
+			}
+			r.ports = append(r.ports, portRange{low: low, high: high})
+		}
+	}
+
+	return r, nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return port, nil
+}
+
+// Allows reports whether host:port is in scope, matching hosts as Target
+// does. A port of 0 matches any port, for protocols such as ICMP.
+func (s *Scope) Allows(host string, port int) bool {
+	if s == nil {
+		return true
+	}
+
+	for _, r := range s.rules {
+		if r.allowsPort(port) && r.target.Match(host) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r rule) allowsPort(port int) bool {
+	if len(r.ports) == 0 || port == 0 {
+		return true
+	}
+	for _, pr := range r.ports {
+		if port >= pr.low && port <= pr.high {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of rules.
+func (s *Scope) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.rules)
+}
\ No newline at end of file
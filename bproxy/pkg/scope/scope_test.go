@@ -0,0 +1,120 @@
+package scope
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		rules int
+		err   bool
+	}{
+		{name: "empty", input: "", rules: 0},
+		{name: "comments and blank lines", input: "# scope\n\n10.0.0.0/8 # lab\n", rules: 1},
+		{name: "all target kinds", input: "10.0.0.0/8\n192.168.1.20 22,80\nhost.example.com\n*.corp.example.com 8000-8100\n", rules: 4},
+		{name: "too many fields", input: "10.0.0.1 22 80", err: true},
+		{name: "bad CIDR", input: "10.0.0.0/33", err: true},
+		{name: "bad domain", input: "*.*.example.com", err: true},
+		{name: "port zero", input: "10.0.0.1 0", err: true},
+		{name: "port too large", input: "10.0.0.1 65536", err: true},
+		{name: "reversed range", input: "10.0.0.1 100-50", err: true},
+		{name: "empty port", input: "10.0.0.1 22,", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(strings.NewReader(tt.input))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("Parse(%q) succeeded, want error", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.input, err)
+			}
+			if s.Len() != tt.rules {
+				t.Errorf("Parse(%q) has %d rules, want %d", tt.input, s.Len(), tt.rules)
+			}
+		})
+	}
+}
+
+func TestAllows(t *testing.T) {
+	s, err := Parse(strings.NewReader(`
+10.0.0.0/8
+192.168.1.20 22,80,443
+host.example.com
+*.corp.example.com 8000-8100
+2001:db8::/32 443
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		host string
+		port int
+		want bool
+	}{
+		{name: "CIDR", host: "10.1.2.3", port: 443, want: true},
+		{name: "outside CIDR", host: "11.0.0.1", port: 443, want: false},
+		{name: "single IP listed port", host: "192.168.1.20", port: 22, want: true},
+		{name: "single IP unlisted port", host: "192.168.1.20", port: 8080, want: false},
+		{name: "single IP neighbour", host: "192.168.1.21", port: 22, want: false},
+		{name: "exact domain", host: "host.example.com", port: 80, want: true},
+		{name: "exact domain case and trailing dot", host: "HOST.example.com.", port: 80, want: true},
+		{name: "exact domain subdomain", host: "www.host.example.com", port: 80, want: false},
+		{name: "wildcard subdomain", host: "a.corp.example.com", port: 8080, want: true},
+		{name: "wildcard nested subdomain", host: "a.b.corp.example.com", port: 8000, want: true},
+		{name: "wildcard apex", host: "corp.example.com", port: 8080, want: false},
+		{name: "wildcard suffix only", host: "evilcorp.example.com", port: 8080, want: false},
+		{name: "range low end", host: "a.corp.example.com", port: 8000, want: true},
+		{name: "range high end", host: "a.corp.example.com", port: 8100, want: true},
+		{name: "outside range", host: "a.corp.example.com", port: 8101, want: false},
+		{name: "port zero matches any port", host: "192.168.1.20", port: 0, want: true},
+		{name: "port zero still checks host", host: "11.0.0.1", port: 0, want: false},
+		{name: "IPv4-mapped IPv6 in CIDR", host: "::ffff:10.0.0.1", port: 443, want: true},
+		{name: "IPv4-mapped IPv6 single IP", host: "::ffff:192.168.1.20", port: 22, want: true},
+		{name: "IPv4-mapped IPv6 outside", host: "::ffff:11.0.0.1", port: 443, want: false},
+		{name: "IPv6 CIDR", host: "2001:db8::1", port: 443, want: true},
+		{name: "bracketed IPv6", host: "[2001:db8::1]", port: 443, want: true},
+		{name: "IPv6 unlisted port", host: "2001:db8::1", port: 80, want: false},
+		{name: "name never matches address rule", host: "10.example.com", port: 443, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.Allows(tt.host, tt.port); got != tt.want {
+				t.Errorf("Allows(%q, %d) = %v, want %v", tt.host, tt.port, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowsIPv4MappedRule(t *testing.T) {
+	s, err := Parse(strings.NewReader("::ffff:10.0.0.1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, host := range []string{"10.0.0.1", "::ffff:10.0.0.1"} {
+		if !s.Allows(host, 80) {
+			t.Errorf("Allows(%q, 80) = false, want true", host)
+		}
+	}
+}
+
+func TestNilScopeAllowsAll(t *testing.T) {
+	var s *Scope
+	if !s.Allows("anything.example.com", 1234) {
+		t.Error("nil scope refused a destination")
+	}
+	if s.Len() != 0 {
+		t.Errorf("nil scope has %d rules", s.Len())
+	}
+}
\ No newline at end of file
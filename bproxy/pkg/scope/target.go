@@ -0,0 +1,87 @@
+package scope
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Target matches destination hosts: a CIDR, a single IP address, a domain,
+// or a "*."-prefixed wildcard matching the subdomains of a domain.
+type Target struct {
+	text     string
+	network  *net.IPNet
+	domain   string
+	wildcard bool
+}
+
+func ParseTarget(s string) (Target, error) {
+	t := Target{text: s}
+
+	switch {
+	case strings.Contains(s, "/"):
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return Target{}, fmt.Errorf("invalid CIDR %q", s)
+		}
+		t.network = network
+	case net.ParseIP(s) != nil:
+		ip := net.ParseIP(s)
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		t.network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	default:
+		domain, wildcard := strings.CutPrefix(normalizeDomain(s), "*.")
+		if domain == "" || strings.Contains(domain, "*") {
+			return Target{}, fmt.Errorf("invalid domain %q", s)
+		}
+		t.domain, t.wildcard = domain, wildcard
+	}
+
+	return t, nil
+}
+
+func normalizeDomain(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// Match reports whether host is covered by the target. IP addresses only
+// match address targets and names only match domain targets; names are
+// never resolved.
+func (t Target) Match(host string) bool {
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	if t.network != nil {
+		return ip != nil && t.network.Contains(ip)
+	}
+	if ip != nil {
+		return false
+	}
+
+	domain := normalizeDomain(host)
+	if t.wildcard {
+		return strings.HasSuffix(domain, "."+t.domain)
+	}
+	return domain == t.domain
+}
+
+// Specificity orders targets matching the same host, higher being more
+// specific: the prefix length for addresses, the number of labels for
+// domains, with an exact domain beating a wildcard.
+func (t Target) Specificity() int {
+	if t.network != nil {
+		ones, _ := t.network.Mask.Size()
+		return ones
+	}
+
+	labels := 2 * (strings.Count(t.domain, ".") + 1)
+	if !t.wildcard {
+		labels++
+	}
+	return labels
+}
+
+func (t Target) String() string {
+	return t.text
+}
\ No newline at end of file
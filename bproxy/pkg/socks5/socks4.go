@@ -0,0 +1,107 @@
+package socks5
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+)
+
+const (
+	Socks4Version  = 0x04
+	Socks4Granted  = 0x5A
+	Socks4Rejected = 0x5B
+
+	// maxSocks4Field bounds the null-terminated USERID and hostname fields.
+	maxSocks4Field = 255
+)
+
+// versionConn replays the bytes buffered while peeking at the version.
+type versionConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *versionConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// PeekVersion returns the SOCKS version byte sent by the client without
+// consuming it. The returned conn must be used for everything that follows.
+func PeekVersion(conn net.Conn) (net.Conn, byte, error) {
+	reader := bufio.NewReader(conn)
+	version, err := reader.Peek(1)
+	if err != nil {
+		return nil, 0, fmt.Errorf("read version failed: %v", err)
+	}
+	return &versionConn{Conn: conn, reader: reader}, version[0], nil
+}
+
+// ParseSocks4Request reads a SOCKS4 request, or a SOCKS4a request whose
+// DSTIP is 0.0.0.x and carries the hostname to be resolved by the proxy.
+// The returned request has AddrType IPv4Address or DomainName.
+func ParseSocks4Request(conn net.Conn) (*Request, error) {
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, fmt.Errorf("read SOCKS4 request failed: %v", err)
+	}
+
+	if buf[0] != Socks4Version {
+		return nil, fmt.Errorf("invalid SOCKS4 version")
+	}
+
+	req := &Request{
+		Version:  buf[0],
+		Command:  buf[1],
+		AddrType: IPv4Address,
+		DstAddr:  net.IP(buf[4:8]).String(),
+		DstPort:  binary.BigEndian.Uint16(buf[2:4]),
+	}
+
+	userID, err := readNullTerminated(conn)
+	if err != nil {
+		return nil, fmt.Errorf("read SOCKS4 user ID failed: %v", err)
+	}
+	req.UserID = userID
+
+	// SOCKS4a: 0.0.0.x with x != 0 means a hostname follows
+	if buf[4] == 0 && buf[5] == 0 && buf[6] == 0 && buf[7] != 0 {
+		host, err := readNullTerminated(conn)
+		if err != nil {
+			return nil, fmt.Errorf("read SOCKS4a hostname failed: %v", err)
+		}
+		if host == "" {
+			return nil, fmt.Errorf("empty SOCKS4a hostname")
+		}
+		req.AddrType = DomainName
+		req.DstAddr = host
+	}
+
+	return req, nil
+}
+
+func readNullTerminated(r io.Reader) (string, error) {
+	var field []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		if b[0] == 0 {
+			return string(field), nil
+		}
+		if len(field) == maxSocks4Field {
+			return "", fmt.Errorf("field longer than %d bytes", maxSocks4Field)
+		}
+		field = append(field, b[0])
+	}
+}
+
+// SendSocks4Reply sends a SOCKS4 reply with status Socks4Granted or
+// Socks4Rejected.
+func SendSocks4Reply(conn net.Conn, status byte) error {
+	reply := []byte{0x00, status, 0, 0, 0, 0, 0, 0}
+	_, err := conn.Write(reply)
+	return err
+}
\ No newline at end of file
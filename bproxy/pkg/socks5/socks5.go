@@ -1,19 +1,27 @@
 package socks5
 
 import (
+	"bytes"
+	"crypto/subtle"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"strings"
 )
 
 const (
-	Socks5Version = 0x05
-	NoAuth        = 0x00
-	ConnectCmd    = 0x01
-	IPv4Address   = 0x01
-	DomainName    = 0x03
-	IPv6Address   = 0x04
+	Socks5Version   = 0x05
+	NoAuth          = 0x00
+	UserPassAuth    = 0x02
+	NoAcceptable    = 0xFF
+	ConnectCmd      = 0x01
+	BindCmd         = 0x02
+	UDPAssociateCmd = 0x03
+	IPv4Address     = 0x01
+	DomainName      = 0x03
+	IPv6Address     = 0x04
 )
 
 type Request struct {
@@ -23,25 +31,94 @@ type Request struct {
 	AddrType byte
 	DstAddr  string
 	DstPort  uint16
+	UserID   string // SOCKS4 only
 }
 
+// userPassVersion is the sub-negotiation version of RFC 1929.
+const userPassVersion = 0x01
+
+var (
+	ErrNoAcceptableMethod = errors.New("no acceptable authentication method offered")
+	ErrAuthFailed         = errors.New("username/password authentication failed")
+)
+
 func HandleSocks5Handshake(conn net.Conn) error {
-	buf := make([]byte, 256)
+	return HandleSocks5HandshakeWithAuth(conn, "", "")
+}
 
-	n, err := conn.Read(buf)
-	if err != nil {
+// HandleSocks5HandshakeWithAuth negotiates the authentication method from
+// the ones the client offers. When username is not empty the client must
+// authenticate with username and password (RFC 1929); otherwise no
+// authentication is used. If the client offers neither, the reply is 0xFF
+// and ErrNoAcceptableMethod is returned.
+func HandleSocks5HandshakeWithAuth(conn net.Conn, username, password string) error {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
 		return fmt.Errorf("read handshake failed: %v", err)
 	}
 
-	if n < 2 || buf[0] != Socks5Version {
+	if header[0] != Socks5Version {
 		return fmt.Errorf("invalid SOCKS5 version")
 	}
 
-	_, err = conn.Write([]byte{Socks5Version, NoAuth})
-	if err != nil {
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return fmt.Errorf("read auth methods failed: %v", err)
+	}
+
+	method := byte(NoAuth)
+	if username != "" {
+		method = UserPassAuth
+	}
+	if !bytes.Contains(methods, []byte{method}) {
+		conn.Write([]byte{Socks5Version, NoAcceptable})
+		return ErrNoAcceptableMethod
+	}
+
+	if _, err := conn.Write([]byte{Socks5Version, method}); err != nil {
 		return fmt.Errorf("write auth response failed: %v", err)
 	}
 
+	if method == UserPassAuth {
+		return authenticate(conn, username, password)
+	}
+	return nil
+}
+
+// authenticate runs the RFC 1929 sub-negotiation.
+func authenticate(conn net.Conn, username, password string) error {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return fmt.Errorf("read auth request failed: %v", err)
+	}
+	if header[0] != userPassVersion {
+		return fmt.Errorf("invalid auth version %d", header[0])
+	}
+
+	user := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, user); err != nil {
+		return fmt.Errorf("read username failed: %v", err)
+	}
+
+	passLen := make([]byte, 1)
+	if _, err := io.ReadFull(conn, passLen); err != nil {
+		return fmt.Errorf("read password failed: %v", err)
+	}
+	pass := make([]byte, passLen[0])
+	if _, err := io.ReadFull(conn, pass); err != nil {
+		return fmt.Errorf("read password failed: %v", err)
+	}
+
+	userOK := subtle.ConstantTimeCompare(user, []byte(username)) == 1
+	passOK := subtle.ConstantTimeCompare(pass, []byte(password)) == 1
+	if !userOK || !passOK {
+		conn.Write([]byte{userPassVersion, 0x01})
+		return ErrAuthFailed
+	}
+
+	if _, err := conn.Write([]byte{userPassVersion, 0x00}); err != nil {
+		return fmt.Errorf("write auth status failed: %v", err)
+	}
 	return nil
 }
 
@@ -62,59 +139,140 @@ func ParseRequest(conn net.Conn) (*Request, error) {
 		return nil, fmt.Errorf("invalid SOCKS5 version in request")
 	}
 
-	if req.Command != ConnectCmd {
+	if req.Command != ConnectCmd && req.Command != BindCmd && req.Command != UDPAssociateCmd {
 		return nil, fmt.Errorf("unsupported command: %d", req.Command)
 	}
 
-	switch req.AddrType {
+	addr, port, err := readAddress(conn, req.AddrType)
+	if err != nil {
+		return nil, err
+	}
+	req.DstAddr = addr
+	req.DstPort = port
+
+	return req, nil
+}
+
+func readAddress(r io.Reader, addrType byte) (string, uint16, error) {
+	var host string
+
+	switch addrType {
 	case IPv4Address:
 		addr := make([]byte, 4)
-		if _, err := io.ReadFull(conn, addr); err != nil {
-			return nil, fmt.Errorf("read IPv4 address failed: %v", err)
+		if _, err := io.ReadFull(r, addr); err != nil {
+			return "", 0, fmt.Errorf("read IPv4 address failed: %v", err)
 		}
-		req.DstAddr = net.IP(addr).String()
+		host = net.IP(addr).String()
 
 	case DomainName:
 		lenBuf := make([]byte, 1)
-		if _, err := io.ReadFull(conn, lenBuf); err != nil {
-			return nil, fmt.Errorf("read domain length failed: %v", err)
+		if _, err := io.ReadFull(r, lenBuf); err != nil {
+			return "", 0, fmt.Errorf("read domain length failed: %v", err)
 		}
 		domainLen := int(lenBuf[0])
 		domain := make([]byte, domainLen)
-		if _, err := io.ReadFull(conn, domain); err != nil {
-			return nil, fmt.Errorf("read domain failed: %v", err)
+		if _, err := io.ReadFull(r, domain); err != nil {
+			return "", 0, fmt.Errorf("read domain failed: %v", err)
 		}
-		req.DstAddr = string(domain)
+		host = string(domain)
 
 	case IPv6Address:
 		addr := make([]byte, 16)
-		if _, err := io.ReadFull(conn, addr); err != nil {
-			return nil, fmt.Errorf("read IPv6 address failed: %v", err)
+		if _, err := io.ReadFull(r, addr); err != nil {
+			return "", 0, fmt.Errorf("read IPv6 address failed: %v", err)
 		}
-		req.DstAddr = net.IP(addr).String()
+		host = net.IP(addr).String()
 
 	default:
-		return nil, fmt.Errorf("unsupported address type: %d", req.AddrType)
+		return "", 0, fmt.Errorf("unsupported address type: %d", addrType)
 	}
 
 	portBuf := make([]byte, 2)
-	if _, err := io.ReadFull(conn, portBuf); err != nil {
-		return nil, fmt.Errorf("read port failed: %v", err)
+	if _, err := io.ReadFull(r, portBuf); err != nil {
+		return "", 0, fmt.Errorf("read port failed: %v", err)
 	}
-	req.DstPort = binary.BigEndian.Uint16(portBuf)
 
-	return req, nil
+	return host, binary.BigEndian.Uint16(portBuf), nil
+}
+
+// appendAddress encodes host and port as ATYP, DST.ADDR and DST.PORT.
+func appendAddress(b []byte, host string, port uint16) []byte {
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			b = append(b, IPv4Address)
+			b = append(b, ip4...)
+		} else {
+			b = append(b, IPv6Address)
+			b = append(b, ip.To16()...)
+		}
+	} else {
+		b = append(b, DomainName, byte(len(host)))
+		b = append(b, host...)
+	}
+
+	return binary.BigEndian.AppendUint16(b, port)
+}
+
+// UDPDatagram is a datagram sent to or received from a UDP ASSOCIATE relay.
+type UDPDatagram struct {
+	Frag    byte
+	DstAddr string
+	DstPort uint16
+	Data    []byte
+}
+
+func ParseUDPDatagram(packet []byte) (*UDPDatagram, error) {
+	if len(packet) < 4 {
+		return nil, fmt.Errorf("UDP datagram too short")
+	}
+
+	r := bytes.NewReader(packet[4:])
+	addr, port, err := readAddress(r, packet[3])
+	if err != nil {
+		return nil, err
+	}
+
+	return &UDPDatagram{
+		Frag:    packet[2],
+		DstAddr: addr,
+		DstPort: port,
+		Data:    packet[len(packet)-r.Len():],
+	}, nil
+}
+
+func BuildUDPDatagram(host string, port uint16, data []byte) []byte {
+	packet := appendAddress([]byte{0x00, 0x00, 0x00}, host, port)
+	return append(packet, data...)
 }
 
 func SendReply(conn net.Conn, rep byte) error {
-	reply := []byte{
-		Socks5Version,
-		rep,
-		0x00,
-		0x01,
-		0, 0, 0, 0,
-		0, 0,
+	return SendReplyAddr(conn, rep, nil)
+}
+
+// SendReplyAddr sends a reply carrying addr as BND.ADDR and BND.PORT.
+func SendReplyAddr(conn net.Conn, rep byte, addr net.Addr) error {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return SendReplyHost(conn, rep, a.IP.String(), uint16(a.Port))
+	case *net.UDPAddr:
+		return SendReplyHost(conn, rep, a.IP.String(), uint16(a.Port))
 	}
+	return SendReplyHost(conn, rep, "", 0)
+}
+
+// SendReplyHost sends a reply carrying host and port as BND.ADDR and
+// BND.PORT. host is encoded as an IPv4 or IPv6 address when it is one and
+// as a domain name otherwise; an empty host is sent as 0.0.0.0.
+func SendReplyHost(conn net.Conn, rep byte, host string, port uint16) error {
+	// Zones are only meaningful on the agent's host
+	if addr, zone, ok := strings.Cut(host, "%"); ok && zone != "" && net.ParseIP(addr) != nil {
+		host = addr
+	}
+	if host == "" {
+		host = "0.0.0.0"
+	}
+
+	reply := appendAddress([]byte{Socks5Version, rep, 0x00}, host, port)
 	_, err := conn.Write(reply)
 	return err
 }
@@ -0,0 +1,72 @@
+package tls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"time"
+)
+
+const (
+	caValidity     = 10 * 365 * 24 * time.Hour
+	clientValidity = 365 * 24 * time.Hour
+)
+
+// GenerateCA creates a self-signed certificate authority used to issue agent
+// client certificates for mutual TLS.
+func GenerateCA(commonName string) ([]byte, []byte, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template, err := newTemplate(pkix.Name{Organization: []string{"BProxy"}, CommonName: commonName}, caValidity)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.IsCA = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	template.MaxPathLenZero = true
+
+	return createPEM(template, template, priv, priv)
+}
+
+// IssueClientCert signs a client certificate for commonName with the CA key
+// pair. The common name identifies the agent presenting the certificate.
+func IssueClientCert(caCertFile, caKeyFile, commonName string) ([]byte, []byte, error) {
+	ca, err := tls.LoadX509KeyPair(caCertFile, caKeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load CA: %v", err)
+	}
+
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CA certificate: %v", err)
+	}
+	if !caCert.IsCA {
+		return nil, nil, fmt.Errorf("%s is not a CA certificate", caCertFile)
+	}
+
+	caKey, ok := ca.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported CA key type %T", ca.PrivateKey)
+	}
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template, err := newTemplate(pkix.Name{Organization: []string{"BProxy"}, CommonName: commonName}, clientValidity)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+
+	return createPEM(template, caCert, priv, caKey)
+}
\ No newline at end of file
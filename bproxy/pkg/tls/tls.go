@@ -1,83 +1,307 @@
 package tls
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/hex"
 	"encoding/pem"
+	"fmt"
 	"math/big"
+	"net"
 	"os"
+	"strings"
 	"time"
 )
 
+const handshakeTimeout = 10 * time.Second
+
 func GenerateSelfSignedCert() (tls.Certificate, error) {
-	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	certPEM, keyPEM, err := generateSelfSignedPEM()
 	if err != nil {
 		return tls.Certificate{}, err
 	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
 
-	notBefore := time.Now()
-	notAfter := notBefore.Add(365 * 24 * time.Hour)
+func generateSelfSignedPEM() ([]byte, []byte, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template, err := newTemplate(pkix.Name{Organization: []string{"BProxy"}}, 365*24*time.Hour)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.KeyUsage = x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+
+	return createPEM(template, template, priv, priv)
+}
 
+func newTemplate(subject pkix.Name, validity time.Duration) (*x509.Certificate, error) {
 	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
 	if err != nil {
-		return tls.Certificate{}, err
+		return nil, err
 	}
 
-	template := x509.Certificate{
-		SerialNumber: serialNumber,
-		Subject: pkix.Name{
-			Organization: []string{"BProxy"},
-		},
+	notBefore := time.Now()
+	return &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               subject,
 		NotBefore:             notBefore,
-		NotAfter:              notAfter,
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		NotAfter:              notBefore.Add(validity),
 		BasicConstraintsValid: true,
+	}, nil
+}
+
+// createPEM signs template with parentKey and returns the PEM encoded
+// certificate and the PEM encoded private key of priv.
+func createPEM(template, parent *x509.Certificate, priv, parentKey *ecdsa.PrivateKey) ([]byte, []byte, error) {
+	derBytes, err := x509.CreateCertificate(rand.Reader, template, parent, &priv.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	privBytes, err := x509.MarshalECPrivateKey(priv)
 	if err != nil {
-		return tls.Certificate{}, err
+		return nil, nil, err
 	}
 
 	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
-	privBytes, err := x509.MarshalECPrivateKey(priv)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privBytes})
+	return certPEM, keyPEM, nil
+}
+
+// WriteKeyPair stores a PEM certificate and key, readable by the owner only.
+// Existing files are never replaced; callers that mean to overwrite a key
+// pair must remove it first.
+func WriteKeyPair(certFile, keyFile string, certPEM, keyPEM []byte) error {
+	if err := writeNewFile(certFile, certPEM); err != nil {
+		return err
+	}
+	if err := writeNewFile(keyFile, keyPEM); err != nil {
+		os.Remove(certFile)
+		return err
+	}
+	return nil
+}
+
+func writeNewFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// LoadOrGenerateCert loads the key pair from certFile and keyFile. If both
+// files are missing a self-signed certificate is generated and, when both
+// paths are given, written there so the identity survives a restart. Finding
+// only one of the two is an error rather than a reason to overwrite it.
+func LoadOrGenerateCert(certFile, keyFile string) (tls.Certificate, error) {
+	certExists, err := fileExists(certFile)
 	if err != nil {
 		return tls.Certificate{}, err
 	}
-	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privBytes})
+	keyExists, err := fileExists(keyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	switch {
+	case certExists && keyExists:
+		return tls.LoadX509KeyPair(certFile, keyFile)
+	case certExists:
+		return tls.Certificate{}, fmt.Errorf("certificate %s exists but key %s is missing", certFile, keyFile)
+	case keyExists:
+		return tls.Certificate{}, fmt.Errorf("key %s exists but certificate %s is missing", keyFile, certFile)
+	}
+
+	certPEM, keyPEM, err := generateSelfSignedPEM()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	if certFile != "" && keyFile != "" {
+		if err := WriteKeyPair(certFile, keyFile, certPEM, keyPEM); err != nil {
+			return tls.Certificate{}, fmt.Errorf("failed to save generated certificate: %v", err)
+		}
+	}
 
 	return tls.X509KeyPair(certPEM, keyPEM)
 }
 
-func LoadOrGenerateCert(certFile, keyFile string) (tls.Certificate, error) {
-	if _, err := os.Stat(certFile); err == nil {
-		if _, err := os.Stat(keyFile); err == nil {
-			return tls.LoadX509KeyPair(certFile, keyFile)
+func fileExists(path string) (bool, error) {
+	if path == "" {
+		return false, nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
 		}
+		return false, err
 	}
-	return GenerateSelfSignedCert()
+	return true, nil
 }
 
-func GetServerTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+// GetServerTLSConfig returns the listener configuration. When clientCAFile
+// is given, peers must present a client certificate issued by one of the CAs
+// in that bundle.
+func GetServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
 	cert, err := LoadOrGenerateCert(certFile, keyFile)
 	if err != nil {
 		return nil, err
 	}
 
-	return &tls.Config{
+	config := &tls.Config{
 		Certificates: []tls.Certificate{cert},
 		MinVersion:   tls.VersionTLS12,
-	}, nil
+	}
+
+	if clientCAFile != "" {
+		pool, err := LoadCertPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// LoadCertPool reads a PEM bundle of CA certificates.
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+
+	return pool, nil
+}
+
+// LoadClientCertificate adds the key pair to config so it is presented to
+// servers requiring mutual TLS. It returns the certificate's common name,
+// which is the identity the peer will bind the connection to.
+func LoadClientCertificate(config *tls.Config, certFile, keyFile string) (string, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to load client certificate: %v", err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return "", fmt.Errorf("failed to parse client certificate: %v", err)
+	}
+
+	config.Certificates = []tls.Certificate{cert}
+	return leaf.Subject.CommonName, nil
+}
+
+// PeerIdentity completes the handshake on conn and returns the common name
+// of the verified client certificate, or "" if none was verified.
+func PeerIdentity(conn net.Conn) (string, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return "", err
+	}
+
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return "", nil
+	}
+
+	return state.PeerCertificates[0].Subject.CommonName, nil
+}
+
+// Fingerprint returns the hex encoded SHA-256 of the certificate's
+// SubjectPublicKeyInfo.
+func Fingerprint(cert tls.Certificate) (string, error) {
+	if len(cert.Certificate) == 0 {
+		return "", fmt.Errorf("empty certificate")
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return "", err
+	}
+
+	return spkiFingerprint(leaf), nil
+}
+
+func spkiFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:])
 }
 
-func GetClientTLSConfig() *tls.Config {
-	return &tls.Config{
+// NormalizeFingerprint accepts fingerprints with an optional "sha256:"
+// prefix, colons and any letter case.
+func NormalizeFingerprint(fingerprint string) string {
+	fingerprint = strings.ToLower(strings.TrimSpace(fingerprint))
+	fingerprint = strings.TrimPrefix(fingerprint, "sha256:")
+	return strings.ReplaceAll(fingerprint, ":", "")
+}
+
+// GetClientTLSConfig returns the agent side TLS configuration. The peer uses
+// a self-signed certificate, so chain verification is skipped; when a
+// fingerprint is given the peer's public key must match it instead.
+func GetClientTLSConfig(fingerprint string) *tls.Config {
+	config := &tls.Config{
 		InsecureSkipVerify: true,
 		MinVersion:         tls.VersionTLS12,
 	}
+
+	if fingerprint == "" {
+		return config
+	}
+
+	pinned := NormalizeFingerprint(fingerprint)
+	config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("peer presented no certificate")
+		}
+
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return fmt.Errorf("failed to parse peer certificate: %v", err)
+		}
+
+		actual := spkiFingerprint(cert)
+		if subtle.ConstantTimeCompare([]byte(actual), []byte(pinned)) != 1 {
+			return fmt.Errorf("peer certificate fingerprint %s does not match pinned %s", actual, pinned)
+		}
+
+		return nil
+	}
+
+	return config
 }
\ No newline at end of file
@@ -10,12 +10,18 @@ type NodeInfo struct {
 	ID           string
 	Hostname     string
 	LocalIPs     []string
+	Networks     []string
 	OS           string
 	Arch         string
 	ParentID     string
 	Children     []string
 	LastSeen     time.Time
 	IsActive     bool
+	Retired      bool
+	Version      uint32
+	Capabilities []string
+	KillDate     time.Time
+	WorkingHours string
 }
 
 type Topology struct {
@@ -35,9 +41,18 @@ func (t *Topology) AddNode(id, hostname string, localIPs []string, os, arch stri
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
+	// A known ID re-registering is the same agent after a restart: refresh
+	// what may have changed and detach it from its old parent. The caller
+	// re-attaches it with AddEdge if it came in through a cascade.
 	if node, exists := t.nodes[id]; exists {
+		node.Hostname = hostname
+		node.LocalIPs = localIPs
+		node.OS = os
+		node.Arch = arch
 		node.LastSeen = time.Now()
 		node.IsActive = true
+		node.Retired = false
+		t.detach(id)
 		return
 	}
 
@@ -94,6 +109,7 @@ func (t *Topology) AddEdge(parentID, childID string) error {
 		}
 	}
 
+	t.detach(childID)
 	t.edges[parentID] = append(t.edges[parentID], childID)
 	t.nodes[childID].ParentID = parentID
 	t.nodes[parentID].Children = append(t.nodes[parentID].Children, childID)
@@ -101,6 +117,109 @@ func (t *Topology) AddEdge(parentID, childID string) error {
 	return nil
 }
 
+// RetireNode marks a node that was shut down on purpose, as opposed to one
+// that stopped responding.
+func (t *Topology) RetireNode(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if node, exists := t.nodes[id]; exists {
+		node.IsActive = false
+		node.Retired = true
+	}
+}
+
+// Subtree returns id and all of its descendants, ordered so that every node
+// comes before its parent.
+func (t *Topology) Subtree(id string) []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var ids []string
+	var walk func(string)
+	walk = func(current string) {
+		for _, child := range t.edges[current] {
+			walk(child)
+		}
+		ids = append(ids, current)
+	}
+	walk(id)
+	return ids
+}
+
+// SetProtocol records the protocol version and capabilities an agent
+// advertised when it registered.
+func (t *Topology) SetProtocol(id string, version uint32, capabilities []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if node, exists := t.nodes[id]; exists {
+		node.Version = version
+		node.Capabilities = capabilities
+	}
+}
+
+// SetNetworks records the subnets an agent reported, in CIDR notation.
+func (t *Topology) SetNetworks(id string, networks []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if node, exists := t.nodes[id]; exists {
+		node.Networks = networks
+	}
+}
+
+// SetLifetime records the kill date and working hours an agent runs with.
+func (t *Topology) SetLifetime(id string, killDate time.Time, workingHours string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if node, exists := t.nodes[id]; exists {
+		node.KillDate = killDate
+		node.WorkingHours = workingHours
+	}
+}
+
+// HasCapability reports whether the agent advertised capability.
+func (t *Topology) HasCapability(id, capability string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	node, exists := t.nodes[id]
+	if !exists {
+		return false
+	}
+	for _, c := range node.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// detach removes id from its parent's children. Callers must hold t.mu.
+func (t *Topology) detach(id string) {
+	node := t.nodes[id]
+	if node.ParentID == "" {
+		return
+	}
+
+	t.edges[node.ParentID] = removeID(t.edges[node.ParentID], id)
+	if parent, exists := t.nodes[node.ParentID]; exists {
+		parent.Children = removeID(parent.Children, id)
+	}
+	node.ParentID = ""
+}
+
+func removeID(ids []string, id string) []string {
+	for i, existing := range ids {
+		if existing == id {
+			return append(ids[:i:i], ids[i+1:]...)
+		}
+	}
+	return ids
+}
+
 func (t *Topology) GetNode(id string) (*NodeInfo, bool) {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
@@ -0,0 +1,209 @@
+package tui
+
+import (
+        "fmt"
+        "strings"
+        "unicode/utf8"
+
+        "github.com/bproxy/bproxy/admin"
+        pb "github.com/bproxy/bproxy/proto"
+        "github.com/charmbracelet/bubbletea"
+        "github.com/charmbracelet/lipgloss"
+)
+
+const (
+        execPanelLines = 12
+        execMaxLines   = 500
+        // Output without newlines is broken into lines of at most this size
+        execMaxLineLen = 4096
+)
+
+var stderrStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF6666"))
+
+// execView holds the output of the last process started on a node.
+type execView struct {
+        session *admin.ExecSession
+        title   string
+        lines   []execLine
+        partial [2]string
+        status  string
+}
+
+type execLine struct {
+        text   string
+        stderr bool
+}
+
+type execOutputMsg struct {
+        nodeID  string
+        session *admin.ExecSession
+        output  *pb.ExecOutput
+}
+
+type execDoneMsg struct {
+        nodeID   string
+        session  *admin.ExecSession
+        exitCode int32
+        err      error
+}
+
+// waitExecOutput delivers the next chunk of output, or the exit status once
+// the process has finished.
+func waitExecOutput(nodeID string, session *admin.ExecSession) tea.Cmd {
+        return func() tea.Msg {
+                output, ok := <-session.Output
+                if !ok {
+                        exitCode, err := session.Wait()
+                        return execDoneMsg{nodeID: nodeID, session: session, exitCode: exitCode, err: err}
+                }
+                return execOutputMsg{nodeID: nodeID, session: session, output: output}
+        }
+}
+
+func (m *Model) startExec(argv []string) tea.Cmd {
+        if len(argv) == 0 {
+                m.appendOutput("Usage: exec <command> [args...]")
+                return nil
+        }
+        node, ok := m.selectedActiveNode()
+        if !ok {
+                return nil
+        }
+
+        if view, exists := m.execs[node.ID]; exists && view.status == "" {
+                m.appendOutput(fmt.Sprintf("Error: %s is still running on %s (c to cancel)", view.title, shortID(node.ID)))
+                return nil
+        }
+
+        session, err := m.admin.Exec(node.ID, argv, nil)
+        if err != nil {
+                m.appendOutput(fmt.Sprintf("Error: %v", err))
+                return nil
+        }
+
+        m.execs[node.ID] = &execView{session: session, title: strings.Join(argv, " ")}
+        m.appendOutput(fmt.Sprintf("✓ Started %s on %s", argv[0], shortID(node.ID)))
+
+        return waitExecOutput(node.ID, session)
+}
+
+func (m *Model) cancelExec() {
+        if m.selectedIndex >= len(m.nodes) {
+                return
+        }
+        node := m.nodes[m.selectedIndex]
+
+        view, exists := m.execs[node.ID]
+        if !exists || view.status != "" {
+                m.appendOutput("Error: No running process on the selected node")
+                return
+        }
+
+        if err := view.session.Cancel(); err != nil {
+                m.appendOutput(fmt.Sprintf("Error: %v", err))
+                return
+        }
+        m.appendOutput(fmt.Sprintf("Cancelling %s on %s...", view.title, shortID(node.ID)))
+}
+
+func (m *Model) updateExec(msg tea.Msg) tea.Cmd {
+        switch msg := msg.(type) {
+        case execOutputMsg:
+                if view, exists := m.execs[msg.nodeID]; exists && view.session == msg.session {
+                        view.append(msg.output)
+                }
+                return waitExecOutput(msg.nodeID, msg.session)
+
+        case execDoneMsg:
+                if view, exists := m.execs[msg.nodeID]; exists && view.session == msg.session {
+                        view.finish(msg.exitCode, msg.err)
+                        m.appendOutput(fmt.Sprintf("%s on %s: %s", view.title, shortID(msg.nodeID), view.status))
+                }
+        }
+        return nil
+}
+
+func (v *execView) append(output *pb.ExecOutput) {
+        index := int(output.Stream)
+        if index > 1 {
+                return
+        }
+
+        parts := strings.Split(v.partial[index]+string(output.Data), "\n")
+        v.partial[index] = parts[len(parts)-1]
+        for _, line := range parts[:len(parts)-1] {
+                v.lines = append(v.lines, execLine{text: strings.TrimRight(line, "\r"), stderr: index == 1})
+        }
+        for len(v.partial[index]) > execMaxLineLen {
+                cut := execMaxLineLen
+                for cut > execMaxLineLen-utf8.UTFMax && !utf8.RuneStart(v.partial[index][cut]) {
+                        cut--
+                }
+                v.lines = append(v.lines, execLine{text: v.partial[index][:cut], stderr: index == 1})
+                v.partial[index] = v.partial[index][cut:]
+        }
+
+        if len(v.lines) > execMaxLines {
+                v.lines = v.lines[len(v.lines)-execMaxLines:]
+        }
+}
+
+func (v *execView) finish(exitCode int32, err error) {
+        for index, partial := range v.partial {
+                if partial != "" {
+                        v.lines = append(v.lines, execLine{text: partial, stderr: index == 1})
+                        v.partial[index] = ""
+                }
+        }
+
+        v.status = fmt.Sprintf("exit %d", exitCode)
+        if err != nil {
+                v.status += fmt.Sprintf(" (%v)", err)
+        }
+}
+
+// renderExec shows the output of the process started on the selected node.
+func (m Model) renderExec() string {
+        if m.selectedIndex >= len(m.nodes) {
+                return ""
+        }
+        node := m.nodes[m.selectedIndex]
+
+        view, exists := m.execs[node.ID]
+        if !exists {
+                return ""
+        }
+
+        status := view.status
+        if status == "" {
+                status = "running"
+        }
+
+        var sb strings.Builder
+        sb.WriteString(lipgloss.NewStyle().
+                Bold(true).
+                Foreground(lipgloss.Color("#FFA500")).
+                Render(fmt.Sprintf("⚙ Exec on %s: %s [%s]", shortID(node.ID), view.title, status)))
+        sb.WriteString("\n")
+
+        lines := view.lines
+        for index, partial := range view.partial {
+                if partial != "" {
+                        lines = append(lines[:len(lines):len(lines)], execLine{text: partial, stderr: index == 1})
+                }
+        }
+        if len(lines) > execPanelLines {
+                lines = lines[len(lines)-execPanelLines:]
+        }
+
+        for _, line := range lines {
+                sb.WriteString("\n")
+                if line.stderr {
+                        sb.WriteString(stderrStyle.Render(line.text))
+                } else {
+                        sb.WriteString(line.text)
+                }
+        }
+
+        return sb.String()
+}
\ No newline at end of file
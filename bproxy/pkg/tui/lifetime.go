@@ -0,0 +1,46 @@
+package tui
+
+import (
+        "fmt"
+        "strings"
+        "time"
+
+        "github.com/bproxy/bproxy/pkg/topology"
+)
+
+// lifetimeWarning is the remaining lifetime below which it is highlighted.
+const lifetimeWarning = 24 * time.Hour
+
+// renderLifetime describes how long a node has left before its kill date and
+// when it may be connected, or returns "" if it has no limits.
+func renderLifetime(node *topology.NodeInfo) string {
+        var parts []string
+
+        if !node.KillDate.IsZero() {
+                remaining := time.Until(node.KillDate)
+                switch {
+                case remaining <= 0:
+                        parts = append(parts, deadNodeStyle.Render("kill date passed"))
+                case remaining < lifetimeWarning:
+                        parts = append(parts, outdatedStyle.Render(formatRemaining(remaining)+" left"))
+                default:
+                        parts = append(parts, formatRemaining(remaining)+" left")
+                }
+        }
+        if node.WorkingHours != "" {
+                parts = append(parts, "hours "+node.WorkingHours)
+        }
+
+        return strings.Join(parts, ", ")
+}
+
+func formatRemaining(d time.Duration) string {
+        switch {
+        case d >= 24*time.Hour:
+                return fmt.Sprintf("%dd %dh", int(d/(24*time.Hour)), int(d%(24*time.Hour)/time.Hour))
+        case d >= time.Hour:
+                return fmt.Sprintf("%dh %dm", int(d/time.Hour), int(d%time.Hour/time.Minute))
+        default:
+                return d.Round(time.Second).String()
+        }
+}
\ No newline at end of file
@@ -0,0 +1,114 @@
+package tui
+
+import (
+        "fmt"
+        "strconv"
+        "strings"
+
+        "github.com/charmbracelet/lipgloss"
+)
+
+// maxShownRoutes limits the route table in the console.
+const maxShownRoutes = 10
+
+// routeCommand handles "rsocks <port> [user:pass]", "route <target|default>"
+// and "unroute <target|default>". Routes point at the selected node.
+func (m *Model) routeCommand(fields []string) {
+        switch fields[0] {
+        case "rsocks":
+                if len(fields) != 2 && len(fields) != 3 {
+                        m.appendOutput("Usage: rsocks <port> [user:pass]")
+                        return
+                }
+                port, err := strconv.Atoi(fields[1])
+                if err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: invalid port %s", fields[1]))
+                        return
+                }
+                var username, password string
+                if len(fields) == 3 {
+                        username, password, _ = strings.Cut(fields[2], ":")
+                }
+                if err := m.admin.StartRoutedSocks5(port, username, password); err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: %v", err))
+                        return
+                }
+                m.appendOutput(fmt.Sprintf("✓ Routed SOCKS5 proxy started on :%d", port))
+
+        case "route":
+                if len(fields) != 2 {
+                        m.appendOutput("Usage: route <cidr|ip|domain|*.domain|default>")
+                        return
+                }
+                node, ok := m.selectedActiveNode()
+                if !ok {
+                        return
+                }
+                if fields[1] == "default" {
+                        m.admin.SetDefaultRoute(node.ID)
+                        m.appendOutput(fmt.Sprintf("✓ Default route -> %s", shortID(node.ID)))
+                        return
+                }
+                if err := m.admin.AddRoute(fields[1], node.ID); err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: %v", err))
+                        return
+                }
+                m.appendOutput(fmt.Sprintf("✓ Route %s -> %s", fields[1], shortID(node.ID)))
+
+        case "unroute":
+                if len(fields) != 2 {
+                        m.appendOutput("Usage: unroute <target|default>")
+                        return
+                }
+                if fields[1] == "default" {
+                        m.admin.SetDefaultRoute("")
+                        m.appendOutput("✓ Default route removed")
+                        return
+                }
+                if err := m.admin.RemoveRoute(fields[1]); err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: %v", err))
+                        return
+                }
+                m.appendOutput(fmt.Sprintf("✓ Route %s removed", fields[1]))
+        }
+}
+
+// renderRoutes shows the route table while a routed SOCKS5 proxy is running
+// or routes were set by hand.
+func (m Model) renderRoutes() string {
+        routes := m.admin.GetRoutes()
+        defaultRoute := m.admin.DefaultRoute()
+        manual := defaultRoute != "" || len(routes) > 0 && !routes[0].Auto
+        if !m.admin.RoutingActive() && !manual {
+                return ""
+        }
+
+        var sb strings.Builder
+        sb.WriteString(lipgloss.NewStyle().
+                Foreground(lipgloss.Color("#00FF00")).
+                Render(fmt.Sprintf("Routes: %d", len(routes))))
+        sb.WriteString("\n")
+
+        for i, route := range routes {
+                if i == maxShownRoutes {
+                        sb.WriteString(fmt.Sprintf("  … %d more\n", len(routes)-maxShownRoutes))
+                        break
+                }
+                origin := "manual"
+                if route.Auto {
+                        origin = "auto"
+                }
+                sb.WriteString(fmt.Sprintf("  • %-20s -> %s (%s)\n", route.Target, shortID(route.AgentID), origin))
+        }
+
+        if defaultRoute != "" {
+                sb.WriteString(fmt.Sprintf("  • %-20s -> %s\n", "default", shortID(defaultRoute)))
+        } else {
+                sb.WriteString(lipgloss.NewStyle().
+                        Foreground(lipgloss.Color("#888888")).
+                        Render("  • no default route, unmatched destinations fail"))
+                sb.WriteString("\n")
+        }
+
+        return sb.String()
+}
\ No newline at end of file
@@ -0,0 +1,147 @@
+package tui
+
+import (
+        "bytes"
+        "fmt"
+        "io"
+        "os"
+        "os/signal"
+        "strings"
+        "sync/atomic"
+
+        "github.com/bproxy/bproxy/admin"
+        "github.com/charmbracelet/bubbletea"
+        "github.com/charmbracelet/x/term"
+        "github.com/muesli/cancelreader"
+)
+
+// detachKey (Ctrl-]) ends an attached shell session from the TUI.
+const detachKey = 0x1d
+
+type shellDoneMsg struct {
+        agentID  string
+        exitCode int32
+        detached bool
+        err      error
+}
+
+// shellAttach runs a remote shell on the local terminal while the TUI is
+// suspended. It implements tea.ExecCommand.
+type shellAttach struct {
+        admin    *admin.Admin
+        agentID  string
+        stdin    io.Reader
+        stdout   io.Writer
+        exitCode int32
+        detached atomic.Bool
+}
+
+func (s *shellAttach) SetStdin(r io.Reader)  { s.stdin = r }
+func (s *shellAttach) SetStdout(w io.Writer) { s.stdout = w }
+func (s *shellAttach) SetStderr(w io.Writer) {}
+
+func (s *shellAttach) Run() error {
+        fd := os.Stdin.Fd()
+
+        var rows, cols uint32
+        if width, height, err := term.GetSize(os.Stdout.Fd()); err == nil {
+                rows, cols = uint32(height), uint32(width)
+        }
+
+        shell, err := s.admin.OpenShell(s.agentID, os.Getenv("TERM"), rows, cols)
+        if err != nil {
+                return err
+        }
+        defer shell.Close()
+
+        state, err := term.MakeRaw(fd)
+        if err != nil {
+                return fmt.Errorf("failed to put terminal into raw mode: %v", err)
+        }
+        defer term.Restore(fd, state)
+
+        fmt.Fprintf(s.stdout, "Attached to %s, press Ctrl-] to close the shell\r\n", shortID(s.agentID))
+
+        input, err := cancelreader.NewReader(s.stdin)
+        if err != nil {
+                return err
+        }
+        defer input.Close()
+
+        go func() {
+                buf := make([]byte, 1024)
+                for {
+                        n, err := input.Read(buf)
+                        if err != nil {
+                                return
+                        }
+                        data := buf[:n]
+                        if i := bytes.IndexByte(data, detachKey); i >= 0 {
+                                shell.Write(data[:i])
+                                s.detached.Store(true)
+                                shell.Close()
+                                return
+                        }
+                        if _, err := shell.Write(data); err != nil {
+                                return
+                        }
+                }
+        }()
+
+        resize := make(chan os.Signal, 1)
+        notifyResize(resize)
+        defer signal.Stop(resize)
+
+        go func() {
+                for range resize {
+                        if width, height, err := term.GetSize(os.Stdout.Fd()); err == nil {
+                                shell.Resize(uint32(height), uint32(width))
+                        }
+                }
+        }()
+
+        io.Copy(s.stdout, shell)
+        input.Cancel()
+
+        exitCode, err := shell.Wait()
+        s.exitCode = exitCode
+        if s.detached.Load() {
+                return nil
+        }
+        return err
+}
+
+// attachShell suspends the TUI and attaches the terminal to a shell on the
+// selected node.
+func (m *Model) attachShell() tea.Cmd {
+        node, ok := m.selectedActiveNode()
+        if !ok {
+                return nil
+        }
+
+        attach := &shellAttach{admin: m.admin, agentID: node.ID}
+        return tea.Exec(attach, func(err error) tea.Msg {
+                return shellDoneMsg{agentID: node.ID, exitCode: attach.exitCode, detached: attach.detached.Load(), err: err}
+        })
+}
+
+func (m *Model) showShellDone(msg shellDoneMsg) {
+        if msg.detached {
+                m.appendOutput(fmt.Sprintf("Shell on %s closed", shortID(msg.agentID)))
+                return
+        }
+        if msg.err != nil {
+                m.appendOutput(fmt.Sprintf("Shell on %s: %v", shortID(msg.agentID), msg.err))
+                return
+        }
+        m.appendOutput(fmt.Sprintf("Shell on %s exited with code %d", shortID(msg.agentID), msg.exitCode))
+}
+
+// shellListenAddr turns a port into a loopback TCP address; anything
+// containing a slash is a Unix socket path.
+func shellListenAddr(arg string) (string, string) {
+        if strings.Contains(arg, "/") {
+                return "unix", arg
+        }
+        return "tcp", localForwardAddr(arg)
+}
\ No newline at end of file
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package tui
+
+import (
+        "os"
+        "os/signal"
+        "syscall"
+)
+
+func notifyResize(ch chan<- os.Signal) {
+        signal.Notify(ch, syscall.SIGWINCH)
+}
\ No newline at end of file
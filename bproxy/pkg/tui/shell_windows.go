@@ -0,0 +1,8 @@
+//go:build windows
+
+package tui
+
+import "os"
+
+// notifyResize is a no-op on Windows, which has no SIGWINCH.
+func notifyResize(ch chan<- os.Signal) {}
\ No newline at end of file
@@ -0,0 +1,42 @@
+package tui
+
+import (
+        "fmt"
+
+        "github.com/charmbracelet/bubbletea"
+)
+
+type shutdownResultMsg struct {
+        agentID string
+        retired []string
+        err     error
+}
+
+// shutdownNode retires the selected node, or with cascade its whole subtree,
+// in the background.
+func (m *Model) shutdownNode(cascade bool) tea.Cmd {
+        node, ok := m.selectedActiveNode()
+        if !ok {
+                return nil
+        }
+
+        reason := "shutdown from admin console"
+        if cascade {
+                reason = "teardown from admin console"
+        }
+
+        m.appendOutput(fmt.Sprintf("Shutting down %s...", shortID(node.ID)))
+        return func() tea.Msg {
+                retired, err := m.admin.Shutdown(node.ID, cascade, reason)
+                return shutdownResultMsg{agentID: node.ID, retired: retired, err: err}
+        }
+}
+
+func (m *Model) showShutdownResult(msg shutdownResultMsg) {
+        for _, id := range msg.retired {
+                m.appendOutput(fmt.Sprintf("✓ Agent %s retired", shortID(id)))
+        }
+        if msg.err != nil {
+                m.appendOutput(fmt.Sprintf("Error: %v", msg.err))
+        }
+}
\ No newline at end of file
@@ -0,0 +1,142 @@
+package tui
+
+import (
+        "fmt"
+        "strings"
+
+        "github.com/bproxy/bproxy/admin"
+        "github.com/charmbracelet/bubbletea"
+        "github.com/charmbracelet/lipgloss"
+)
+
+// maxShownTransfers limits the console to the most recent transfers.
+const maxShownTransfers = 5
+
+type transferDoneMsg struct {
+        transfer *admin.FileTransfer
+        err      error
+}
+
+func waitTransfer(transfer *admin.FileTransfer) tea.Cmd {
+        return func() tea.Msg {
+                return transferDoneMsg{transfer: transfer, err: transfer.Wait()}
+        }
+}
+
+// startTransfer handles "put <local> <remote>" and "get <remote> [local]".
+func (m *Model) startTransfer(upload bool, args []string) tea.Cmd {
+        if upload && len(args) != 2 {
+                m.appendOutput("Usage: put <local file> <remote path>")
+                return nil
+        }
+        if !upload && len(args) != 1 && len(args) != 2 {
+                m.appendOutput("Usage: get <remote path> [local file]")
+                return nil
+        }
+        node, ok := m.selectedActiveNode()
+        if !ok {
+                return nil
+        }
+
+        var transfer *admin.FileTransfer
+        var err error
+        if upload {
+                transfer, err = m.admin.Upload(node.ID, args[0], args[1])
+        } else {
+                localPath := remoteBase(args[0])
+                if len(args) == 2 {
+                        localPath = args[1]
+                }
+                transfer, err = m.admin.Download(node.ID, args[0], localPath)
+        }
+        if err != nil {
+                m.appendOutput(fmt.Sprintf("Error: %v", err))
+                return nil
+        }
+
+        m.appendOutput(fmt.Sprintf("✓ Transfer %s started: %s", transfer.ID, describeTransfer(transfer)))
+        return waitTransfer(transfer)
+}
+
+func (m *Model) showTransferDone(msg transferDoneMsg) {
+        if msg.err != nil {
+                m.appendOutput(fmt.Sprintf("✗ Transfer %s failed: %v", msg.transfer.ID, msg.err))
+                return
+        }
+        _, size := msg.transfer.Progress()
+        m.appendOutput(fmt.Sprintf("✓ Transfer %s done (%s, SHA-256 verified)", msg.transfer.ID, formatBytes(size)))
+}
+
+func (m Model) renderTransfers() string {
+        transfers := m.admin.GetTransfers()
+        if len(transfers) == 0 {
+                return ""
+        }
+        if len(transfers) > maxShownTransfers {
+                transfers = transfers[len(transfers)-maxShownTransfers:]
+        }
+
+        var sb strings.Builder
+        sb.WriteString(lipgloss.NewStyle().
+                Foreground(lipgloss.Color("#00FF00")).
+                Render("File Transfers:"))
+        sb.WriteString("\n")
+
+        for _, transfer := range transfers {
+                transferred, size := transfer.Progress()
+
+                state := progressBar(transferred, size)
+                if transfer.Done() {
+                        if transfer.Wait() != nil {
+                                state = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Render("failed")
+                        } else {
+                                state = "done"
+                        }
+                }
+
+                sb.WriteString(fmt.Sprintf("  • [%s] %s %s %s/%s\n",
+                        transfer.ID, describeTransfer(transfer), state, formatBytes(transferred), formatBytes(size)))
+        }
+
+        return sb.String()
+}
+
+func describeTransfer(transfer *admin.FileTransfer) string {
+        if transfer.Upload {
+                return fmt.Sprintf("%s ↑ %s:%s", transfer.LocalPath, shortID(transfer.AgentID), transfer.RemotePath)
+        }
+        return fmt.Sprintf("%s:%s ↓ %s", shortID(transfer.AgentID), transfer.RemotePath, transfer.LocalPath)
+}
+
+func progressBar(done, total int64) string {
+        const width = 10
+
+        filled := width
+        if total > 0 {
+                filled = int(done * width / total)
+        }
+        return "[" + strings.Repeat("█", filled) + strings.Repeat("░", width-filled) + "]"
+}
+
+func formatBytes(n int64) string {
+        const unit = 1024
+        if n < unit {
+                return fmt.Sprintf("%dB", n)
+        }
+
+        div, exp := int64(unit), 0
+        for v := n / unit; v >= unit; v /= unit {
+                div *= unit
+                exp++
+        }
+        return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// remoteBase returns the last element of an agent path, which may use either
+// slash style depending on the agent's platform.
+func remoteBase(path string) string {
+        if i := strings.LastIndexAny(path, `/\`); i >= 0 && i < len(path)-1 {
+                return path[i+1:]
+        }
+        return path
+}
\ No newline at end of file
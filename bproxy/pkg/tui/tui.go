@@ -2,12 +2,16 @@ package tui
 
 import (
         "fmt"
+        "net"
+        "strconv"
         "strings"
         "time"
 
         "github.com/charmbracelet/bubbletea"
         "github.com/charmbracelet/lipgloss"
         "github.com/bproxy/bproxy/admin"
+        pb "github.com/bproxy/bproxy/proto"
+        "github.com/bproxy/bproxy/pkg/protocol"
         "github.com/bproxy/bproxy/pkg/topology"
 )
 
@@ -26,6 +30,12 @@ var (
                         Foreground(lipgloss.Color("#FF0000")).
                         Strikethrough(true)
 
+        outdatedStyle = lipgloss.NewStyle().
+                        Foreground(lipgloss.Color("#FFA500"))
+
+        retiredNodeStyle = lipgloss.NewStyle().
+                        Foreground(lipgloss.Color("#888888"))
+
         selectedStyle = lipgloss.NewStyle().
                         Foreground(lipgloss.Color("#FFFF00")).
                         Background(lipgloss.Color("#333333")).
@@ -44,12 +54,23 @@ var (
 
 type tickMsg time.Time
 
+// commandResultMsg carries the response of a command run on an agent.
+type commandResultMsg struct {
+        agentID  string
+        command  string
+        response *pb.CommandResponse
+        err      error
+}
+
 type Model struct {
         admin         *admin.Admin
         selectedIndex int
         nodes         []*topology.NodeInfo
         consoleInput  string
+        inputMode     bool
         consoleOutput []string
+        execs         map[string]*execView
+        tunnels       map[string]*tunnelView
         width         int
         height        int
 }
@@ -59,6 +80,8 @@ func NewModel(adminServer *admin.Admin) Model {
                 admin:         adminServer,
                 selectedIndex: 0,
                 consoleOutput: []string{"BProxy Admin Console - Ready"},
+                execs:         make(map[string]*execView),
+                tunnels:       make(map[string]*tunnelView),
         }
 }
 
@@ -78,10 +101,18 @@ func tickCmd() tea.Cmd {
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
         switch msg := msg.(type) {
         case tea.KeyMsg:
+                if m.inputMode {
+                        return m.updateInput(msg)
+                }
+
                 switch msg.String() {
                 case "ctrl+c", "q":
                         return m, tea.Quit
 
+                case ":":
+                        m.inputMode = true
+                        m.consoleInput = ""
+
                 case "up", "k":
                         if m.selectedIndex > 0 {
                                 m.selectedIndex--
@@ -96,8 +127,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
                         if m.selectedIndex < len(m.nodes) {
                                 node := m.nodes[m.selectedIndex]
                                 m.consoleOutput = append(m.consoleOutput,
-                                        fmt.Sprintf("Selected: %s (%s)", node.ID, node.Hostname))
-                                if len(m.consoleOutput) > 10 {
+                                        fmt.Sprintf("Selected: %s (%s)", node.ID, node.Hostname),
+                                        fmt.Sprintf("  Protocol v%d: %s", node.Version, strings.Join(node.Capabilities, ", ")))
+                                for len(m.consoleOutput) > 10 {
                                         m.consoleOutput = m.consoleOutput[1:]
                                 }
                         }
@@ -107,7 +139,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
                                 node := m.nodes[m.selectedIndex]
                                 if !node.IsActive {
                                         m.consoleOutput = append(m.consoleOutput,
-                                                fmt.Sprintf("Error: Agent %s is offline", node.ID[:8]))
+                                                fmt.Sprintf("Error: Agent %s is offline", shortID(node.ID)))
                                 } else {
                                         err := m.admin.StartSocks5(1080, node.ID)
                                         if err != nil {
@@ -115,7 +147,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
                                                         fmt.Sprintf("Error: %v", err))
                                         } else {
                                                 m.consoleOutput = append(m.consoleOutput,
-                                                        fmt.Sprintf("✓ SOCKS5 proxy started on :1080 -> %s", node.ID[:8]))
+                                                        fmt.Sprintf("✓ SOCKS5 proxy started on :1080 -> %s", shortID(node.ID)))
                                         }
                                 }
                                 if len(m.consoleOutput) > 10 {
@@ -142,6 +174,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
                                 m.consoleOutput = m.consoleOutput[1:]
                         }
 
+                case "c":
+                        m.cancelExec()
+
                 case "h":
                         m.consoleOutput = []string{
                                 "Keyboard Shortcuts:",
@@ -150,6 +185,28 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
                                 "Enter: Select node",
                                 "s: Start SOCKS5 proxy (:1080)",
                                 "x: Stop SOCKS5 proxy",
+                                ":: Command prompt",
+                                "  fwd <lport> <host:port>",
+                                "  unfwd <lport>",
+                                "  rfwd <agent port> <host:port>",
+                                "  unrfwd <id>",
+                                "  socks <port> [user:pass]",
+                                "  unsocks <port>",
+                                "  rsocks <port> [user:pass] (routed)",
+                                "  route <cidr|domain|default>",
+                                "  unroute <target|default>",
+                                "  tun <cidr> [interface] (L3)",
+                                "  untun <interface>",
+                                "  http <port> [user:pass]",
+                                "  unhttp <port>",
+                                "  cmd <ping|info|routes|lifetime>",
+                                "  exec <command> [args...]",
+                                "  shell [port|socket]",
+                                "  unshell <port|socket>",
+                                "  put <local> <remote>",
+                                "  get <remote> [local]",
+                                "  shutdown | teardown (with children)",
+                                "c: Cancel exec",
                                 "r: Refresh",
                                 "h: Help",
                                 "q/Ctrl+C: Quit",
@@ -163,11 +220,353 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
         case tickMsg:
                 m.nodes = m.admin.GetTopology().GetAllNodes()
                 return m, tickCmd()
+
+        case commandResultMsg:
+                m.showCommandResult(msg)
+
+        case shutdownResultMsg:
+                m.showShutdownResult(msg)
+
+        case transferDoneMsg:
+                m.showTransferDone(msg)
+
+        case shellDoneMsg:
+                m.showShellDone(msg)
+
+        case execOutputMsg, execDoneMsg:
+                return m, m.updateExec(msg)
         }
 
         return m, nil
 }
 
+func (m *Model) appendOutput(line string) {
+        m.consoleOutput = append(m.consoleOutput, line)
+        if len(m.consoleOutput) > 10 {
+                m.consoleOutput = m.consoleOutput[1:]
+        }
+}
+
+func (m Model) updateInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+        switch msg.Type {
+        case tea.KeyCtrlC:
+                return m, tea.Quit
+
+        case tea.KeyEsc:
+                m.inputMode = false
+                m.consoleInput = ""
+
+        case tea.KeyEnter:
+                m.inputMode = false
+                line := m.consoleInput
+                m.consoleInput = ""
+
+                // Agent commands wait for a response, so they run in the background
+                if fields := strings.Fields(line); len(fields) > 0 {
+                        switch fields[0] {
+                        case "cmd":
+                                return m, m.agentCommand(fields[1:])
+                        case "exec":
+                                return m, m.startExec(fields[1:])
+                        case "shutdown", "teardown":
+                                return m, m.shutdownNode(fields[0] == "teardown")
+                        case "put", "get":
+                                return m, m.startTransfer(fields[0] == "put", fields[1:])
+                        case "shell":
+                                if len(fields) == 1 {
+                                        return m, m.attachShell()
+                                }
+                        }
+                }
+                m.runCommand(line)
+
+        case tea.KeyBackspace:
+                if len(m.consoleInput) > 0 {
+                        runes := []rune(m.consoleInput)
+                        m.consoleInput = string(runes[:len(runes)-1])
+                }
+
+        case tea.KeySpace:
+                m.consoleInput += " "
+
+        case tea.KeyRunes:
+                m.consoleInput += string(msg.Runes)
+        }
+
+        return m, nil
+}
+
+// runCommand executes a line entered at the ':' prompt against the
+// selected node.
+func (m *Model) runCommand(line string) {
+        fields := strings.Fields(line)
+        if len(fields) == 0 {
+                return
+        }
+
+        switch fields[0] {
+        case "fwd":
+                if len(fields) != 3 {
+                        m.appendOutput("Usage: fwd <lport> <host:port>")
+                        return
+                }
+                node, ok := m.selectedActiveNode()
+                if !ok {
+                        return
+                }
+                host, portStr, err := net.SplitHostPort(fields[2])
+                if err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: %v", err))
+                        return
+                }
+                port, err := strconv.Atoi(portStr)
+                if err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: invalid port %s", portStr))
+                        return
+                }
+                localAddr := localForwardAddr(fields[1])
+                if err := m.admin.StartPortForward(localAddr, node.ID, host, port); err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: %v", err))
+                        return
+                }
+                m.appendOutput(fmt.Sprintf("✓ Forward %s -> %s via %s", localAddr, fields[2], shortID(node.ID)))
+
+        case "unfwd":
+                if len(fields) != 2 {
+                        m.appendOutput("Usage: unfwd <lport>")
+                        return
+                }
+                localAddr := localForwardAddr(fields[1])
+                if err := m.admin.StopPortForward(localAddr); err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: %v", err))
+                        return
+                }
+                m.appendOutput(fmt.Sprintf("✓ Forward %s stopped", localAddr))
+
+        case "rfwd":
+                if len(fields) != 3 {
+                        m.appendOutput("Usage: rfwd <agent port> <host:port>")
+                        return
+                }
+                node, ok := m.selectedActiveNode()
+                if !ok {
+                        return
+                }
+                remoteAddr := fields[1]
+                if _, err := strconv.Atoi(remoteAddr); err == nil {
+                        remoteAddr = "0.0.0.0:" + remoteAddr
+                }
+                forwardID, err := m.admin.StartReverseForward(node.ID, remoteAddr, fields[2])
+                if err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: %v", err))
+                        return
+                }
+                m.appendOutput(fmt.Sprintf("✓ Reverse forward %s: %s %s -> %s", forwardID, shortID(node.ID), remoteAddr, fields[2]))
+
+        case "unrfwd":
+                if len(fields) != 2 {
+                        m.appendOutput("Usage: unrfwd <id>")
+                        return
+                }
+                if err := m.admin.StopReverseForward(fields[1]); err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: %v", err))
+                        return
+                }
+                m.appendOutput(fmt.Sprintf("✓ Reverse forward %s stopped", fields[1]))
+
+        case "socks":
+                if len(fields) != 2 && len(fields) != 3 {
+                        m.appendOutput("Usage: socks <port> [user:pass]")
+                        return
+                }
+                node, ok := m.selectedActiveNode()
+                if !ok {
+                        return
+                }
+                port, err := strconv.Atoi(fields[1])
+                if err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: invalid port %s", fields[1]))
+                        return
+                }
+                var username, password string
+                if len(fields) == 3 {
+                        username, password, _ = strings.Cut(fields[2], ":")
+                }
+                if err := m.admin.StartSocks5WithAuth(port, node.ID, username, password); err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: %v", err))
+                        return
+                }
+                m.appendOutput(fmt.Sprintf("✓ SOCKS5 proxy started on :%d -> %s", port, shortID(node.ID)))
+
+        case "unsocks":
+                if len(fields) != 2 {
+                        m.appendOutput("Usage: unsocks <port>")
+                        return
+                }
+                port, err := strconv.Atoi(fields[1])
+                if err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: invalid port %s", fields[1]))
+                        return
+                }
+                if err := m.admin.StopSocks5(port); err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: %v", err))
+                        return
+                }
+                m.appendOutput(fmt.Sprintf("✓ SOCKS5 proxy stopped on :%d", port))
+
+        case "http":
+                if len(fields) != 2 && len(fields) != 3 {
+                        m.appendOutput("Usage: http <port> [user:pass]")
+                        return
+                }
+                node, ok := m.selectedActiveNode()
+                if !ok {
+                        return
+                }
+                port, err := strconv.Atoi(fields[1])
+                if err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: invalid port %s", fields[1]))
+                        return
+                }
+                var username, password string
+                if len(fields) == 3 {
+                        username, password, _ = strings.Cut(fields[2], ":")
+                }
+                if err := m.admin.StartHTTPProxyWithAuth(port, node.ID, username, password); err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: %v", err))
+                        return
+                }
+                m.appendOutput(fmt.Sprintf("✓ HTTP proxy started on :%d -> %s", port, shortID(node.ID)))
+
+        case "unhttp":
+                if len(fields) != 2 {
+                        m.appendOutput("Usage: unhttp <port>")
+                        return
+                }
+                port, err := strconv.Atoi(fields[1])
+                if err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: invalid port %s", fields[1]))
+                        return
+                }
+                if err := m.admin.StopHTTPProxy(port); err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: %v", err))
+                        return
+                }
+                m.appendOutput(fmt.Sprintf("✓ HTTP proxy stopped on :%d", port))
+
+        case "shell":
+                if len(fields) != 2 {
+                        m.appendOutput("Usage: shell [port|socket]")
+                        return
+                }
+                node, ok := m.selectedActiveNode()
+                if !ok {
+                        return
+                }
+                network, addr := shellListenAddr(fields[1])
+                if err := m.admin.StartShellListener(network, addr, node.ID); err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: %v", err))
+                        return
+                }
+                m.appendOutput(fmt.Sprintf("✓ Shell listener %s -> %s", addr, shortID(node.ID)))
+
+        case "unshell":
+                if len(fields) != 2 {
+                        m.appendOutput("Usage: unshell <port|socket>")
+                        return
+                }
+                _, addr := shellListenAddr(fields[1])
+                if err := m.admin.StopShellListener(addr); err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: %v", err))
+                        return
+                }
+                m.appendOutput(fmt.Sprintf("✓ Shell listener %s stopped", addr))
+
+        case "rsocks", "route", "unroute":
+                m.routeCommand(fields)
+
+        case "tun", "untun":
+                m.tunnelCommand(fields)
+
+        default:
+                m.appendOutput(fmt.Sprintf("Unknown command: %s", fields[0]))
+        }
+}
+
+func (m *Model) selectedActiveNode() (*topology.NodeInfo, bool) {
+        if m.selectedIndex >= len(m.nodes) {
+                m.appendOutput("Error: No agent selected")
+                return nil, false
+        }
+        node := m.nodes[m.selectedIndex]
+        if node.Retired {
+                m.appendOutput(fmt.Sprintf("Error: Agent %s is retired", shortID(node.ID)))
+                return nil, false
+        }
+        if !node.IsActive {
+                m.appendOutput(fmt.Sprintf("Error: Agent %s is offline", shortID(node.ID)))
+                return nil, false
+        }
+        return node, true
+}
+
+// agentCommand returns a tea.Cmd running a command on the selected node.
+func (m *Model) agentCommand(args []string) tea.Cmd {
+        if len(args) == 0 {
+                m.appendOutput("Usage: cmd <command> [args...]")
+                return nil
+        }
+        node, ok := m.selectedActiveNode()
+        if !ok {
+                return nil
+        }
+
+        m.appendOutput(fmt.Sprintf("Running %s on %s...", args[0], shortID(node.ID)))
+
+        adminServer := m.admin
+        return func() tea.Msg {
+                response, err := adminServer.RunCommand(node.ID, args[0], args[1:]...)
+                return commandResultMsg{agentID: node.ID, command: args[0], response: response, err: err}
+        }
+}
+
+func (m *Model) showCommandResult(msg commandResultMsg) {
+        if msg.err != nil {
+                m.appendOutput(fmt.Sprintf("Error: %s on %s: %v", msg.command, shortID(msg.agentID), msg.err))
+                return
+        }
+
+        if msg.response.Status != pb.CommandStatus_COMMAND_OK {
+                m.appendOutput(fmt.Sprintf("✗ %s on %s: %v %s", msg.command, shortID(msg.agentID), msg.response.Status, msg.response.Error))
+        } else {
+                m.appendOutput(fmt.Sprintf("✓ %s on %s:", msg.command, shortID(msg.agentID)))
+        }
+
+        output := strings.TrimRight(string(msg.response.Output), "\n")
+        if output == "" {
+                return
+        }
+        for _, line := range strings.Split(output, "\n") {
+                m.appendOutput("  " + line)
+        }
+}
+
+// shortID abbreviates UUID agent IDs; IDs set with -id may be shorter.
+func shortID(id string) string {
+        if len(id) > 8 {
+                return id[:8]
+        }
+        return id
+}
+
+// localForwardAddr turns a bare port into a loopback listen address.
+func localForwardAddr(addr string) string {
+        if _, err := strconv.Atoi(addr); err == nil {
+                return "127.0.0.1:" + addr
+        }
+        return addr
+}
+
 func (m Model) View() string {
         if m.width == 0 {
                 return "Loading..."
@@ -183,9 +582,14 @@ func (m Model) View() string {
 
         mainContent := lipgloss.JoinHorizontal(lipgloss.Top, topologyBox, consoleBox)
 
+        if execView := m.renderExec(); execView != "" {
+                execBox := boxStyle.Width(m.width - 6).Render(execView)
+                mainContent = lipgloss.JoinVertical(lipgloss.Left, mainContent, execBox)
+        }
+
         footer := lipgloss.NewStyle().
                 Foreground(lipgloss.Color("#666666")).
-                Render("Press 'h' for help | 'q' to quit")
+                Render("Press 'h' for help | ':' for commands | 'q' to quit")
 
         return lipgloss.JoinVertical(
                 lipgloss.Left,
@@ -250,7 +654,10 @@ func (m Model) renderNodeTree(node *topology.NodeInfo, depth int, sb *strings.Bu
 
         status := "●"
         style := activeNodeStyle
-        if !node.IsActive {
+        if node.Retired {
+                status = "✕"
+                style = retiredNodeStyle
+        } else if !node.IsActive {
                 status = "○"
                 style = deadNodeStyle
         }
@@ -259,7 +666,7 @@ func (m Model) renderNodeTree(node *topology.NodeInfo, depth int, sb *strings.Bu
                 style = selectedStyle
         }
 
-        nodeInfo := fmt.Sprintf("%s %s", status, node.ID[:8])
+        nodeInfo := fmt.Sprintf("%s %s", status, shortID(node.ID))
         if node.Hostname != "" {
                 nodeInfo += fmt.Sprintf(" %s", node.Hostname)
         }
@@ -268,12 +675,21 @@ func (m Model) renderNodeTree(node *topology.NodeInfo, depth int, sb *strings.Bu
         }
 
         line := prefix + style.Render(nodeInfo)
+        if node.Retired {
+                line += " " + retiredNodeStyle.Render("retired")
+        } else if node.Version < protocol.Version {
+                line += " " + outdatedStyle.Render(fmt.Sprintf("⚠ outdated v%d", node.Version))
+        }
         sb.WriteString(line)
         sb.WriteString("\n")
 
         lastSeen := time.Since(node.LastSeen)
         sb.WriteString(fmt.Sprintf("%s   ↳ Last seen: %s ago\n", indent, lastSeen.Round(time.Second)))
 
+        if lifetime := renderLifetime(node); lifetime != "" && !node.Retired {
+                sb.WriteString(fmt.Sprintf("%s   ↳ Lifetime: %s\n", indent, lifetime))
+        }
+
         if len(node.Children) > 0 {
                 sb.WriteString(fmt.Sprintf("%s   ↳ Children: %d\n", indent, len(node.Children)))
                 
@@ -300,6 +716,7 @@ func (m Model) renderConsole() string {
 
         agents := m.admin.GetAgents()
         sb.WriteString(fmt.Sprintf("Active Connections: %d\n", len(agents)))
+        sb.WriteString(fmt.Sprintf("Fingerprint: %s\n", m.admin.Fingerprint()))
 
         socks5Servers := m.admin.GetSocks5Servers()
         if len(socks5Servers) > 0 {
@@ -312,6 +729,43 @@ func (m Model) renderConsole() string {
                 }
         }
 
+        httpProxies := m.admin.GetHTTPProxies()
+        if len(httpProxies) > 0 {
+                sb.WriteString(lipgloss.NewStyle().
+                        Foreground(lipgloss.Color("#00FF00")).
+                        Render(fmt.Sprintf("HTTP Proxies: %d", len(httpProxies))))
+                sb.WriteString("\n")
+                for port, agentID := range httpProxies {
+                        sb.WriteString(fmt.Sprintf("  • 127.0.0.1:%d (%s)\n", port, shortID(agentID)))
+                }
+        }
+
+        forwards := m.admin.GetPortForwards()
+        if len(forwards) > 0 {
+                sb.WriteString(lipgloss.NewStyle().
+                        Foreground(lipgloss.Color("#00FF00")).
+                        Render(fmt.Sprintf("Port Forwards: %d", len(forwards))))
+                sb.WriteString("\n")
+                for _, fwd := range forwards {
+                        sb.WriteString(fmt.Sprintf("  • %s -> %s:%d (%s)\n", fwd.LocalAddr, fwd.RemoteHost, fwd.RemotePort, shortID(fwd.AgentID)))
+                }
+        }
+
+        reverseForwards := m.admin.GetReverseForwards()
+        if len(reverseForwards) > 0 {
+                sb.WriteString(lipgloss.NewStyle().
+                        Foreground(lipgloss.Color("#00FF00")).
+                        Render(fmt.Sprintf("Reverse Forwards: %d", len(reverseForwards))))
+                sb.WriteString("\n")
+                for _, fwd := range reverseForwards {
+                        sb.WriteString(fmt.Sprintf("  • [%s] %s %s -> %s\n", fwd.ID, shortID(fwd.AgentID), fwd.RemoteAddr, fwd.LocalAddr))
+                }
+        }
+
+        sb.WriteString(m.renderRoutes())
+        sb.WriteString(m.renderTunnels())
+        sb.WriteString(m.renderTransfers())
+
         sb.WriteString("\n")
         sb.WriteString(lipgloss.NewStyle().
                 Foreground(lipgloss.Color("#AAAAAA")).
@@ -325,6 +779,14 @@ func (m Model) renderConsole() string {
                 sb.WriteString("\n")
         }
 
+        if m.inputMode {
+                sb.WriteString("\n")
+                sb.WriteString(lipgloss.NewStyle().
+                        Foreground(lipgloss.Color("#FFFF00")).
+                        Render(": " + m.consoleInput + "█"))
+                sb.WriteString("\n")
+        }
+
         return sb.String()
 }
 
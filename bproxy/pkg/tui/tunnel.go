@@ -0,0 +1,101 @@
+package tui
+
+import (
+        "fmt"
+        "net"
+        "sort"
+        "strings"
+
+        "github.com/bproxy/bproxy/pkg/proxy"
+        "github.com/charmbracelet/lipgloss"
+)
+
+// defaultTunName is the interface created by "tun" when no name is given.
+const defaultTunName = "bproxy0"
+
+// tunnelCommand handles "tun <cidr> [name]", which routes cidr through a new
+// TUN interface to the selected node, and "untun <name>".
+func (m *Model) tunnelCommand(fields []string) {
+        switch fields[0] {
+        case "tun":
+                if len(fields) != 2 && len(fields) != 3 {
+                        m.appendOutput("Usage: tun <cidr> [interface]")
+                        return
+                }
+                if _, _, err := net.ParseCIDR(fields[1]); err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: invalid CIDR %s", fields[1]))
+                        return
+                }
+                name := defaultTunName
+                if len(fields) == 3 {
+                        name = fields[2]
+                }
+                if _, exists := m.tunnels[name]; exists {
+                        m.appendOutput(fmt.Sprintf("Error: tunnel %s already running", name))
+                        return
+                }
+                node, ok := m.selectedActiveNode()
+                if !ok {
+                        return
+                }
+
+                l3, err := proxy.NewL3Proxy(name, "", "", fields[1], m.admin, node.ID)
+                if err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: %v", err))
+                        return
+                }
+                if err := l3.Start(); err != nil {
+                        l3.Close()
+                        m.appendOutput(fmt.Sprintf("Error: %v", err))
+                        return
+                }
+                m.tunnels[name] = &tunnelView{proxy: l3, route: fields[1]}
+                m.appendOutput(fmt.Sprintf("✓ Tunnel %s: %s -> %s", name, fields[1], shortID(node.ID)))
+
+        case "untun":
+                if len(fields) != 2 {
+                        m.appendOutput("Usage: untun <interface>")
+                        return
+                }
+                tunnel, exists := m.tunnels[fields[1]]
+                if !exists {
+                        m.appendOutput(fmt.Sprintf("Error: no tunnel %s", fields[1]))
+                        return
+                }
+                delete(m.tunnels, fields[1])
+                if err := tunnel.proxy.Close(); err != nil {
+                        m.appendOutput(fmt.Sprintf("Error: %v", err))
+                        return
+                }
+                m.appendOutput(fmt.Sprintf("✓ Tunnel %s stopped", fields[1]))
+        }
+}
+
+// tunnelView is an L3 tunnel started from the console.
+type tunnelView struct {
+        proxy *proxy.L3Proxy
+        route string
+}
+
+func (m Model) renderTunnels() string {
+        if len(m.tunnels) == 0 {
+                return ""
+        }
+
+        names := make([]string, 0, len(m.tunnels))
+        for name := range m.tunnels {
+                names = append(names, name)
+        }
+        sort.Strings(names)
+
+        var sb strings.Builder
+        sb.WriteString(lipgloss.NewStyle().
+                Foreground(lipgloss.Color("#00FF00")).
+                Render(fmt.Sprintf("L3 Tunnels: %d", len(m.tunnels))))
+        sb.WriteString("\n")
+        for _, name := range names {
+                tunnel := m.tunnels[name]
+                sb.WriteString(fmt.Sprintf("  • %s %s -> %s\n", name, tunnel.route, shortID(tunnel.proxy.TargetID())))
+        }
+        return sb.String()
+}
\ No newline at end of file
@@ -24,31 +24,64 @@ const (
 type MessageType int32
 
 const (
-	MessageType_HEARTBEAT MessageType = 0
-	MessageType_COMMAND   MessageType = 1
-	MessageType_DATA      MessageType = 2
-	MessageType_REGISTER  MessageType = 3
-	MessageType_CONNECT   MessageType = 4
-	MessageType_RELAY     MessageType = 5
+	MessageType_HEARTBEAT        MessageType = 0
+	MessageType_COMMAND          MessageType = 1
+	MessageType_DATA             MessageType = 2
+	MessageType_REGISTER         MessageType = 3
+	MessageType_CONNECT          MessageType = 4
+	MessageType_RELAY            MessageType = 5
+	MessageType_TUNNEL           MessageType = 6
+	MessageType_UDP              MessageType = 7
+	MessageType_BIND             MessageType = 8
+	MessageType_REVERSE_LISTEN   MessageType = 9
+	MessageType_REVERSE_CONNECT  MessageType = 10
+	MessageType_CONNECT_RESULT   MessageType = 11
+	MessageType_COMMAND_RESPONSE MessageType = 12
+	MessageType_EXEC             MessageType = 13
+	MessageType_SHELL            MessageType = 14
+	MessageType_FILE             MessageType = 15
+	MessageType_SHUTDOWN         MessageType = 16
 )
 
 // Enum value maps for MessageType.
 var (
 	MessageType_name = map[int32]string{
-		0: "HEARTBEAT",
-		1: "COMMAND",
-		2: "DATA",
-		3: "REGISTER",
-		4: "CONNECT",
-		5: "RELAY",
+		0:  "HEARTBEAT",
+		1:  "COMMAND",
+		2:  "DATA",
+		3:  "REGISTER",
+		4:  "CONNECT",
+		5:  "RELAY",
+		6:  "TUNNEL",
+		7:  "UDP",
+		8:  "BIND",
+		9:  "REVERSE_LISTEN",
+		10: "REVERSE_CONNECT",
+		11: "CONNECT_RESULT",
+		12: "COMMAND_RESPONSE",
+		13: "EXEC",
+		14: "SHELL",
+		15: "FILE",
+		16: "SHUTDOWN",
 	}
 	MessageType_value = map[string]int32{
-		"HEARTBEAT": 0,
-		"COMMAND":   1,
-		"DATA":      2,
-		"REGISTER":  3,
-		"CONNECT":   4,
-		"RELAY":     5,
+		"HEARTBEAT":        0,
+		"COMMAND":          1,
+		"DATA":             2,
+		"REGISTER":         3,
+		"CONNECT":          4,
+		"RELAY":            5,
+		"TUNNEL":           6,
+		"UDP":              7,
+		"BIND":             8,
+		"REVERSE_LISTEN":   9,
+		"REVERSE_CONNECT":  10,
+		"CONNECT_RESULT":   11,
+		"COMMAND_RESPONSE": 12,
+		"EXEC":             13,
+		"SHELL":            14,
+		"FILE":             15,
+		"SHUTDOWN":         16,
 	}
 )
 
@@ -79,6 +112,220 @@ func (MessageType) EnumDescriptor() ([]byte, []int) {
 	return file_proto_message_proto_rawDescGZIP(), []int{0}
 }
 
+type CommandStatus int32
+
+const (
+	CommandStatus_COMMAND_OK      CommandStatus = 0
+	CommandStatus_COMMAND_FAILED  CommandStatus = 1
+	CommandStatus_COMMAND_UNKNOWN CommandStatus = 2
+	CommandStatus_COMMAND_TIMEOUT CommandStatus = 3
+)
+
+// Enum value maps for CommandStatus.
+var (
+	CommandStatus_name = map[int32]string{
+		0: "COMMAND_OK",
+		1: "COMMAND_FAILED",
+		2: "COMMAND_UNKNOWN",
+		3: "COMMAND_TIMEOUT",
+	}
+	CommandStatus_value = map[string]int32{
+		"COMMAND_OK":      0,
+		"COMMAND_FAILED":  1,
+		"COMMAND_UNKNOWN": 2,
+		"COMMAND_TIMEOUT": 3,
+	}
+)
+
+func (x CommandStatus) Enum() *CommandStatus {
+	p := new(CommandStatus)
+	*p = x
+	return p
+}
+
+func (x CommandStatus) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (CommandStatus) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_message_proto_enumTypes[1].Descriptor()
+}
+
+func (CommandStatus) Type() protoreflect.EnumType {
+	return &file_proto_message_proto_enumTypes[1]
+}
+
+func (x CommandStatus) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use CommandStatus.Descriptor instead.
+func (CommandStatus) EnumDescriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{1}
+}
+
+type ExecStream int32
+
+const (
+	ExecStream_EXEC_STDOUT ExecStream = 0
+	ExecStream_EXEC_STDERR ExecStream = 1
+	ExecStream_EXEC_EXIT   ExecStream = 2
+)
+
+// Enum value maps for ExecStream.
+var (
+	ExecStream_name = map[int32]string{
+		0: "EXEC_STDOUT",
+		1: "EXEC_STDERR",
+		2: "EXEC_EXIT",
+	}
+	ExecStream_value = map[string]int32{
+		"EXEC_STDOUT": 0,
+		"EXEC_STDERR": 1,
+		"EXEC_EXIT":   2,
+	}
+)
+
+func (x ExecStream) Enum() *ExecStream {
+	p := new(ExecStream)
+	*p = x
+	return p
+}
+
+func (x ExecStream) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ExecStream) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_message_proto_enumTypes[2].Descriptor()
+}
+
+func (ExecStream) Type() protoreflect.EnumType {
+	return &file_proto_message_proto_enumTypes[2]
+}
+
+func (x ExecStream) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ExecStream.Descriptor instead.
+func (ExecStream) EnumDescriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{2}
+}
+
+type FileDirection int32
+
+const (
+	FileDirection_FILE_UPLOAD   FileDirection = 0
+	FileDirection_FILE_DOWNLOAD FileDirection = 1
+)
+
+// Enum value maps for FileDirection.
+var (
+	FileDirection_name = map[int32]string{
+		0: "FILE_UPLOAD",
+		1: "FILE_DOWNLOAD",
+	}
+	FileDirection_value = map[string]int32{
+		"FILE_UPLOAD":   0,
+		"FILE_DOWNLOAD": 1,
+	}
+)
+
+func (x FileDirection) Enum() *FileDirection {
+	p := new(FileDirection)
+	*p = x
+	return p
+}
+
+func (x FileDirection) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (FileDirection) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_message_proto_enumTypes[3].Descriptor()
+}
+
+func (FileDirection) Type() protoreflect.EnumType {
+	return &file_proto_message_proto_enumTypes[3]
+}
+
+func (x FileDirection) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use FileDirection.Descriptor instead.
+func (FileDirection) EnumDescriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{3}
+}
+
+type ConnectError int32
+
+const (
+	ConnectError_CONNECT_OK                  ConnectError = 0
+	ConnectError_CONNECT_GENERAL_FAILURE     ConnectError = 1
+	ConnectError_CONNECT_NOT_ALLOWED         ConnectError = 2
+	ConnectError_CONNECT_NETWORK_UNREACHABLE ConnectError = 3
+	ConnectError_CONNECT_HOST_UNREACHABLE    ConnectError = 4
+	ConnectError_CONNECT_REFUSED             ConnectError = 5
+	ConnectError_CONNECT_TIMEOUT             ConnectError = 6
+	ConnectError_CONNECT_DNS_FAILURE         ConnectError = 7
+	ConnectError_CONNECT_NO_ROUTE            ConnectError = 8
+)
+
+// Enum value maps for ConnectError.
+var (
+	ConnectError_name = map[int32]string{
+		0: "CONNECT_OK",
+		1: "CONNECT_GENERAL_FAILURE",
+		2: "CONNECT_NOT_ALLOWED",
+		3: "CONNECT_NETWORK_UNREACHABLE",
+		4: "CONNECT_HOST_UNREACHABLE",
+		5: "CONNECT_REFUSED",
+		6: "CONNECT_TIMEOUT",
+		7: "CONNECT_DNS_FAILURE",
+		8: "CONNECT_NO_ROUTE",
+	}
+	ConnectError_value = map[string]int32{
+		"CONNECT_OK":                  0,
+		"CONNECT_GENERAL_FAILURE":     1,
+		"CONNECT_NOT_ALLOWED":         2,
+		"CONNECT_NETWORK_UNREACHABLE": 3,
+		"CONNECT_HOST_UNREACHABLE":    4,
+		"CONNECT_REFUSED":             5,
+		"CONNECT_TIMEOUT":             6,
+		"CONNECT_DNS_FAILURE":         7,
+		"CONNECT_NO_ROUTE":            8,
+	}
+)
+
+func (x ConnectError) Enum() *ConnectError {
+	p := new(ConnectError)
+	*p = x
+	return p
+}
+
+func (x ConnectError) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ConnectError) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_message_proto_enumTypes[4].Descriptor()
+}
+
+func (ConnectError) Type() protoreflect.EnumType {
+	return &file_proto_message_proto_enumTypes[4]
+}
+
+func (x ConnectError) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ConnectError.Descriptor instead.
+func (ConnectError) EnumDescriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{4}
+}
+
 type Message struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Type          MessageType            `protobuf:"varint,1,opt,name=type,proto3,enum=bproxy.MessageType" json:"type,omitempty"`
@@ -164,15 +411,24 @@ func (x *Message) GetTimestamp() int64 {
 }
 
 type RegisterPayload struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
-	Hostname      string                 `protobuf:"bytes,2,opt,name=hostname,proto3" json:"hostname,omitempty"`
-	LocalIps      []string               `protobuf:"bytes,3,rep,name=local_ips,json=localIps,proto3" json:"local_ips,omitempty"`
-	Os            string                 `protobuf:"bytes,4,opt,name=os,proto3" json:"os,omitempty"`
-	Arch          string                 `protobuf:"bytes,5,opt,name=arch,proto3" json:"arch,omitempty"`
-	ParentId      string                 `protobuf:"bytes,6,opt,name=parent_id,json=parentId,proto3" json:"parent_id,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	AgentId            string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	Hostname           string                 `protobuf:"bytes,2,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	LocalIps           []string               `protobuf:"bytes,3,rep,name=local_ips,json=localIps,proto3" json:"local_ips,omitempty"`
+	Os                 string                 `protobuf:"bytes,4,opt,name=os,proto3" json:"os,omitempty"`
+	Arch               string                 `protobuf:"bytes,5,opt,name=arch,proto3" json:"arch,omitempty"`
+	ParentId           string                 `protobuf:"bytes,6,opt,name=parent_id,json=parentId,proto3" json:"parent_id,omitempty"`
+	AuthTimestamp      int64                  `protobuf:"varint,7,opt,name=auth_timestamp,json=authTimestamp,proto3" json:"auth_timestamp,omitempty"`
+	AuthNonce          []byte                 `protobuf:"bytes,8,opt,name=auth_nonce,json=authNonce,proto3" json:"auth_nonce,omitempty"`
+	AuthMac            []byte                 `protobuf:"bytes,9,opt,name=auth_mac,json=authMac,proto3" json:"auth_mac,omitempty"`
+	CascadeFingerprint string                 `protobuf:"bytes,10,opt,name=cascade_fingerprint,json=cascadeFingerprint,proto3" json:"cascade_fingerprint,omitempty"`
+	ProtocolVersion    uint32                 `protobuf:"varint,11,opt,name=protocol_version,json=protocolVersion,proto3" json:"protocol_version,omitempty"`
+	Capabilities       []string               `protobuf:"bytes,12,rep,name=capabilities,proto3" json:"capabilities,omitempty"`
+	KillDate           int64                  `protobuf:"varint,13,opt,name=kill_date,json=killDate,proto3" json:"kill_date,omitempty"`
+	WorkingHours       string                 `protobuf:"bytes,14,opt,name=working_hours,json=workingHours,proto3" json:"working_hours,omitempty"`
+	LocalNetworks      []string               `protobuf:"bytes,15,rep,name=local_networks,json=localNetworks,proto3" json:"local_networks,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
 }
 
 func (x *RegisterPayload) Reset() {
@@ -247,6 +503,69 @@ func (x *RegisterPayload) GetParentId() string {
 	return ""
 }
 
+func (x *RegisterPayload) GetAuthTimestamp() int64 {
+	if x != nil {
+		return x.AuthTimestamp
+	}
+	return 0
+}
+
+func (x *RegisterPayload) GetAuthNonce() []byte {
+	if x != nil {
+		return x.AuthNonce
+	}
+	return nil
+}
+
+func (x *RegisterPayload) GetAuthMac() []byte {
+	if x != nil {
+		return x.AuthMac
+	}
+	return nil
+}
+
+func (x *RegisterPayload) GetCascadeFingerprint() string {
+	if x != nil {
+		return x.CascadeFingerprint
+	}
+	return ""
+}
+
+func (x *RegisterPayload) GetProtocolVersion() uint32 {
+	if x != nil {
+		return x.ProtocolVersion
+	}
+	return 0
+}
+
+func (x *RegisterPayload) GetCapabilities() []string {
+	if x != nil {
+		return x.Capabilities
+	}
+	return nil
+}
+
+func (x *RegisterPayload) GetKillDate() int64 {
+	if x != nil {
+		return x.KillDate
+	}
+	return 0
+}
+
+func (x *RegisterPayload) GetWorkingHours() string {
+	if x != nil {
+		return x.WorkingHours
+	}
+	return ""
+}
+
+func (x *RegisterPayload) GetLocalNetworks() []string {
+	if x != nil {
+		return x.LocalNetworks
+	}
+	return nil
+}
+
 type HeartbeatPayload struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
@@ -304,6 +623,8 @@ type CommandPayload struct {
 	Command       string                 `protobuf:"bytes,1,opt,name=command,proto3" json:"command,omitempty"`
 	Args          []string               `protobuf:"bytes,2,rep,name=args,proto3" json:"args,omitempty"`
 	Env           map[string]string      `protobuf:"bytes,3,rep,name=env,proto3" json:"env,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	RequestId     string                 `protobuf:"bytes,4,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	TimeoutMs     int64                  `protobuf:"varint,5,opt,name=timeout_ms,json=timeoutMs,proto3" json:"timeout_ms,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -359,29 +680,44 @@ func (x *CommandPayload) GetEnv() map[string]string {
 	return nil
 }
 
-type ConnectPayload struct {
+func (x *CommandPayload) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *CommandPayload) GetTimeoutMs() int64 {
+	if x != nil {
+		return x.TimeoutMs
+	}
+	return 0
+}
+
+type CommandResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	TargetAgentId string                 `protobuf:"bytes,1,opt,name=target_agent_id,json=targetAgentId,proto3" json:"target_agent_id,omitempty"`
-	TargetAddress string                 `protobuf:"bytes,2,opt,name=target_address,json=targetAddress,proto3" json:"target_address,omitempty"`
-	TargetPort    int32                  `protobuf:"varint,3,opt,name=target_port,json=targetPort,proto3" json:"target_port,omitempty"`
+	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Status        CommandStatus          `protobuf:"varint,2,opt,name=status,proto3,enum=bproxy.CommandStatus" json:"status,omitempty"`
+	Output        []byte                 `protobuf:"bytes,3,opt,name=output,proto3" json:"output,omitempty"`
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *ConnectPayload) Reset() {
-	*x = ConnectPayload{}
+func (x *CommandResponse) Reset() {
+	*x = CommandResponse{}
 	mi := &file_proto_message_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *ConnectPayload) String() string {
+func (x *CommandResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ConnectPayload) ProtoMessage() {}
+func (*CommandResponse) ProtoMessage() {}
 
-func (x *ConnectPayload) ProtoReflect() protoreflect.Message {
+func (x *CommandResponse) ProtoReflect() protoreflect.Message {
 	mi := &file_proto_message_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -393,54 +729,63 @@ func (x *ConnectPayload) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ConnectPayload.ProtoReflect.Descriptor instead.
-func (*ConnectPayload) Descriptor() ([]byte, []int) {
+// Deprecated: Use CommandResponse.ProtoReflect.Descriptor instead.
+func (*CommandResponse) Descriptor() ([]byte, []int) {
 	return file_proto_message_proto_rawDescGZIP(), []int{4}
 }
 
-func (x *ConnectPayload) GetTargetAgentId() string {
+func (x *CommandResponse) GetRequestId() string {
 	if x != nil {
-		return x.TargetAgentId
+		return x.RequestId
 	}
 	return ""
 }
 
-func (x *ConnectPayload) GetTargetAddress() string {
+func (x *CommandResponse) GetStatus() CommandStatus {
 	if x != nil {
-		return x.TargetAddress
+		return x.Status
 	}
-	return ""
+	return CommandStatus_COMMAND_OK
 }
 
-func (x *ConnectPayload) GetTargetPort() int32 {
+func (x *CommandResponse) GetOutput() []byte {
 	if x != nil {
-		return x.TargetPort
+		return x.Output
 	}
-	return 0
+	return nil
 }
 
-type DataPayload struct {
+func (x *CommandResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type ExecOutput struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
-	Sequence      int32                  `protobuf:"varint,2,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Stream        ExecStream             `protobuf:"varint,1,opt,name=stream,proto3,enum=bproxy.ExecStream" json:"stream,omitempty"`
+	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	ExitCode      int32                  `protobuf:"varint,3,opt,name=exit_code,json=exitCode,proto3" json:"exit_code,omitempty"`
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *DataPayload) Reset() {
-	*x = DataPayload{}
+func (x *ExecOutput) Reset() {
+	*x = ExecOutput{}
 	mi := &file_proto_message_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *DataPayload) String() string {
+func (x *ExecOutput) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*DataPayload) ProtoMessage() {}
+func (*ExecOutput) ProtoMessage() {}
 
-func (x *DataPayload) ProtoReflect() protoreflect.Message {
+func (x *ExecOutput) ProtoReflect() protoreflect.Message {
 	mi := &file_proto_message_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -452,70 +797,981 @@ func (x *DataPayload) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use DataPayload.ProtoReflect.Descriptor instead.
-func (*DataPayload) Descriptor() ([]byte, []int) {
+// Deprecated: Use ExecOutput.ProtoReflect.Descriptor instead.
+func (*ExecOutput) Descriptor() ([]byte, []int) {
 	return file_proto_message_proto_rawDescGZIP(), []int{5}
 }
 
-func (x *DataPayload) GetData() []byte {
+func (x *ExecOutput) GetStream() ExecStream {
+	if x != nil {
+		return x.Stream
+	}
+	return ExecStream_EXEC_STDOUT
+}
+
+func (x *ExecOutput) GetData() []byte {
 	if x != nil {
 		return x.Data
 	}
 	return nil
 }
 
-func (x *DataPayload) GetSequence() int32 {
+func (x *ExecOutput) GetExitCode() int32 {
 	if x != nil {
-		return x.Sequence
+		return x.ExitCode
 	}
 	return 0
 }
 
-var File_proto_message_proto protoreflect.FileDescriptor
+func (x *ExecOutput) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
 
-const file_proto_message_proto_rawDesc = "" +
-	"\n" +
-	"\x13proto/message.proto\x12\x06bproxy\"\xc3\x01\n" +
-	"\aMessage\x12'\n" +
-	"\x04type\x18\x01 \x01(\x0e2\x13.bproxy.MessageTypeR\x04type\x12\x1d\n" +
-	"\n" +
-	"session_id\x18\x02 \x01(\tR\tsessionId\x12\x18\n" +
-	"\apayload\x18\x03 \x01(\fR\apayload\x12\x1b\n" +
-	"\tsource_id\x18\x04 \x01(\tR\bsourceId\x12\x1b\n" +
-	"\ttarget_id\x18\x05 \x01(\tR\btargetId\x12\x1c\n" +
-	"\ttimestamp\x18\x06 \x01(\x03R\ttimestamp\"\xa6\x01\n" +
-	"\x0fRegisterPayload\x12\x19\n" +
-	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1a\n" +
-	"\bhostname\x18\x02 \x01(\tR\bhostname\x12\x1b\n" +
-	"\tlocal_ips\x18\x03 \x03(\tR\blocalIps\x12\x0e\n" +
-	"\x02os\x18\x04 \x01(\tR\x02os\x12\x12\n" +
-	"\x04arch\x18\x05 \x01(\tR\x04arch\x12\x1b\n" +
-	"\tparent_id\x18\x06 \x01(\tR\bparentId\"K\n" +
-	"\x10HeartbeatPayload\x12\x19\n" +
-	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1c\n" +
-	"\ttimestamp\x18\x02 \x01(\x03R\ttimestamp\"\xa9\x01\n" +
-	"\x0eCommandPayload\x12\x18\n" +
-	"\acommand\x18\x01 \x01(\tR\acommand\x12\x12\n" +
-	"\x04args\x18\x02 \x03(\tR\x04args\x121\n" +
-	"\x03env\x18\x03 \x03(\v2\x1f.bproxy.CommandPayload.EnvEntryR\x03env\x1a6\n" +
-	"\bEnvEntry\x12\x10\n" +
-	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x80\x01\n" +
-	"\x0eConnectPayload\x12&\n" +
-	"\x0ftarget_agent_id\x18\x01 \x01(\tR\rtargetAgentId\x12%\n" +
-	"\x0etarget_address\x18\x02 \x01(\tR\rtargetAddress\x12\x1f\n" +
-	"\vtarget_port\x18\x03 \x01(\x05R\n" +
-	"targetPort\"=\n" +
-	"\vDataPayload\x12\x12\n" +
-	"\x04data\x18\x01 \x01(\fR\x04data\x12\x1a\n" +
-	"\bsequence\x18\x02 \x01(\x05R\bsequence*Y\n" +
-	"\vMessageType\x12\r\n" +
-	"\tHEARTBEAT\x10\x00\x12\v\n" +
-	"\aCOMMAND\x10\x01\x12\b\n" +
-	"\x04DATA\x10\x02\x12\f\n" +
-	"\bREGISTER\x10\x03\x12\v\n" +
-	"\aCONNECT\x10\x04\x12\t\n" +
-	"\x05RELAY\x10\x05B Z\x1egithub.com/bproxy/bproxy/protob\x06proto3"
+type ExecControl struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cancel        bool                   `protobuf:"varint,1,opt,name=cancel,proto3" json:"cancel,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExecControl) Reset() {
+	*x = ExecControl{}
+	mi := &file_proto_message_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExecControl) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecControl) ProtoMessage() {}
+
+func (x *ExecControl) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_message_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecControl.ProtoReflect.Descriptor instead.
+func (*ExecControl) Descriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ExecControl) GetCancel() bool {
+	if x != nil {
+		return x.Cancel
+	}
+	return false
+}
+
+type ShellRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Shell         string                 `protobuf:"bytes,1,opt,name=shell,proto3" json:"shell,omitempty"`
+	Term          string                 `protobuf:"bytes,2,opt,name=term,proto3" json:"term,omitempty"`
+	Rows          uint32                 `protobuf:"varint,3,opt,name=rows,proto3" json:"rows,omitempty"`
+	Cols          uint32                 `protobuf:"varint,4,opt,name=cols,proto3" json:"cols,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShellRequest) Reset() {
+	*x = ShellRequest{}
+	mi := &file_proto_message_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShellRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShellRequest) ProtoMessage() {}
+
+func (x *ShellRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_message_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShellRequest.ProtoReflect.Descriptor instead.
+func (*ShellRequest) Descriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ShellRequest) GetShell() string {
+	if x != nil {
+		return x.Shell
+	}
+	return ""
+}
+
+func (x *ShellRequest) GetTerm() string {
+	if x != nil {
+		return x.Term
+	}
+	return ""
+}
+
+func (x *ShellRequest) GetRows() uint32 {
+	if x != nil {
+		return x.Rows
+	}
+	return 0
+}
+
+func (x *ShellRequest) GetCols() uint32 {
+	if x != nil {
+		return x.Cols
+	}
+	return 0
+}
+
+type ShellInput struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	Rows          uint32                 `protobuf:"varint,2,opt,name=rows,proto3" json:"rows,omitempty"`
+	Cols          uint32                 `protobuf:"varint,3,opt,name=cols,proto3" json:"cols,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShellInput) Reset() {
+	*x = ShellInput{}
+	mi := &file_proto_message_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShellInput) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShellInput) ProtoMessage() {}
+
+func (x *ShellInput) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_message_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShellInput.ProtoReflect.Descriptor instead.
+func (*ShellInput) Descriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ShellInput) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *ShellInput) GetRows() uint32 {
+	if x != nil {
+		return x.Rows
+	}
+	return 0
+}
+
+func (x *ShellInput) GetCols() uint32 {
+	if x != nil {
+		return x.Cols
+	}
+	return 0
+}
+
+type FileRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Direction     FileDirection          `protobuf:"varint,1,opt,name=direction,proto3,enum=bproxy.FileDirection" json:"direction,omitempty"`
+	Path          string                 `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	Size          int64                  `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`
+	Offset        int64                  `protobuf:"varint,4,opt,name=offset,proto3" json:"offset,omitempty"`
+	Sha256        string                 `protobuf:"bytes,5,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	ChunkSize     uint32                 `protobuf:"varint,6,opt,name=chunk_size,json=chunkSize,proto3" json:"chunk_size,omitempty"`
+	Mode          uint32                 `protobuf:"varint,7,opt,name=mode,proto3" json:"mode,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileRequest) Reset() {
+	*x = FileRequest{}
+	mi := &file_proto_message_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileRequest) ProtoMessage() {}
+
+func (x *FileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_message_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileRequest.ProtoReflect.Descriptor instead.
+func (*FileRequest) Descriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *FileRequest) GetDirection() FileDirection {
+	if x != nil {
+		return x.Direction
+	}
+	return FileDirection_FILE_UPLOAD
+}
+
+func (x *FileRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *FileRequest) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *FileRequest) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *FileRequest) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+func (x *FileRequest) GetChunkSize() uint32 {
+	if x != nil {
+		return x.ChunkSize
+	}
+	return 0
+}
+
+func (x *FileRequest) GetMode() uint32 {
+	if x != nil {
+		return x.Mode
+	}
+	return 0
+}
+
+type FileStatus struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Error         string                 `protobuf:"bytes,1,opt,name=error,proto3" json:"error,omitempty"`
+	Size          int64                  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	Offset        int64                  `protobuf:"varint,3,opt,name=offset,proto3" json:"offset,omitempty"`
+	Sha256        string                 `protobuf:"bytes,4,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileStatus) Reset() {
+	*x = FileStatus{}
+	mi := &file_proto_message_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileStatus) ProtoMessage() {}
+
+func (x *FileStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_message_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileStatus.ProtoReflect.Descriptor instead.
+func (*FileStatus) Descriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *FileStatus) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *FileStatus) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *FileStatus) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *FileStatus) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+type ShutdownRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Reason        string                 `protobuf:"bytes,1,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShutdownRequest) Reset() {
+	*x = ShutdownRequest{}
+	mi := &file_proto_message_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShutdownRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShutdownRequest) ProtoMessage() {}
+
+func (x *ShutdownRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_message_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShutdownRequest.ProtoReflect.Descriptor instead.
+func (*ShutdownRequest) Descriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ShutdownRequest) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type ShutdownResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Error         string                 `protobuf:"bytes,1,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShutdownResponse) Reset() {
+	*x = ShutdownResponse{}
+	mi := &file_proto_message_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShutdownResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShutdownResponse) ProtoMessage() {}
+
+func (x *ShutdownResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_message_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShutdownResponse.ProtoReflect.Descriptor instead.
+func (*ShutdownResponse) Descriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ShutdownResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type ConnectPayload struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TargetAgentId string                 `protobuf:"bytes,1,opt,name=target_agent_id,json=targetAgentId,proto3" json:"target_agent_id,omitempty"`
+	TargetAddress string                 `protobuf:"bytes,2,opt,name=target_address,json=targetAddress,proto3" json:"target_address,omitempty"`
+	TargetPort    int32                  `protobuf:"varint,3,opt,name=target_port,json=targetPort,proto3" json:"target_port,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConnectPayload) Reset() {
+	*x = ConnectPayload{}
+	mi := &file_proto_message_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConnectPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConnectPayload) ProtoMessage() {}
+
+func (x *ConnectPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_message_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConnectPayload.ProtoReflect.Descriptor instead.
+func (*ConnectPayload) Descriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ConnectPayload) GetTargetAgentId() string {
+	if x != nil {
+		return x.TargetAgentId
+	}
+	return ""
+}
+
+func (x *ConnectPayload) GetTargetAddress() string {
+	if x != nil {
+		return x.TargetAddress
+	}
+	return ""
+}
+
+func (x *ConnectPayload) GetTargetPort() int32 {
+	if x != nil {
+		return x.TargetPort
+	}
+	return 0
+}
+
+type ConnectResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Error         ConnectError           `protobuf:"varint,1,opt,name=error,proto3,enum=bproxy.ConnectError" json:"error,omitempty"`
+	FailedHop     string                 `protobuf:"bytes,2,opt,name=failed_hop,json=failedHop,proto3" json:"failed_hop,omitempty"`
+	BoundAddress  string                 `protobuf:"bytes,3,opt,name=bound_address,json=boundAddress,proto3" json:"bound_address,omitempty"`
+	BoundPort     int32                  `protobuf:"varint,4,opt,name=bound_port,json=boundPort,proto3" json:"bound_port,omitempty"`
+	Message       string                 `protobuf:"bytes,5,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConnectResult) Reset() {
+	*x = ConnectResult{}
+	mi := &file_proto_message_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConnectResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConnectResult) ProtoMessage() {}
+
+func (x *ConnectResult) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_message_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConnectResult.ProtoReflect.Descriptor instead.
+func (*ConnectResult) Descriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ConnectResult) GetError() ConnectError {
+	if x != nil {
+		return x.Error
+	}
+	return ConnectError_CONNECT_OK
+}
+
+func (x *ConnectResult) GetFailedHop() string {
+	if x != nil {
+		return x.FailedHop
+	}
+	return ""
+}
+
+func (x *ConnectResult) GetBoundAddress() string {
+	if x != nil {
+		return x.BoundAddress
+	}
+	return ""
+}
+
+func (x *ConnectResult) GetBoundPort() int32 {
+	if x != nil {
+		return x.BoundPort
+	}
+	return 0
+}
+
+func (x *ConnectResult) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type DataPayload struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	Sequence      int32                  `protobuf:"varint,2,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DataPayload) Reset() {
+	*x = DataPayload{}
+	mi := &file_proto_message_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DataPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DataPayload) ProtoMessage() {}
+
+func (x *DataPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_message_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DataPayload.ProtoReflect.Descriptor instead.
+func (*DataPayload) Descriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *DataPayload) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *DataPayload) GetSequence() int32 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+type UdpPayload struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Address       string                 `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	Port          int32                  `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`
+	Data          []byte                 `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UdpPayload) Reset() {
+	*x = UdpPayload{}
+	mi := &file_proto_message_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UdpPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UdpPayload) ProtoMessage() {}
+
+func (x *UdpPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_message_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UdpPayload.ProtoReflect.Descriptor instead.
+func (*UdpPayload) Descriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *UdpPayload) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *UdpPayload) GetPort() int32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *UdpPayload) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type BindPayload struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Address       string                 `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	Port          int32                  `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BindPayload) Reset() {
+	*x = BindPayload{}
+	mi := &file_proto_message_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BindPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BindPayload) ProtoMessage() {}
+
+func (x *BindPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_message_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BindPayload.ProtoReflect.Descriptor instead.
+func (*BindPayload) Descriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *BindPayload) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *BindPayload) GetPort() int32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+type ReverseForwardPayload struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ForwardId     string                 `protobuf:"bytes,1,opt,name=forward_id,json=forwardId,proto3" json:"forward_id,omitempty"`
+	Address       string                 `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"`
+	Port          int32                  `protobuf:"varint,3,opt,name=port,proto3" json:"port,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReverseForwardPayload) Reset() {
+	*x = ReverseForwardPayload{}
+	mi := &file_proto_message_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReverseForwardPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReverseForwardPayload) ProtoMessage() {}
+
+func (x *ReverseForwardPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_message_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReverseForwardPayload.ProtoReflect.Descriptor instead.
+func (*ReverseForwardPayload) Descriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *ReverseForwardPayload) GetForwardId() string {
+	if x != nil {
+		return x.ForwardId
+	}
+	return ""
+}
+
+func (x *ReverseForwardPayload) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *ReverseForwardPayload) GetPort() int32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+var File_proto_message_proto protoreflect.FileDescriptor
+
+const file_proto_message_proto_rawDesc = "" +
+	"\n" +
+	"\x13proto/message.proto\x12\x06bproxy\"\xc3\x01\n" +
+	"\aMessage\x12'\n" +
+	"\x04type\x18\x01 \x01(\x0e2\x13.bproxy.MessageTypeR\x04type\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x02 \x01(\tR\tsessionId\x12\x18\n" +
+	"\apayload\x18\x03 \x01(\fR\apayload\x12\x1b\n" +
+	"\tsource_id\x18\x04 \x01(\tR\bsourceId\x12\x1b\n" +
+	"\ttarget_id\x18\x05 \x01(\tR\btargetId\x12\x1c\n" +
+	"\ttimestamp\x18\x06 \x01(\x03R\ttimestamp\"\xf0\x03\n" +
+	"\x0fRegisterPayload\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1a\n" +
+	"\bhostname\x18\x02 \x01(\tR\bhostname\x12\x1b\n" +
+	"\tlocal_ips\x18\x03 \x03(\tR\blocalIps\x12\x0e\n" +
+	"\x02os\x18\x04 \x01(\tR\x02os\x12\x12\n" +
+	"\x04arch\x18\x05 \x01(\tR\x04arch\x12\x1b\n" +
+	"\tparent_id\x18\x06 \x01(\tR\bparentId\x12%\n" +
+	"\x0eauth_timestamp\x18\a \x01(\x03R\rauthTimestamp\x12\x1d\n" +
+	"\n" +
+	"auth_nonce\x18\b \x01(\fR\tauthNonce\x12\x19\n" +
+	"\bauth_mac\x18\t \x01(\fR\aauthMac\x12/\n" +
+	"\x13cascade_fingerprint\x18\n" +
+	" \x01(\tR\x12cascadeFingerprint\x12)\n" +
+	"\x10protocol_version\x18\v \x01(\rR\x0fprotocolVersion\x12\"\n" +
+	"\fcapabilities\x18\f \x03(\tR\fcapabilities\x12\x1b\n" +
+	"\tkill_date\x18\r \x01(\x03R\bkillDate\x12#\n" +
+	"\rworking_hours\x18\x0e \x01(\tR\fworkingHours\x12%\n" +
+	"\x0elocal_networks\x18\x0f \x03(\tR\rlocalNetworks\"K\n" +
+	"\x10HeartbeatPayload\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1c\n" +
+	"\ttimestamp\x18\x02 \x01(\x03R\ttimestamp\"\xe7\x01\n" +
+	"\x0eCommandPayload\x12\x18\n" +
+	"\acommand\x18\x01 \x01(\tR\acommand\x12\x12\n" +
+	"\x04args\x18\x02 \x03(\tR\x04args\x121\n" +
+	"\x03env\x18\x03 \x03(\v2\x1f.bproxy.CommandPayload.EnvEntryR\x03env\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x04 \x01(\tR\trequestId\x12\x1d\n" +
+	"\n" +
+	"timeout_ms\x18\x05 \x01(\x03R\ttimeoutMs\x1a6\n" +
+	"\bEnvEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x8d\x01\n" +
+	"\x0fCommandResponse\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12-\n" +
+	"\x06status\x18\x02 \x01(\x0e2\x15.bproxy.CommandStatusR\x06status\x12\x16\n" +
+	"\x06output\x18\x03 \x01(\fR\x06output\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\"\x7f\n" +
+	"\n" +
+	"ExecOutput\x12*\n" +
+	"\x06stream\x18\x01 \x01(\x0e2\x12.bproxy.ExecStreamR\x06stream\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\x12\x1b\n" +
+	"\texit_code\x18\x03 \x01(\x05R\bexitCode\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\"%\n" +
+	"\vExecControl\x12\x16\n" +
+	"\x06cancel\x18\x01 \x01(\bR\x06cancel\"`\n" +
+	"\fShellRequest\x12\x14\n" +
+	"\x05shell\x18\x01 \x01(\tR\x05shell\x12\x12\n" +
+	"\x04term\x18\x02 \x01(\tR\x04term\x12\x12\n" +
+	"\x04rows\x18\x03 \x01(\rR\x04rows\x12\x12\n" +
+	"\x04cols\x18\x04 \x01(\rR\x04cols\"H\n" +
+	"\n" +
+	"ShellInput\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\x12\x12\n" +
+	"\x04rows\x18\x02 \x01(\rR\x04rows\x12\x12\n" +
+	"\x04cols\x18\x03 \x01(\rR\x04cols\"\xcd\x01\n" +
+	"\vFileRequest\x123\n" +
+	"\tdirection\x18\x01 \x01(\x0e2\x15.bproxy.FileDirectionR\tdirection\x12\x12\n" +
+	"\x04path\x18\x02 \x01(\tR\x04path\x12\x12\n" +
+	"\x04size\x18\x03 \x01(\x03R\x04size\x12\x16\n" +
+	"\x06offset\x18\x04 \x01(\x03R\x06offset\x12\x16\n" +
+	"\x06sha256\x18\x05 \x01(\tR\x06sha256\x12\x1d\n" +
+	"\n" +
+	"chunk_size\x18\x06 \x01(\rR\tchunkSize\x12\x12\n" +
+	"\x04mode\x18\a \x01(\rR\x04mode\"f\n" +
+	"\n" +
+	"FileStatus\x12\x14\n" +
+	"\x05error\x18\x01 \x01(\tR\x05error\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size\x12\x16\n" +
+	"\x06offset\x18\x03 \x01(\x03R\x06offset\x12\x16\n" +
+	"\x06sha256\x18\x04 \x01(\tR\x06sha256\")\n" +
+	"\x0fShutdownRequest\x12\x16\n" +
+	"\x06reason\x18\x01 \x01(\tR\x06reason\"(\n" +
+	"\x10ShutdownResponse\x12\x14\n" +
+	"\x05error\x18\x01 \x01(\tR\x05error\"\x80\x01\n" +
+	"\x0eConnectPayload\x12&\n" +
+	"\x0ftarget_agent_id\x18\x01 \x01(\tR\rtargetAgentId\x12%\n" +
+	"\x0etarget_address\x18\x02 \x01(\tR\rtargetAddress\x12\x1f\n" +
+	"\vtarget_port\x18\x03 \x01(\x05R\n" +
+	"targetPort\"\xb8\x01\n" +
+	"\rConnectResult\x12*\n" +
+	"\x05error\x18\x01 \x01(\x0e2\x14.bproxy.ConnectErrorR\x05error\x12\x1d\n" +
+	"\n" +
+	"failed_hop\x18\x02 \x01(\tR\tfailedHop\x12#\n" +
+	"\rbound_address\x18\x03 \x01(\tR\fboundAddress\x12\x1d\n" +
+	"\n" +
+	"bound_port\x18\x04 \x01(\x05R\tboundPort\x12\x18\n" +
+	"\amessage\x18\x05 \x01(\tR\amessage\"=\n" +
+	"\vDataPayload\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\x12\x1a\n" +
+	"\bsequence\x18\x02 \x01(\x05R\bsequence\"N\n" +
+	"\n" +
+	"UdpPayload\x12\x18\n" +
+	"\aaddress\x18\x01 \x01(\tR\aaddress\x12\x12\n" +
+	"\x04port\x18\x02 \x01(\x05R\x04port\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data\";\n" +
+	"\vBindPayload\x12\x18\n" +
+	"\aaddress\x18\x01 \x01(\tR\aaddress\x12\x12\n" +
+	"\x04port\x18\x02 \x01(\x05R\x04port\"d\n" +
+	"\x15ReverseForwardPayload\x12\x1d\n" +
+	"\n" +
+	"forward_id\x18\x01 \x01(\tR\tforwardId\x12\x18\n" +
+	"\aaddress\x18\x02 \x01(\tR\aaddress\x12\x12\n" +
+	"\x04port\x18\x03 \x01(\x05R\x04port*\xf8\x01\n" +
+	"\vMessageType\x12\r\n" +
+	"\tHEARTBEAT\x10\x00\x12\v\n" +
+	"\aCOMMAND\x10\x01\x12\b\n" +
+	"\x04DATA\x10\x02\x12\f\n" +
+	"\bREGISTER\x10\x03\x12\v\n" +
+	"\aCONNECT\x10\x04\x12\t\n" +
+	"\x05RELAY\x10\x05\x12\n" +
+	"\n" +
+	"\x06TUNNEL\x10\x06\x12\a\n" +
+	"\x03UDP\x10\a\x12\b\n" +
+	"\x04BIND\x10\b\x12\x12\n" +
+	"\x0eREVERSE_LISTEN\x10\t\x12\x13\n" +
+	"\x0fREVERSE_CONNECT\x10\n" +
+	"\x12\x12\n" +
+	"\x0eCONNECT_RESULT\x10\v\x12\x14\n" +
+	"\x10COMMAND_RESPONSE\x10\f\x12\b\n" +
+	"\x04EXEC\x10\r\x12\t\n" +
+	"\x05SHELL\x10\x0e\x12\b\n" +
+	"\x04FILE\x10\x0f\x12\f\n" +
+	"\bSHUTDOWN\x10\x10*]\n" +
+	"\rCommandStatus\x12\x0e\n" +
+	"\n" +
+	"COMMAND_OK\x10\x00\x12\x12\n" +
+	"\x0eCOMMAND_FAILED\x10\x01\x12\x13\n" +
+	"\x0fCOMMAND_UNKNOWN\x10\x02\x12\x13\n" +
+	"\x0fCOMMAND_TIMEOUT\x10\x03*=\n" +
+	"\n" +
+	"ExecStream\x12\x0f\n" +
+	"\vEXEC_STDOUT\x10\x00\x12\x0f\n" +
+	"\vEXEC_STDERR\x10\x01\x12\r\n" +
+	"\tEXEC_EXIT\x10\x02*3\n" +
+	"\rFileDirection\x12\x0f\n" +
+	"\vFILE_UPLOAD\x10\x00\x12\x11\n" +
+	"\rFILE_DOWNLOAD\x10\x01*\xec\x01\n" +
+	"\fConnectError\x12\x0e\n" +
+	"\n" +
+	"CONNECT_OK\x10\x00\x12\x1b\n" +
+	"\x17CONNECT_GENERAL_FAILURE\x10\x01\x12\x17\n" +
+	"\x13CONNECT_NOT_ALLOWED\x10\x02\x12\x1f\n" +
+	"\x1bCONNECT_NETWORK_UNREACHABLE\x10\x03\x12\x1c\n" +
+	"\x18CONNECT_HOST_UNREACHABLE\x10\x04\x12\x13\n" +
+	"\x0fCONNECT_REFUSED\x10\x05\x12\x13\n" +
+	"\x0fCONNECT_TIMEOUT\x10\x06\x12\x17\n" +
+	"\x13CONNECT_DNS_FAILURE\x10\a\x12\x14\n" +
+	"\x10CONNECT_NO_ROUTE\x10\bB Z\x1egithub.com/bproxy/bproxy/protob\x06proto3"
 
 var (
 	file_proto_message_proto_rawDescOnce sync.Once
@@ -529,26 +1785,47 @@ func file_proto_message_proto_rawDescGZIP() []byte {
 	return file_proto_message_proto_rawDescData
 }
 
-var file_proto_message_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_proto_message_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_proto_message_proto_enumTypes = make([]protoimpl.EnumInfo, 5)
+var file_proto_message_proto_msgTypes = make([]protoimpl.MessageInfo, 20)
 var file_proto_message_proto_goTypes = []any{
-	(MessageType)(0),         // 0: bproxy.MessageType
-	(*Message)(nil),          // 1: bproxy.Message
-	(*RegisterPayload)(nil),  // 2: bproxy.RegisterPayload
-	(*HeartbeatPayload)(nil), // 3: bproxy.HeartbeatPayload
-	(*CommandPayload)(nil),   // 4: bproxy.CommandPayload
-	(*ConnectPayload)(nil),   // 5: bproxy.ConnectPayload
-	(*DataPayload)(nil),      // 6: bproxy.DataPayload
-	nil,                      // 7: bproxy.CommandPayload.EnvEntry
+	(MessageType)(0),              // 0: bproxy.MessageType
+	(CommandStatus)(0),            // 1: bproxy.CommandStatus
+	(ExecStream)(0),               // 2: bproxy.ExecStream
+	(FileDirection)(0),            // 3: bproxy.FileDirection
+	(ConnectError)(0),             // 4: bproxy.ConnectError
+	(*Message)(nil),               // 5: bproxy.Message
+	(*RegisterPayload)(nil),       // 6: bproxy.RegisterPayload
+	(*HeartbeatPayload)(nil),      // 7: bproxy.HeartbeatPayload
+	(*CommandPayload)(nil),        // 8: bproxy.CommandPayload
+	(*CommandResponse)(nil),       // 9: bproxy.CommandResponse
+	(*ExecOutput)(nil),            // 10: bproxy.ExecOutput
+	(*ExecControl)(nil),           // 11: bproxy.ExecControl
+	(*ShellRequest)(nil),          // 12: bproxy.ShellRequest
+	(*ShellInput)(nil),            // 13: bproxy.ShellInput
+	(*FileRequest)(nil),           // 14: bproxy.FileRequest
+	(*FileStatus)(nil),            // 15: bproxy.FileStatus
+	(*ShutdownRequest)(nil),       // 16: bproxy.ShutdownRequest
+	(*ShutdownResponse)(nil),      // 17: bproxy.ShutdownResponse
+	(*ConnectPayload)(nil),        // 18: bproxy.ConnectPayload
+	(*ConnectResult)(nil),         // 19: bproxy.ConnectResult
+	(*DataPayload)(nil),           // 20: bproxy.DataPayload
+	(*UdpPayload)(nil),            // 21: bproxy.UdpPayload
+	(*BindPayload)(nil),           // 22: bproxy.BindPayload
+	(*ReverseForwardPayload)(nil), // 23: bproxy.ReverseForwardPayload
+	nil,                           // 24: bproxy.CommandPayload.EnvEntry
 }
 var file_proto_message_proto_depIdxs = []int32{
-	0, // 0: bproxy.Message.type:type_name -> bproxy.MessageType
-	7, // 1: bproxy.CommandPayload.env:type_name -> bproxy.CommandPayload.EnvEntry
-	2, // [2:2] is the sub-list for method output_type
-	2, // [2:2] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	0,  // 0: bproxy.Message.type:type_name -> bproxy.MessageType
+	24, // 1: bproxy.CommandPayload.env:type_name -> bproxy.CommandPayload.EnvEntry
+	1,  // 2: bproxy.CommandResponse.status:type_name -> bproxy.CommandStatus
+	2,  // 3: bproxy.ExecOutput.stream:type_name -> bproxy.ExecStream
+	3,  // 4: bproxy.FileRequest.direction:type_name -> bproxy.FileDirection
+	4,  // 5: bproxy.ConnectResult.error:type_name -> bproxy.ConnectError
+	6,  // [6:6] is the sub-list for method output_type
+	6,  // [6:6] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
 }
 
 func init() { file_proto_message_proto_init() }
@@ -561,8 +1838,8 @@ func file_proto_message_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_message_proto_rawDesc), len(file_proto_message_proto_rawDesc)),
-			NumEnums:      1,
-			NumMessages:   7,
+			NumEnums:      5,
+			NumMessages:   20,
 			NumExtensions: 0,
 			NumServices:   0,
 		},